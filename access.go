@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/repo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Access controls access to private dists and components when serving the
+// repository.
+type Access struct {
+	Private []string // DIST or DIST/COMPONENT patterns (see accessMatch) which require authentication
+	Users   []*AccessUser
+
+	verified sync.Map // sha256 of verified basic auth credentials -> *AccessUser
+}
+
+// AccessUser is a user who can access private dists and components. Users are
+// loaded from a htpasswd-style file with lines in the format
+// NAME:CREDENTIAL:SCOPES, where CREDENTIAL is one of:
+//
+//	$2y$...        a bcrypt password hash (for HTTP basic auth, e.g. from htpasswd -B)
+//	{SHA}...       a base64 SHA-1 password hash (for HTTP basic auth, e.g. from htpasswd -s)
+//	{TOKEN}HEX     a hex SHA-256 hash of a bearer token
+//	{X509}         a verified TLS client certificate with NAME as the common name
+//
+// and SCOPES is a comma-separated list of DIST or DIST/COMPONENT patterns.
+type AccessUser struct {
+	Name       string
+	Credential string
+	Scopes     []string
+}
+
+// LoadAccessUsers reads users from a file (see AccessUser).
+func LoadAccessUsers(fn string) ([]*AccessUser, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseAccessUsers(f)
+}
+
+// ParseAccessUsers parses users (see AccessUser).
+func ParseAccessUsers(r io.Reader) ([]*AccessUser, error) {
+	var users []*AccessUser
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		spl := strings.SplitN(line, ":", 3)
+		if len(spl) < 2 || spl[0] == "" {
+			return nil, fmt.Errorf("line %d: expected NAME:CREDENTIAL:SCOPES", n)
+		}
+
+		u := &AccessUser{Name: spl[0], Credential: spl[1]}
+		switch {
+		case strings.HasPrefix(u.Credential, "$2"):
+			if _, err := bcrypt.Cost([]byte(u.Credential)); err != nil {
+				return nil, fmt.Errorf("line %d: invalid bcrypt hash: %v", n, err)
+			}
+		case strings.HasPrefix(u.Credential, "{SHA}"):
+			if buf, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(u.Credential, "{SHA}")); err != nil || len(buf) != sha1.Size {
+				return nil, fmt.Errorf("line %d: invalid SHA-1 hash", n)
+			}
+		case strings.HasPrefix(u.Credential, "{TOKEN}"):
+			if h := strings.TrimPrefix(u.Credential, "{TOKEN}"); len(h) != sha256.Size*2 || strings.Trim(strings.ToLower(h), "0123456789abcdef") != "" {
+				return nil, fmt.Errorf("line %d: invalid token hash (expected a hex SHA-256 hash)", n)
+			}
+			u.Credential = "{TOKEN}" + strings.ToLower(strings.TrimPrefix(u.Credential, "{TOKEN}"))
+		case u.Credential == "{X509}":
+		default:
+			return nil, fmt.Errorf("line %d: unsupported credential type (expected bcrypt, {SHA}, {TOKEN}, or {X509})", n)
+		}
+
+		if len(spl) == 3 {
+			for _, s := range strings.Split(spl[2], ",") {
+				if s = strings.TrimSpace(s); s != "" {
+					if _, err := path.Match(s, ""); err != nil {
+						return nil, fmt.Errorf("line %d: invalid scope %#v: %v", n, s, err)
+					}
+					u.Scopes = append(u.Scopes, s)
+				}
+			}
+		}
+
+		users = append(users, u)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// accessMatch checks if any of the patterns match a dist and component. A
+// pattern without a slash matches all components of the dists it matches.
+// Patterns are matched using path.Match.
+func accessMatch(patterns []string, dist, comp string) bool {
+	for _, p := range patterns {
+		if !strings.Contains(p, "/") {
+			p += "/*"
+		}
+		if ok, _ := path.Match(p, dist+"/"+comp); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed checks if a user (or nil for anonymous users) can access a dist and
+// component.
+func (a *Access) Allowed(u *AccessUser, dist, comp string) bool {
+	return !accessMatch(a.Private, dist, comp) || (u != nil && accessMatch(u.Scopes, dist, comp))
+}
+
+// Authenticate returns the user for a request, or nil if there aren't any
+// credentials. An error is returned if the credentials are invalid.
+func (a *Access) Authenticate(r *http.Request) (*AccessUser, error) {
+	if name, pass, ok := r.BasicAuth(); ok {
+		key := fmt.Sprintf("%x", sha256.Sum256([]byte(name+":"+pass)))
+		if u, ok := a.verified.Load(key); ok {
+			return u.(*AccessUser), nil
+		}
+		for _, u := range a.Users {
+			if u.Name != name {
+				continue
+			}
+			var ok bool
+			switch {
+			case strings.HasPrefix(u.Credential, "$2"):
+				ok = bcrypt.CompareHashAndPassword([]byte(u.Credential), []byte(pass)) == nil
+			case strings.HasPrefix(u.Credential, "{SHA}"):
+				h := sha1.Sum([]byte(pass))
+				ok = subtle.ConstantTimeCompare([]byte(u.Credential), []byte("{SHA}"+base64.StdEncoding.EncodeToString(h[:]))) == 1
+			}
+			if ok {
+				a.verified.Store(key, u) // bcrypt is slow, and apt makes a lot of requests
+				return u, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		tok := fmt.Sprintf("{TOKEN}%x", sha256.Sum256([]byte(strings.TrimSpace(strings.TrimPrefix(h, "Bearer ")))))
+		for _, u := range a.Users {
+			if subtle.ConstantTimeCompare([]byte(u.Credential), []byte(tok)) == 1 {
+				return u, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 && len(r.TLS.VerifiedChains[0]) != 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		for _, u := range a.Users {
+			if u.Credential == "{X509}" && u.Name == cn {
+				return u, nil
+			}
+		}
+		return nil, nil // the certificate may be for something else, so treat it as anonymous
+	}
+
+	return nil, nil
+}
+
+// WebViews returns the DIST/COMPONENTs which can be viewed by anonymous users,
+// and the views (see accessViewName) needed for the other users.
+func (a *Access) WebViews(dists map[string]map[string][]*deb.Deb) ([]string, map[string][]string) {
+	var all []string
+	for distName, dist := range dists {
+		for compName := range dist {
+			all = append(all, distName+"/"+compName)
+		}
+	}
+	sort.Strings(all)
+
+	public := a.visible(nil, all)
+	views := map[string][]string{}
+	for _, u := range a.Users {
+		if v := a.visible(u, all); !equalSlices(v, public) {
+			views[accessViewName(v)] = v
+		}
+	}
+	return public, views
+}
+
+// visible returns the DIST/COMPONENTs in all which a user can access.
+func (a *Access) visible(u *AccessUser, all []string) []string {
+	v := []string{}
+	for _, dc := range all {
+		if spl := strings.SplitN(dc, "/", 2); a.Allowed(u, spl[0], spl[1]) {
+			v = append(v, dc)
+		}
+	}
+	return v
+}
+
+// accessViewName returns the name of the web view containing a sorted list of
+// DIST/COMPONENTs.
+func accessViewName(v []string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(v, "\n"))))[:16]
+}
+
+// accessIndex maps the paths in the pool and changelogs of a generated
+// repository to the DIST/COMPONENTs they belong to.
+type accessIndex struct {
+	comps map[string][]string // dist -> DIST/COMPONENTs
+	paths map[string][]string // path (including parent dirs) -> DIST/COMPONENTs
+}
+
+// newAccessIndex builds an accessIndex from the Packages indexes in a
+// generated repository.
+func newAccessIndex(root string) (*accessIndex, error) {
+	ix := &accessIndex{
+		comps: map[string][]string{},
+		paths: map[string][]string{},
+	}
+	add := func(p, dc string) {
+		for ; p != "." && p != "/"; p = path.Dir(p) {
+			if !inSlice(ix.paths[p], dc) {
+				ix.paths[p] = append(ix.paths[p], dc)
+			}
+		}
+	}
+
+	fns, err := filepath.Glob(filepath.Join(root, "dists", "*", "*", "binary-*", "Packages"))
+	if err != nil {
+		return nil, err
+	}
+	for _, fn := range fns {
+		compRoot := filepath.Dir(filepath.Dir(fn))
+		distName, compName := filepath.Base(filepath.Dir(compRoot)), filepath.Base(compRoot)
+		dc := distName + "/" + compName
+		if !inSlice(ix.comps[distName], dc) {
+			ix.comps[distName] = append(ix.comps[distName], dc)
+		}
+
+		buf, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, fmt.Errorf("error reading index: %v", err)
+		}
+		cs, err := control.ParseAll(string(buf))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing index %s: %v", fn, err)
+		}
+		for _, c := range cs {
+			if fn, ok := c.Get("Filename"); ok {
+				add(path.Clean(fn), dc)
+			}
+			if _, ok := c.Get("Package"); ok {
+				add(repo.ChangelogPath(compName, &deb.Deb{Control: c}), dc)
+			}
+		}
+	}
+	return ix, nil
+}
+
+// scopes returns the DIST/COMPONENTs a path (relative to the root, with
+// forward slashes) belongs to, or nil if it isn't specific to any.
+func (ix *accessIndex) scopes(name string) []string {
+	spl := strings.Split(name, "/")
+	switch spl[0] {
+	case "dists":
+		if len(spl) >= 3 && inSlice(ix.comps[spl[1]], spl[1]+"/"+spl[2]) {
+			return []string{spl[1] + "/" + spl[2]}
+		}
+		if len(spl) >= 2 {
+			return ix.comps[spl[1]]
+		}
+	case "pool", "changelogs":
+		return ix.paths[name]
+	}
+	return nil
+}
+
+// all returns all DIST/COMPONENTs, sorted.
+func (ix *accessIndex) all() []string {
+	var all []string
+	for _, dcs := range ix.comps {
+		all = append(all, dcs...)
+	}
+	sort.Strings(all)
+	return all
+}
+
+// allowed checks if a user can access any of the DIST/COMPONENTs in scopes.
+// If scopes is empty, it is always allowed.
+func (a *Access) allowed(u *AccessUser, scopes []string) bool {
+	if len(scopes) == 0 {
+		return true
+	}
+	for _, dc := range scopes {
+		if spl := strings.SplitN(dc, "/", 2); len(spl) == 2 && a.Allowed(u, spl[0], spl[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalSlices(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func inSlice(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
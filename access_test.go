@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/repogen/deb"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testAccessUsers(t *testing.T) string {
+	bc, err := bcrypt.GenerateFromPassword([]byte("alicepass"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	sh := sha1.Sum([]byte("bobpass"))
+	return strings.Join([]string{
+		"# comment",
+		"alice:" + string(bc) + ":stable/internal,testing",
+		"bob:{SHA}" + base64.StdEncoding.EncodeToString(sh[:]) + ":*/internal",
+		fmt.Sprintf("ci:{TOKEN}%x:stable/main", sha256.Sum256([]byte("citoken"))),
+		"host1:{X509}:testing/internal",
+		"nobody:{X509}",
+	}, "\n")
+}
+
+func TestParseAccessUsers(t *testing.T) {
+	users, err := ParseAccessUsers(strings.NewReader(testAccessUsers(t)))
+	assert.NoError(t, err)
+	assert.Len(t, users, 5)
+	assert.Equal(t, "alice", users[0].Name)
+	assert.Equal(t, []string{"stable/internal", "testing"}, users[0].Scopes)
+	assert.Equal(t, []string{"*/internal"}, users[1].Scopes)
+	assert.Nil(t, users[4].Scopes)
+
+	for _, c := range []string{
+		"alice",
+		":{X509}:stable",
+		"alice:plaintext:stable",
+		"alice:{SHA}aaaa:stable",
+		"alice:{TOKEN}abcd:stable",
+		"alice:{X509}:[",
+	} {
+		_, err := ParseAccessUsers(strings.NewReader(c))
+		assert.Error(t, err, "%#v should be invalid", c)
+	}
+}
+
+func TestAccess(t *testing.T) {
+	users, err := ParseAccessUsers(strings.NewReader(testAccessUsers(t)))
+	assert.NoError(t, err)
+	a := &Access{
+		Private: []string{"*/internal", "testing"},
+		Users:   users,
+	}
+
+	assert.True(t, a.Allowed(nil, "stable", "main"))
+	assert.False(t, a.Allowed(nil, "stable", "internal"))
+	assert.False(t, a.Allowed(nil, "testing", "main"))
+	assert.True(t, a.Allowed(users[0], "stable", "internal"))
+	assert.False(t, a.Allowed(users[0], "other", "internal"))
+	assert.True(t, a.Allowed(users[0], "testing", "main"))
+	assert.True(t, a.Allowed(users[1], "other", "internal"))
+	assert.False(t, a.Allowed(users[1], "testing", "main"))
+
+	auth := func(f func(r *http.Request)) (string, error) {
+		r := httptest.NewRequest("GET", "/", nil)
+		f(r)
+		u, err := a.Authenticate(r)
+		if u == nil {
+			return "", err
+		}
+		return u.Name, err
+	}
+
+	u, err := auth(func(r *http.Request) {})
+	assert.NoError(t, err)
+	assert.Empty(t, u, "should be anonymous without credentials")
+
+	for i := 0; i < 2; i++ {
+		u, err = auth(func(r *http.Request) { r.SetBasicAuth("alice", "alicepass") })
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", u, "should check bcrypt passwords")
+	}
+
+	_, err = auth(func(r *http.Request) { r.SetBasicAuth("alice", "bobpass") })
+	assert.Error(t, err, "should check bcrypt passwords")
+
+	u, err = auth(func(r *http.Request) { r.SetBasicAuth("bob", "bobpass") })
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", u, "should check SHA-1 passwords")
+
+	_, err = auth(func(r *http.Request) { r.SetBasicAuth("ci", "citoken") })
+	assert.Error(t, err, "tokens should not be usable as passwords")
+
+	u, err = auth(func(r *http.Request) { r.Header.Set("Authorization", "Bearer citoken") })
+	assert.NoError(t, err)
+	assert.Equal(t, "ci", u, "should check tokens")
+
+	_, err = auth(func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") })
+	assert.Error(t, err, "should check tokens")
+
+	u, err = auth(func(r *http.Request) {
+		r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "host1"}}}}}
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "host1", u, "should check client certificates")
+
+	public, views := a.WebViews(map[string]map[string][]*deb.Deb{
+		"stable":  {"main": nil, "internal": nil},
+		"testing": {"main": nil, "internal": nil},
+	})
+	assert.Equal(t, []string{"stable/main"}, public)
+	assert.Equal(t, map[string][]string{
+		accessViewName([]string{"stable/internal", "stable/main", "testing/internal", "testing/main"}): {"stable/internal", "stable/main", "testing/internal", "testing/main"}, // alice
+		accessViewName([]string{"stable/internal", "stable/main", "testing/internal"}):                 {"stable/internal", "stable/main", "testing/internal"},                 // bob
+		accessViewName([]string{"stable/main", "testing/internal"}):                                    {"stable/main", "testing/internal"},                                    // host1
+	}, views, "there should be a view for each distinct set of visible components")
+}
+
+func TestServerAccess(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-access")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	write := func(fn, contents string) {
+		fn = filepath.Join(td, filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, []byte(contents), 0644))
+	}
+	write("dists/stable/Release", "Components: main internal\n")
+	write("dists/testing/Release", "Components: internal\n")
+	write("dists/stable/main/binary-amd64/Packages", "Package: pub\nVersion: 1.0\nFilename: pool/main/p/pub/pub_1.0_amd64.deb\n\nPackage: shared\nVersion: 1.0\nFilename: pool/main/s/shared/shared_1.0_amd64.deb\n")
+	write("dists/stable/internal/binary-amd64/Packages", "Package: priv\nVersion: 1.0\nSource: privsrc\nFilename: pool/internal/p/priv/priv_1.0_amd64.deb\n")
+	write("dists/testing/internal/binary-amd64/Packages", "Package: shared\nVersion: 1.0\nFilename: pool/main/s/shared/shared_1.0_amd64.deb\n")
+	write("pool/main/p/pub/pub_1.0_amd64.deb", "pub")
+	write("pool/main/s/shared/shared_1.0_amd64.deb", "shared")
+	write("pool/internal/p/priv/priv_1.0_amd64.deb", "priv")
+	write("changelogs/internal/p/privsrc/privsrc_1.0_changelog", "changelog")
+	write("packages/index.html", "public")
+	write(".web/"+accessViewName([]string{"stable/internal", "stable/main", "testing/internal"})+"/index.html", "alice")
+	write("key.asc", "key")
+
+	users, err := ParseAccessUsers(strings.NewReader(testAccessUsers(t)))
+	assert.NoError(t, err)
+
+	s := NewServer(td)
+	s.Access = &Access{
+		Private: []string{"*/internal"},
+		Users:   users,
+	}
+
+	get := func(url, user, pass string) (int, string) {
+		r := httptest.NewRequest("GET", url, nil)
+		if user != "" {
+			r.SetBasicAuth(user, pass)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w.Code, w.Body.String()
+	}
+
+	for _, c := range []struct {
+		url   string
+		anon  int
+		alice int
+	}{
+		{"/key.asc", 200, 200},
+		{"/dists/stable/Release", 200, 200},
+		{"/dists/stable/main/binary-amd64/Packages", 200, 200},
+		{"/dists/stable/internal/binary-amd64/Packages", 401, 200},
+		{"/dists/testing/Release", 401, 200},
+		{"/pool/main/p/pub/pub_1.0_amd64.deb", 200, 200},
+		{"/pool/main/s/shared/shared_1.0_amd64.deb", 200, 200},
+		{"/pool/internal/p/priv/priv_1.0_amd64.deb", 401, 200},
+		{"/pool/internal/", 401, 200},
+		{"/changelogs/internal/p/privsrc/privsrc_1.0_changelog", 401, 200},
+		{"/.web/", 404, 404},
+	} {
+		code, _ := get(c.url, "", "")
+		assert.Equal(t, c.anon, code, "%s (anonymous)", c.url)
+		code, _ = get(c.url, "alice", "alicepass")
+		assert.Equal(t, c.alice, code, "%s (alice)", c.url)
+	}
+
+	code, _ := get("/pool/internal/p/priv/priv_1.0_amd64.deb", "ci", "citoken")
+	assert.Equal(t, http.StatusUnauthorized, code, "invalid credentials should be rejected")
+
+	r := httptest.NewRequest("GET", "/pool/internal/p/priv/priv_1.0_amd64.deb", nil)
+	r.Header.Set("Authorization", "Bearer citoken")
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code, "users without access should be forbidden")
+
+	_, body := get("/pool/", "", "")
+	assert.Contains(t, body, "main/")
+	assert.NotContains(t, body, "internal/", "listings should only show accessible files")
+
+	_, body = get("/pool/", "alice", "alicepass")
+	assert.Contains(t, body, "internal/", "listings should show accessible files")
+
+	_, body = get("/packages/", "", "")
+	assert.Equal(t, "public", body)
+
+	_, body = get("/packages/", "alice", "alicepass")
+	assert.Equal(t, "alice", body, "users should see the web interface for what they can access")
+
+	s.Status = func() Status {
+		return Status{OK: false, Generation: "out.gen-1", LastError: "could not scan testing/internal", Failures: 1}
+	}
+	code, body = get("/status", "", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"ok": false}`, body, "anonymous users shouldn't see the error details")
+	code, body = get("/status", "alice", "alicepass")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "could not scan testing/internal", "users should see the error details")
+	code, _ = get("/status", "alice", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, code, "invalid credentials should be rejected")
+}
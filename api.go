@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/repo"
+)
+
+// apiMaxUploadSize is the maximum size of an uploaded package.
+const apiMaxUploadSize = 2 << 30
+
+var (
+	apiPackageRe = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+$`)
+	apiVersionRe = regexp.MustCompile(`^[0-9][A-Za-z0-9.+~:-]*$`)
+	apiArchRe    = regexp.MustCompile(`^[a-z0-9-]+$`)
+)
+
+// API is the HTTP API for managing the packages in the input dir. All
+// requests must be authenticated with one of the Tokens as a bearer token.
+//
+//	GET    /api/packages[?dist=DIST&component=COMPONENT&package=PACKAGE]
+//	POST   /api/packages/DIST/COMPONENT[?publish=true] (body is the deb, or a multipart form with a file field)
+//	DELETE /api/packages/DIST/COMPONENT/PACKAGE/VERSION[?arch=ARCH&publish=true]
+//	POST   /api/publish
+//
+// Errors are returned as JSON objects with an error field.
+type API struct {
+	InRoot        string
+	Tokens        []string
+	Publish       func() error // regenerates the repository (optional)
+	MaxUploadSize int64        // the maximum size of an uploaded package (default 2 GiB)
+}
+
+// APIPackage is a package in the input dir.
+type APIPackage struct {
+	Dist         string `json:"dist"`
+	Component    string `json:"component"`
+	Package      string `json:"package"`
+	Version      string `json:"version"`
+	Architecture string `json:"architecture"`
+	Filename     string `json:"filename"` // relative to the input dir
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+}
+
+// apiError is an error with a HTTP status code.
+type apiError struct {
+	Status int
+	Err    string
+}
+
+func (e *apiError) Error() string {
+	return e.Err
+}
+
+func apiErrorf(status int, format string, a ...interface{}) *apiError {
+	return &apiError{status, fmt.Sprintf(format, a...)}
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authenticate(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="repogen"`)
+		apiRespond(w, nil, apiErrorf(http.StatusUnauthorized, "invalid or missing token"))
+		return
+	}
+
+	p := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && len(p) == 1 && p[0] == "packages":
+		v, err := a.list(r.Context(), r.URL.Query().Get("dist"), r.URL.Query().Get("component"), r.URL.Query().Get("package"))
+		apiRespond(w, v, err)
+	case r.Method == http.MethodPost && len(p) == 3 && p[0] == "packages":
+		v, err := a.upload(w, r, p[1], p[2])
+		if err == nil && r.URL.Query().Get("publish") == "true" {
+			err = a.publish()
+		}
+		apiRespond(w, v, err)
+	case r.Method == http.MethodDelete && len(p) == 5 && p[0] == "packages":
+		v, err := a.remove(r.Context(), p[1], p[2], p[3], p[4], r.URL.Query().Get("arch"))
+		if err == nil && r.URL.Query().Get("publish") == "true" {
+			err = a.publish()
+		}
+		apiRespond(w, v, err)
+	case r.Method == http.MethodPost && len(p) == 1 && p[0] == "publish":
+		apiRespond(w, map[string]bool{"published": true}, a.publish())
+	case len(p) >= 1 && (p[0] == "packages" || p[0] == "publish"):
+		apiRespond(w, nil, apiErrorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method))
+	default:
+		apiRespond(w, nil, apiErrorf(http.StatusNotFound, "not found"))
+	}
+}
+
+// authenticate checks the bearer token of a request.
+func (a *API) authenticate(r *http.Request) bool {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return false
+	}
+	tok := []byte(strings.TrimSpace(strings.TrimPrefix(h, "Bearer ")))
+	var ok bool
+	for _, t := range a.Tokens {
+		if t != "" && subtle.ConstantTimeCompare(tok, []byte(t)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// list lists the packages in the input dir, optionally filtered.
+func (a *API) list(ctx context.Context, dist, comp, pkg string) ([]*APIPackage, error) {
+	r, err := repo.New(repo.Options{InRoot: a.InRoot})
+	if err != nil {
+		return nil, fmt.Errorf("could not scan deb packages: %v", err)
+	}
+	if err := r.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("could not scan deb packages: %v", err)
+	}
+
+	pkgs := []*APIPackage{}
+	for distName, d := range r.Dists {
+		if dist != "" && distName != dist {
+			continue
+		}
+		for compName, c := range d {
+			if comp != "" && compName != comp {
+				continue
+			}
+			for _, d := range c {
+				p := newAPIPackage(a.InRoot, distName, compName, d)
+				if pkg != "" && p.Package != pkg {
+					continue
+				}
+				pkgs = append(pkgs, p)
+			}
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Filename < pkgs[j].Filename
+	})
+	return pkgs, nil
+}
+
+// upload adds a package to the input dir after checking it can be read. If the
+// same package already exists, it must be identical.
+func (a *API) upload(w http.ResponseWriter, r *http.Request, dist, comp string) (*APIPackage, error) {
+	if !repo.ValidName(dist) || !repo.ValidName(comp) {
+		return nil, apiErrorf(http.StatusBadRequest, "invalid dist or component name: must match [a-z-]")
+	}
+
+	maxSize := a.MaxUploadSize
+	if maxSize == 0 {
+		maxSize = apiMaxUploadSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	body := io.Reader(r.Body)
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "multipart/form-data" {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, apiErrorf(http.StatusBadRequest, "could not read form: %v", err)
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil, apiErrorf(http.StatusBadRequest, "no file in form")
+			} else if err != nil {
+				return nil, apiReadError("could not read form", err)
+			}
+			if part.FormName() == "file" {
+				body = part
+				break
+			}
+		}
+	}
+
+	compRoot := filepath.Join(a.InRoot, dist, comp)
+	if err := os.MkdirAll(compRoot, 0755); err != nil {
+		return nil, fmt.Errorf("could not make component dir: %v", err)
+	}
+
+	// the temp file is hidden, so it is ignored if the repository is generated
+	// while it is being written
+	tf, err := ioutil.TempFile(compRoot, ".upload-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("could not create temp file: %v", err)
+	}
+	defer os.Remove(tf.Name())
+
+	if _, err := io.Copy(tf, body); err != nil {
+		tf.Close()
+		return nil, apiReadError("could not read upload", err)
+	}
+	if err := tf.Close(); err != nil {
+		return nil, fmt.Errorf("could not write temp file: %v", err)
+	}
+
+	d, err := deb.Open(tf.Name(), false, false)
+	if err != nil {
+		return nil, apiErrorf(http.StatusUnprocessableEntity, "invalid deb: %v", err)
+	}
+
+	pkgName, pkgVer, pkgArch := d.Package(), d.Version(), d.Architecture()
+	if !apiPackageRe.MatchString(pkgName) || !apiVersionRe.MatchString(pkgVer) || !apiArchRe.MatchString(pkgArch) {
+		return nil, apiErrorf(http.StatusUnprocessableEntity, "invalid deb: invalid package name, version, or architecture")
+	}
+
+	if err := os.Chmod(tf.Name(), 0644); err != nil {
+		return nil, fmt.Errorf("could not set permissions: %v", err)
+	}
+
+	// link instead of renaming so concurrent uploads can't replace each other
+	fn := filepath.Join(compRoot, debFilename(pkgName, pkgVer, pkgArch))
+	if err := os.Link(tf.Name(), fn); os.IsExist(err) {
+		ed, err := deb.Open(fn, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("could not read existing package: %v", err)
+		}
+		if ed.Sums["SHA256"] != d.Sums["SHA256"] {
+			return nil, apiErrorf(http.StatusConflict, "%s %s (%s) already exists in %s/%s with different contents", pkgName, pkgVer, pkgArch, dist, comp)
+		}
+		return newAPIPackage(a.InRoot, dist, comp, ed), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not add package: %v", err)
+	}
+	d.Filename = fn
+
+	fmt.Printf("Info: added %s %s (%s) to %s/%s\n", pkgName, pkgVer, pkgArch, dist, comp)
+	return newAPIPackage(a.InRoot, dist, comp, d), nil
+}
+
+// apiReadError returns the error for reading an upload.
+func apiReadError(what string, err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return apiErrorf(http.StatusRequestEntityTooLarge, "%s: upload is larger than %d bytes", what, mbe.Limit)
+	}
+	return apiErrorf(http.StatusBadRequest, "%s: %v", what, err)
+}
+
+// remove removes a package version from the input dir.
+func (a *API) remove(ctx context.Context, dist, comp, pkg, ver, arch string) ([]*APIPackage, error) {
+	pkgs, err := a.list(ctx, dist, comp, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []*APIPackage{}
+	for _, p := range pkgs {
+		if p.Version != ver || (arch != "" && p.Architecture != arch) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(a.InRoot, filepath.FromSlash(p.Filename))); err != nil {
+			return removed, fmt.Errorf("could not remove %s: %v", p.Filename, err)
+		}
+		fmt.Printf("Info: removed %s %s (%s) from %s/%s\n", p.Package, p.Version, p.Architecture, dist, comp)
+		removed = append(removed, p)
+	}
+	if len(removed) == 0 {
+		return nil, apiErrorf(http.StatusNotFound, "no such package version")
+	}
+	return removed, nil
+}
+
+// publish regenerates the repository.
+func (a *API) publish() error {
+	if a.Publish == nil {
+		return apiErrorf(http.StatusNotImplemented, "publishing is not supported")
+	}
+	if err := a.Publish(); err != nil {
+		return fmt.Errorf("could not publish: %v", err)
+	}
+	return nil
+}
+
+func newAPIPackage(inRoot, dist, comp string, d *deb.Deb) *APIPackage {
+	fn, err := filepath.Rel(inRoot, d.Filename)
+	if err != nil {
+		fn = d.Filename
+	}
+	return &APIPackage{
+		Dist:         dist,
+		Component:    comp,
+		Package:      d.Package(),
+		Version:      d.Version(),
+		Architecture: d.Architecture(),
+		Filename:     filepath.ToSlash(fn),
+		Size:         d.Size,
+		SHA256:       d.Sums["SHA256"],
+	}
+}
+
+// apiRespond writes v as JSON, or err as a JSON error.
+func apiRespond(w http.ResponseWriter, v interface{}, err error) {
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+		if ae, ok := err.(*apiError); ok {
+			status = ae.Status
+		}
+		v = map[string]string{"error": err.Error()}
+	}
+
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		status, buf = http.StatusInternalServerError, []byte(`{"error": "could not encode response"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(append(buf, '\n'))
+}
+
+// debFilename returns the conventional filename for a deb (the epoch is not
+// included).
+func debFilename(pkg, ver, arch string) string {
+	if i := strings.Index(ver, ":"); i >= 0 {
+		ver = ver[i+1:]
+	}
+	return fmt.Sprintf("%s_%s_%s.deb", pkg, ver, arch)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testDeb builds a minimal deb with the specified control file.
+func testDeb(t *testing.T, control string) []byte {
+	tb := new(bytes.Buffer)
+	tw := tar.NewWriter(tb)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))}))
+	_, err := tw.Write([]byte(control))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+
+	ab := bytes.NewBufferString("!<arch>\n")
+	for _, m := range []struct {
+		name string
+		buf  []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", testGz(t, tb.Bytes())},
+		{"data.tar.gz", testGz(t, nil)},
+	} {
+		fmt.Fprintf(ab, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", m.name, 0, 0, 0, "100644", len(m.buf))
+		ab.Write(m.buf)
+		if len(m.buf)%2 == 1 {
+			ab.WriteByte('\n')
+		}
+	}
+	return ab.Bytes()
+}
+
+func testGz(t *testing.T, data []byte) []byte {
+	b := new(bytes.Buffer)
+	w := gzip.NewWriter(b)
+	_, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return b.Bytes()
+}
+
+func TestAPI(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-api")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	var published int
+	a := &API{
+		InRoot: td,
+		Tokens: []string{"secret"},
+		Publish: func() error {
+			published++
+			return nil
+		},
+	}
+
+	do := func(method, url, token, ct string, body []byte) (int, string) {
+		r := httptest.NewRequest(method, url, bytes.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if ct != "" {
+			r.Header.Set("Content-Type", ct)
+		}
+		w := httptest.NewRecorder()
+		a.ServeHTTP(w, r)
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"), "%s %s: response should be JSON", method, url)
+		return w.Code, w.Body.String()
+	}
+
+	deb := testDeb(t, "Package: foo\nVersion: 1:1.0\nArchitecture: amd64\nDescription: test\n")
+	debChanged := testDeb(t, "Package: foo\nVersion: 1:1.0\nArchitecture: amd64\nDescription: changed\n")
+
+	code, body := do("GET", "/api/packages", "", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, code, "should require a token")
+	assert.JSONEq(t, `{"error": "invalid or missing token"}`, body)
+
+	code, _ = do("GET", "/api/packages", "wrong", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, code, "should require a valid token")
+
+	code, body = do("GET", "/api/packages", "secret", "", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `[]`, body)
+
+	code, body = do("POST", "/api/packages/stable/main", "secret", "application/vnd.debian.binary-package", []byte("not a deb"))
+	assert.Equal(t, http.StatusUnprocessableEntity, code, "should validate uploads: %s", body)
+
+	code, body = do("POST", "/api/packages/stable/main", "secret", "", testDeb(t, "Package: ../foo\nVersion: 1.0\nArchitecture: amd64\n"))
+	assert.Equal(t, http.StatusUnprocessableEntity, code, "should validate package names: %s", body)
+
+	code, _ = do("POST", "/api/packages/Stable/main", "secret", "", deb)
+	assert.Equal(t, http.StatusBadRequest, code, "should validate dist names")
+
+	code, body = do("POST", "/api/packages/stable/main", "secret", "application/vnd.debian.binary-package", deb)
+	assert.Equal(t, http.StatusOK, code, "should upload: %s", body)
+	var p APIPackage
+	assert.NoError(t, json.Unmarshal([]byte(body), &p))
+	assert.Equal(t, "stable/main/foo_1.0_amd64.deb", p.Filename)
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256(deb)), p.SHA256)
+	assert.FileExists(t, filepath.Join(td, "stable", "main", "foo_1.0_amd64.deb"))
+
+	code, _ = do("POST", "/api/packages/stable/main", "secret", "", deb)
+	assert.Equal(t, http.StatusOK, code, "should allow re-uploading identical packages")
+
+	code, body = do("POST", "/api/packages/stable/main", "secret", "", debChanged)
+	assert.Equal(t, http.StatusConflict, code, "should not allow replacing packages: %s", body)
+
+	mb := new(bytes.Buffer)
+	mw := multipart.NewWriter(mb)
+	fw, err := mw.CreateFormFile("file", "foo.deb")
+	assert.NoError(t, err)
+	fw.Write(deb)
+	assert.NoError(t, mw.Close())
+	code, body = do("POST", "/api/packages/testing/main?publish=true", "secret", mw.FormDataContentType(), mb.Bytes())
+	assert.Equal(t, http.StatusOK, code, "should upload with a form: %s", body)
+	assert.Equal(t, 1, published, "should publish")
+
+	fis, err := ioutil.ReadDir(filepath.Join(td, "stable", "main"))
+	assert.NoError(t, err)
+	assert.Len(t, fis, 1, "temp files should be removed")
+
+	code, body = do("GET", "/api/packages?dist=stable", "secret", "", nil)
+	assert.Equal(t, http.StatusOK, code)
+	var ps []APIPackage
+	assert.NoError(t, json.Unmarshal([]byte(body), &ps))
+	assert.Len(t, ps, 1)
+
+	code, _ = do("DELETE", "/api/packages/stable/main/foo/1.0", "secret", "", nil)
+	assert.Equal(t, http.StatusNotFound, code, "version should match exactly")
+
+	code, _ = do("DELETE", "/api/packages/stable/main/foo/1:1.0?arch=i386", "secret", "", nil)
+	assert.Equal(t, http.StatusNotFound, code, "arch should match")
+
+	code, body = do("DELETE", "/api/packages/stable/main/foo/1:1.0", "secret", "", nil)
+	assert.Equal(t, http.StatusOK, code, "should delete: %s", body)
+	assert.NoError(t, json.Unmarshal([]byte(body), &ps))
+	assert.Len(t, ps, 1)
+	assert.Equal(t, "stable/main/foo_1.0_amd64.deb", ps[0].Filename)
+
+	code, body = do("GET", "/api/packages", "secret", "", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NoError(t, json.Unmarshal([]byte(body), &ps))
+	assert.Len(t, ps, 1)
+	assert.Equal(t, "testing", ps[0].Dist)
+
+	code, _ = do("POST", "/api/publish", "secret", "", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, published, "should publish")
+
+	a.Publish = func() error {
+		return fmt.Errorf("test")
+	}
+	code, body = do("POST", "/api/publish", "secret", "", nil)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.JSONEq(t, `{"error": "could not publish: test"}`, body)
+
+	code, _ = do("PUT", "/api/publish", "secret", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+	code, _ = do("GET", "/api/nonexistent", "secret", "", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	a.MaxUploadSize = int64(len(deb) - 1)
+	code, body = do("POST", "/api/packages/stable/main", "secret", "", deb)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code, "should limit the upload size: %s", body)
+	code, body = do("POST", "/api/packages/testing/main", "secret", mw.FormDataContentType(), mb.Bytes())
+	assert.Equal(t, http.StatusRequestEntityTooLarge, code, "should limit the upload size with a form: %s", body)
+	a.MaxUploadSize = 0
+
+	var wg sync.WaitGroup
+	codes := make([]int, 8)
+	debs := make([][]byte, len(codes))
+	for i := range codes {
+		debs[i] = testDeb(t, fmt.Sprintf("Package: bar\nVersion: 1.0\nArchitecture: amd64\nDescription: %d\n", i))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i], _ = do("POST", "/api/packages/stable/main", "secret", "", debs[i])
+		}(i)
+	}
+	wg.Wait()
+	var uploaded []byte
+	for i, code := range codes {
+		if code == http.StatusOK {
+			assert.Nil(t, uploaded, "only one concurrent upload of the same package should succeed")
+			uploaded = debs[i]
+		} else {
+			assert.Equal(t, http.StatusConflict, code, "other concurrent uploads of the same package should conflict")
+		}
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(td, "stable", "main", "bar_1.0_amd64.deb"))
+	assert.NoError(t, err)
+	assert.Equal(t, uploaded, buf, "the successful upload shouldn't be replaced")
+}
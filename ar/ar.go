@@ -1,4 +1,6 @@
-package main
+// Package ar reads and writes ar archives (the container format used by deb
+// packages).
+package ar
 
 import (
 	"errors"
@@ -11,11 +13,11 @@ import (
 
 // Based on https://github.com/blakesmith/ar/blob/master/reader.go
 
-// Ar provides read access to an ar archive.
+// Reader provides read access to an ar archive.
 // Call next to skip files
 //
 // Example:
-//	reader, _ := NewAr(f)
+//	reader, _ := ar.NewReader(f)
 //	var buf bytes.Buffer
 //	for {
 //		_, err := reader.Next()
@@ -27,25 +29,25 @@ import (
 //		}
 //		io.Copy(&buf, reader)
 //	}
-type Ar struct {
+type Reader struct {
 	r   io.Reader
 	nb  int64
 	pad int64
 }
 
-// NewAr creates a new reader for an ar archive.
-func NewAr(r io.Reader) (*Ar, error) {
+// NewReader creates a new reader for an ar archive.
+func NewReader(r io.Reader) (*Reader, error) {
 	header := make([]byte, 8)
 	if _, err := r.Read(header); err != nil {
 		return nil, err
 	} else if string(header) != "!<arch>\n" {
 		return nil, errors.New("invalid ar header")
 	}
-	return &Ar{r: r}, nil
+	return &Reader{r: r}, nil
 }
 
 // Next skips to the next file in the archive file.
-func (rd *Ar) Next() (*Header, error) {
+func (rd *Reader) Next() (*Header, error) {
 	err := rd.skipUnread()
 	if err != nil {
 		return nil, err
@@ -54,7 +56,7 @@ func (rd *Ar) Next() (*Header, error) {
 }
 
 // Read reads data from the current file.
-func (rd *Ar) Read(b []byte) (n int, err error) {
+func (rd *Reader) Read(b []byte) (n int, err error) {
 	if rd.nb == 0 {
 		return 0, io.EOF
 	}
@@ -66,7 +68,7 @@ func (rd *Ar) Read(b []byte) (n int, err error) {
 	return
 }
 
-func (rd *Ar) string(b []byte) string {
+func (rd *Reader) string(b []byte) string {
 	i := len(b) - 1
 	for i > 0 && b[i] == 32 {
 		i--
@@ -74,7 +76,7 @@ func (rd *Ar) string(b []byte) string {
 	return string(b[0 : i+1])
 }
 
-func (rd *Ar) numeric(b []byte) int64 {
+func (rd *Reader) numeric(b []byte) int64 {
 	i := len(b) - 1
 	for i > 0 && b[i] == 32 {
 		i--
@@ -83,7 +85,7 @@ func (rd *Ar) numeric(b []byte) int64 {
 	return n
 }
 
-func (rd *Ar) octal(b []byte) int64 {
+func (rd *Reader) octal(b []byte) int64 {
 	i := len(b) - 1
 	for i > 0 && b[i] == 32 {
 		i--
@@ -92,7 +94,7 @@ func (rd *Ar) octal(b []byte) int64 {
 	return n
 }
 
-func (rd *Ar) skipUnread() error {
+func (rd *Reader) skipUnread() error {
 	skip := rd.nb + rd.pad
 	rd.nb, rd.pad = 0, 0
 	if seeker, ok := rd.r.(io.Seeker); ok {
@@ -103,7 +105,7 @@ func (rd *Ar) skipUnread() error {
 	return err
 }
 
-func (rd *Ar) readHeader() (*Header, error) {
+func (rd *Reader) readHeader() (*Header, error) {
 	headerBuf := make([]byte, HEADER_BYTE_SIZE)
 	if _, err := io.ReadFull(rd.r, headerBuf); err != nil {
 		return nil, err
@@ -0,0 +1,91 @@
+package ar
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Writer writes an ar archive in the common format used by deb packages. Call
+// WriteHeader to start a file, then Write its contents.
+//
+// Example:
+//
+//	writer, _ := ar.NewWriter(f)
+//	writer.WriteHeader(&ar.Header{Name: "debian-binary", Mode: 0100644, Size: 4})
+//	writer.Write([]byte("2.0\n"))
+//	writer.Close()
+type Writer struct {
+	w   io.Writer
+	nb  int64
+	pad bool
+}
+
+// NewWriter creates a new writer for an ar archive, and writes the global
+// header.
+func NewWriter(w io.Writer) (*Writer, error) {
+	if _, err := io.WriteString(w, GLOBAL_HEADER); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+// WriteHeader starts a new file. The previous file must have been completely
+// written. Names must be at most 16 characters, and can't contain spaces or
+// slashes.
+func (wr *Writer) WriteHeader(hdr *Header) error {
+	if err := wr.finish(); err != nil {
+		return err
+	}
+	if len(hdr.Name) == 0 || len(hdr.Name) > 16 {
+		return fmt.Errorf("invalid file name %#v", hdr.Name)
+	}
+	for _, c := range hdr.Name {
+		if c == ' ' || c == '/' {
+			return fmt.Errorf("invalid file name %#v", hdr.Name)
+		}
+	}
+	if hdr.Size < 0 {
+		return errors.New("invalid file size")
+	}
+
+	header := fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", hdr.Name, hdr.ModTime.Unix(), hdr.Uid, hdr.Gid, hdr.Mode, hdr.Size)
+	if len(header) != HEADER_BYTE_SIZE {
+		return errors.New("header field too long")
+	}
+	if _, err := io.WriteString(wr.w, header); err != nil {
+		return err
+	}
+	wr.nb, wr.pad = hdr.Size, hdr.Size%2 == 1
+	return nil
+}
+
+// Write writes data to the current file.
+func (wr *Writer) Write(b []byte) (int, error) {
+	if int64(len(b)) > wr.nb {
+		return 0, errors.New("write too long")
+	}
+	n, err := wr.w.Write(b)
+	wr.nb -= int64(n)
+	return n, err
+}
+
+// Close finishes the archive. The last file must have been completely
+// written. It does not close the underlying writer.
+func (wr *Writer) Close() error {
+	return wr.finish()
+}
+
+// finish pads the current file.
+func (wr *Writer) finish() error {
+	if wr.nb != 0 {
+		return errors.New("missing data for previous file")
+	}
+	if wr.pad {
+		wr.pad = false
+		if _, err := io.WriteString(wr.w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
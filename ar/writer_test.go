@@ -0,0 +1,86 @@
+package ar
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	files := []struct {
+		hdr  Header
+		data string
+	}{
+		{Header{Name: "debian-binary", ModTime: time.Unix(1700000000, 0), Mode: 0100644, Size: 4}, "2.0\n"},
+		{Header{Name: "odd", ModTime: time.Unix(1700000000, 0), Uid: 1000, Gid: 1000, Mode: 0100755, Size: 3}, "abc"},
+		{Header{Name: "sixteen-chars.xz", ModTime: time.Unix(1700000000, 0), Mode: 0100644, Size: 5}, "12345"},
+		{Header{Name: "empty", ModTime: time.Unix(1700000000, 0), Mode: 0100644}, ""},
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, f := range files {
+		hdr := f.hdr
+		assert.NoError(t, w.WriteHeader(&hdr))
+		_, err := w.Write([]byte(f.data))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, w.Close())
+	assert.Equal(t, 8+len(files)*HEADER_BYTE_SIZE+4+3+1+5+1, buf.Len(), "odd-length files should be padded")
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, f := range files {
+		hdr, err := r.Next()
+		if !assert.NoError(t, err) {
+			return
+		}
+		exp := f.hdr
+		exp.Mode &= 0777 // the reader only returns the permissions
+		assert.Equal(t, exp, *hdr)
+		data, err := ioutil.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, f.data, string(data), f.hdr.Name)
+	}
+	_, err = r.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestWriterInvalid(t *testing.T) {
+	for _, c := range []struct {
+		what string
+		hdr  Header
+	}{
+		{"an empty name", Header{Size: 1}},
+		{"a name longer than 16 characters", Header{Name: "seventeen-chars.x", Size: 1}},
+		{"a name with a space", Header{Name: "a b", Size: 1}},
+		{"a name with a slash", Header{Name: "a/b", Size: 1}},
+		{"a negative size", Header{Name: "a", Size: -1}},
+		{"a mode which is too long", Header{Name: "a", Mode: 0777777777, Size: 1}},
+	} {
+		w, err := NewWriter(ioutil.Discard)
+		if assert.NoError(t, err) {
+			assert.Error(t, w.WriteHeader(&c.hdr), "should fail with %s", c.what)
+		}
+	}
+
+	w, err := NewWriter(ioutil.Discard)
+	if assert.NoError(t, err) {
+		assert.NoError(t, w.WriteHeader(&Header{Name: "a", Size: 2}))
+		_, err = w.Write([]byte("abc"))
+		assert.Error(t, err, "should fail if too much data is written")
+		_, err = w.Write([]byte("a"))
+		assert.NoError(t, err)
+		assert.Error(t, w.WriteHeader(&Header{Name: "b"}), "should fail if the previous file is incomplete")
+		assert.Error(t, w.Close(), "should fail if the last file is incomplete")
+	}
+}
@@ -0,0 +1,592 @@
+// Package bundle exports signed, self-verifying archives of generated
+// repositories (e.g. to copy them to air-gapped systems), and imports them into
+// another input or output directory.
+//
+// A bundle is a tar archive. The first file is a clearsigned manifest with the
+// SHA256 of every other file, which are the selected dists, the pool files they
+// reference, and the public key. An incremental bundle leaves out the pool
+// files which haven't changed since the bundle it is based on.
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/repo"
+	"github.com/pgaskin/repogen/storage"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// ManifestName is the name of the manifest in a bundle.
+const ManifestName = "MANIFEST"
+
+// Manifest describes the contents of a bundle.
+type Manifest struct {
+	ID        string    // the SHA256 of the manifest, for referring to it as the base of an incremental bundle
+	Date      time.Time // when the bundle was exported
+	Dists     []string  // the exported dists
+	Base      string    // the ID of the bundle this one is relative to (empty if it isn't incremental)
+	Files     []File    // the files in the bundle
+	Unchanged []File    // the files left out of an incremental bundle, which must already have been imported
+}
+
+// File is a file in a Manifest.
+type File struct {
+	Name   string // slash-separated, relative to the root of the repository
+	SHA256 string
+	Size   int64
+}
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	Dists   []string        // the dists to export (the default is all of them)
+	Base    *Manifest       // the manifest of a previous bundle to make an incremental bundle relative to (optional)
+	SignKey *openpgp.Entity // the private key to sign the manifest with
+	Date    time.Time       // the time to use for the manifest and signature (the default is the current time)
+}
+
+// Export writes a bundle of the repository in src to w.
+func Export(ctx context.Context, w io.Writer, src storage.Storage, opts ExportOptions) (*Manifest, error) {
+	if opts.SignKey == nil || opts.SignKey.PrivateKey == nil {
+		return nil, errors.New("no signing key")
+	}
+
+	names, err := src.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error listing repository: %v", err)
+	}
+	sort.Strings(names)
+
+	exists := map[string]bool{}
+	dists := map[string]bool{}
+	for _, name := range names {
+		exists[name] = true
+		if spl := strings.Split(name, "/"); len(spl) > 2 && spl[0] == "dists" {
+			dists[spl[1]] = true
+		}
+	}
+
+	m := &Manifest{
+		Date:  opts.Date,
+		Dists: opts.Dists,
+	}
+	if m.Date.IsZero() {
+		m.Date = time.Now()
+	}
+	m.Date = m.Date.UTC().Truncate(time.Second)
+	if len(m.Dists) == 0 {
+		for dist := range dists {
+			m.Dists = append(m.Dists, dist)
+		}
+	}
+	sort.Strings(m.Dists)
+	for _, dist := range m.Dists {
+		if !dists[dist] {
+			return nil, fmt.Errorf("no such dist %#v in repository", dist)
+		}
+	}
+	if len(m.Dists) == 0 {
+		return nil, errors.New("no dists in repository")
+	}
+	if !exists["key.asc"] {
+		return nil, errors.New("no public key (key.asc) in repository")
+	}
+
+	include := map[string]bool{"key.asc": true}
+	for _, name := range names {
+		for _, dist := range m.Dists {
+			if !strings.HasPrefix(name, "dists/"+dist+"/") {
+				continue
+			}
+			include[name] = true
+			if path.Base(name) != "Packages" || !strings.HasPrefix(path.Base(path.Dir(name)), "binary-") {
+				continue
+			}
+			buf, err := src.Get(ctx, name)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %v", name, err)
+			}
+			cs, err := control.ParseAll(string(buf))
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s: %v", name, err)
+			}
+			for _, c := range cs {
+				fn := c.MightGet("Filename")
+				if !exists[fn] {
+					return nil, fmt.Errorf("missing pool file %#v referenced by %s", fn, name)
+				}
+				include[fn] = true
+			}
+		}
+	}
+
+	base := map[string]string{}
+	if opts.Base != nil {
+		m.Base = opts.Base.ID
+		for _, fs := range [][]File{opts.Base.Files, opts.Base.Unchanged} {
+			for _, f := range fs {
+				base[f.Name] = f.SHA256
+			}
+		}
+	}
+
+	for _, name := range names {
+		if !include[name] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		buf, err := src.Get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", name, err)
+		}
+		f := File{name, fmt.Sprintf("%x", sha256.Sum256(buf)), int64(len(buf))}
+		if strings.HasPrefix(name, "pool/") && base[name] == f.SHA256 {
+			m.Unchanged = append(m.Unchanged, f)
+		} else {
+			m.Files = append(m.Files, f)
+		}
+	}
+
+	mbuf := []byte(m.String())
+	m.ID = m.sum()
+
+	sbuf := new(bytes.Buffer)
+	sw, err := clearsign.Encode(sbuf, opts.SignKey.PrivateKey, &packet.Config{
+		Time: func() time.Time { return m.Date },
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error signing manifest: %v", err)
+	}
+	if _, err := sw.Write(mbuf); err != nil {
+		return nil, fmt.Errorf("error signing manifest: %v", err)
+	}
+	if err := sw.Close(); err != nil {
+		return nil, fmt.Errorf("error signing manifest: %v", err)
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeTar(tw, ManifestName, sbuf.Bytes(), m.Date); err != nil {
+		return nil, fmt.Errorf("error writing manifest: %v", err)
+	}
+	for _, f := range m.Files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		buf, err := src.Get(ctx, f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", f.Name, err)
+		}
+		if fmt.Sprintf("%x", sha256.Sum256(buf)) != f.SHA256 {
+			return nil, fmt.Errorf("%s changed during export", f.Name)
+		}
+		if err := writeTar(tw, f.Name, buf, m.Date); err != nil {
+			return nil, fmt.Errorf("error writing %s: %v", f.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("error writing bundle: %v", err)
+	}
+	return m, nil
+}
+
+// writeTar writes a file to a bundle.
+func writeTar(tw *tar.Writer, name string, data []byte, date time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  date,
+		Format:   tar.FormatPAX,
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// ReadManifest reads the manifest of a bundle, verifying it against keyring,
+// without reading the rest of it.
+func ReadManifest(r io.Reader, keyring openpgp.KeyRing) (*Manifest, error) {
+	return readManifest(tar.NewReader(r), keyring)
+}
+
+// readManifest reads and verifies the manifest from the start of a bundle.
+func readManifest(tr *tar.Reader, keyring openpgp.KeyRing) (*Manifest, error) {
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("error reading bundle: %v", err)
+	}
+	if hdr.Name != ManifestName {
+		return nil, fmt.Errorf("expected %s at the start of the bundle, got %#v", ManifestName, hdr.Name)
+	}
+	buf, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest: %v", err)
+	}
+
+	b, _ := clearsign.Decode(buf)
+	if b == nil {
+		return nil, errors.New("manifest is not signed")
+	}
+	if _, err := openpgp.CheckDetachedSignature(keyring, bytes.NewReader(b.Bytes), b.ArmoredSignature.Body); err != nil {
+		return nil, fmt.Errorf("error verifying manifest signature: %v", err)
+	}
+
+	m, err := ParseManifest(b.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %v", err)
+	}
+	return m, nil
+}
+
+// Extract reads a bundle, verifying the manifest against keyring and the
+// checksum of every file, and extracts the files into dir.
+func Extract(r io.Reader, keyring openpgp.KeyRing, dir string) (*Manifest, error) {
+	tr := tar.NewReader(r)
+	m, err := readManifest(tr, keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]File{}
+	for _, f := range m.Files {
+		files[f.Name] = f
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading bundle: %v", err)
+		}
+		f, ok := files[hdr.Name]
+		if !ok {
+			return nil, fmt.Errorf("unexpected file %#v in bundle", hdr.Name)
+		}
+		delete(files, hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || hdr.Size != f.Size {
+			return nil, fmt.Errorf("%s does not match the manifest", f.Name)
+		}
+		if err := extractFile(filepath.Join(dir, filepath.FromSlash(f.Name)), tr, f.SHA256); err != nil {
+			return nil, fmt.Errorf("error extracting %s: %v", f.Name, err)
+		}
+	}
+	for _, f := range m.Files {
+		if _, ok := files[f.Name]; ok {
+			return nil, fmt.Errorf("%s is missing from the bundle", f.Name)
+		}
+	}
+	return m, nil
+}
+
+// extractFile atomically writes r to fn, checking its SHA256. If it doesn't
+// match, fn is left as-is.
+func extractFile(fn string, r io.Reader, sum string) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	tf, err := ioutil.TempFile(filepath.Dir(fn), ".extract-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tf, h), r); err != nil {
+		return err
+	}
+	if fmt.Sprintf("%x", h.Sum(nil)) != sum {
+		return errors.New("checksum mismatch")
+	}
+	if err := tf.Chmod(0644); err != nil {
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tf.Name(), fn)
+}
+
+// MergeOutput adds the files extracted from a bundle (see Extract) in dir to an
+// output directory. The packages are written first and the Release files last,
+// so the repository stays consistent for clients while it is being updated.
+func MergeOutput(ctx context.Context, m *Manifest, dir string, dst storage.Storage) error {
+	for _, f := range m.Unchanged {
+		buf, err := dst.Get(ctx, f.Name)
+		if err == nil && fmt.Sprintf("%x", sha256.Sum256(buf)) != f.SHA256 {
+			err = errors.New("checksum mismatch")
+		}
+		if err != nil {
+			return fmt.Errorf("error checking unchanged file %s from base bundle %s (it must be imported first): %v", f.Name, m.Base, err)
+		}
+	}
+
+	files := append([]File{}, m.Files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return mergeOrder(files[i].Name) < mergeOrder(files[j].Name)
+	})
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := dst.PutFile(ctx, f.Name, filepath.Join(dir, filepath.FromSlash(f.Name))); err != nil {
+			return fmt.Errorf("error writing %s: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// mergeOrder returns the order to write a file in when merging.
+func mergeOrder(name string) int {
+	switch {
+	case strings.HasPrefix(name, "pool/"):
+		return 0
+	case path.Base(name) == "Release" || path.Base(name) == "Release.gpg" || path.Base(name) == "InRelease":
+		return 2
+	default:
+		return 1
+	}
+}
+
+// MergeInput adds the packages extracted from a bundle (see Extract) in dir to
+// an input directory (IN/DIST/COMPONENT/*.deb). Existing packages with the same
+// file name are replaced. Unchanged packages which were imported into a
+// different dist or component by a previous bundle are copied from there.
+// Files are written to a hidden temporary file first, so a repogen watching the
+// input directory will only see complete packages.
+func MergeInput(ctx context.Context, m *Manifest, dir, inRoot string) error {
+	extracted := map[string]bool{}
+	for _, f := range m.Files {
+		extracted[f.Name] = true
+	}
+	unchanged := map[string]string{}
+	for _, f := range m.Unchanged {
+		unchanged[f.Name] = f.SHA256
+	}
+
+	type pkg struct{ pool, fn, src string }
+	var pkgs []pkg
+	seen := map[string]bool{}
+	for _, f := range m.Files {
+		spl := strings.Split(f.Name, "/")
+		if len(spl) != 5 || spl[0] != "dists" || !strings.HasPrefix(spl[3], "binary-") || spl[4] != "Packages" {
+			continue
+		}
+		if !repo.ValidName(spl[1]) || !repo.ValidName(spl[2]) {
+			return fmt.Errorf("invalid dist or component name in %s", f.Name)
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(f.Name)))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", f.Name, err)
+		}
+		cs, err := control.ParseAll(string(buf))
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %v", f.Name, err)
+		}
+		for _, c := range cs {
+			pool := c.MightGet("Filename")
+			base := path.Base(pool)
+			if !strings.HasSuffix(base, ".deb") || repo.IsHidden(base) {
+				return fmt.Errorf("invalid package file name %#v in %s", pool, f.Name)
+			}
+			fn := filepath.Join(inRoot, spl[1], spl[2], base)
+			if seen[fn] {
+				continue // e.g. Architecture: all
+			}
+			seen[fn] = true
+			pkgs = append(pkgs, pkg{pool, fn, ""})
+		}
+	}
+
+	for i, p := range pkgs {
+		if extracted[p.pool] {
+			pkgs[i].src = filepath.Join(dir, filepath.FromSlash(p.pool))
+			continue
+		}
+		sum, ok := unchanged[p.pool]
+		if !ok {
+			return fmt.Errorf("%s is missing from the bundle", p.pool)
+		}
+		src, err := findInput(inRoot, path.Base(p.pool), sum, p.fn)
+		if err != nil {
+			return fmt.Errorf("error checking unchanged package %s from base bundle %s (it must be imported first): %v", p.fn, m.Base, err)
+		}
+		if src != p.fn {
+			pkgs[i].src = src
+		}
+	}
+
+	for _, p := range pkgs {
+		if p.src == "" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := copyInput(p.fn, p.src); err != nil {
+			return fmt.Errorf("error writing %s: %v", p.fn, err)
+		}
+	}
+	return nil
+}
+
+// findInput finds an imported package with the specified checksum, preferring fn
+// over a package with the same name in another dist or component.
+func findInput(inRoot, name, sum, fn string) (string, error) {
+	check := func(fn string) error {
+		buf, err := ioutil.ReadFile(fn)
+		if err == nil && fmt.Sprintf("%x", sha256.Sum256(buf)) != sum {
+			err = errors.New("checksum mismatch")
+		}
+		return err
+	}
+	ferr := check(fn)
+	if ferr == nil {
+		return fn, nil
+	}
+	dfis, _ := ioutil.ReadDir(inRoot)
+	for _, dfi := range dfis {
+		if !dfi.IsDir() || repo.IsHidden(dfi.Name()) {
+			continue
+		}
+		cfis, _ := ioutil.ReadDir(filepath.Join(inRoot, dfi.Name()))
+		for _, cfi := range cfis {
+			if !cfi.IsDir() || repo.IsHidden(cfi.Name()) {
+				continue
+			}
+			if other := filepath.Join(inRoot, dfi.Name(), cfi.Name(), name); other != fn && check(other) == nil {
+				return other, nil
+			}
+		}
+	}
+	return "", ferr
+}
+
+// copyInput atomically copies src to fn.
+func copyInput(fn, src string) error {
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return err
+	}
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	tf, err := ioutil.TempFile(filepath.Dir(fn), ".import-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+
+	if _, err := io.Copy(tf, sf); err != nil {
+		return err
+	}
+	if err := tf.Chmod(0644); err != nil {
+		return err
+	}
+	if err := tf.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tf.Name(), fn)
+}
+
+// ParseManifest parses a manifest. The file names are checked to be valid.
+func ParseManifest(buf []byte) (*Manifest, error) {
+	c, err := control.Parse(string(buf))
+	if err != nil {
+		return nil, err
+	}
+	if v := c.MightGet("Format"); v != "1" {
+		return nil, fmt.Errorf("unsupported format %#v", v)
+	}
+
+	m := &Manifest{
+		Dists: strings.Fields(c.MightGet("Dists")),
+		Base:  c.MightGet("Base"),
+	}
+	if m.Date, err = time.Parse(time.RFC1123, c.MightGet("Date")); err != nil {
+		return nil, fmt.Errorf("invalid date: %v", err)
+	}
+	for _, f := range []struct {
+		field string
+		files *[]File
+	}{
+		{"SHA256", &m.Files},
+		{"SHA256-Unchanged", &m.Unchanged},
+	} {
+		for _, line := range strings.Split(c.MightGet(f.field), "\n") {
+			spl := strings.Fields(line)
+			if len(spl) == 0 {
+				continue
+			}
+			if len(spl) != 3 {
+				return nil, fmt.Errorf("invalid %s line %#v", f.field, line)
+			}
+			size, err := strconv.ParseInt(spl[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s line %#v: %v", f.field, line, err)
+			}
+			if name := path.Clean(spl[2]); name != spl[2] || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") || name == ManifestName {
+				return nil, fmt.Errorf("invalid file name %#v", spl[2])
+			}
+			*f.files = append(*f.files, File{spl[2], spl[0], size})
+		}
+	}
+	m.ID = m.sum()
+	return m, nil
+}
+
+// sum returns the SHA256 of the encoded manifest.
+func (m *Manifest) sum() string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(m.String())))
+}
+
+// String encodes the manifest.
+func (m *Manifest) String() string {
+	c := control.New()
+	c.Set("Format", "1")
+	c.Set("Date", m.Date.UTC().Format(time.RFC1123))
+	c.Set("Dists", strings.Join(m.Dists, " "))
+	if m.Base != "" {
+		c.Set("Base", m.Base)
+	}
+	for _, f := range []struct {
+		field string
+		files []File
+	}{
+		{"SHA256", m.Files},
+		{"SHA256-Unchanged", m.Unchanged},
+	} {
+		if len(f.files) == 0 {
+			continue
+		}
+		var lines []string
+		for _, f := range f.files {
+			lines = append(lines, fmt.Sprintf("%s %16d %s", f.SHA256, f.Size, f.Name))
+		}
+		c.Set(f.field, "\n"+strings.Join(lines, "\n"))
+	}
+	return c.String()
+}
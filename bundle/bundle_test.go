@@ -0,0 +1,273 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/repogen/storage"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestBundle(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-bundle")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	e, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	ctx := context.Background()
+	src := storage.NewLocal(filepath.Join(td, "src"))
+	for name, data := range map[string]string{
+		"key.asc":                "key",
+		"dists/stable/InRelease": "release 1",
+		"dists/stable/main/binary-amd64/Packages":  "Package: foo\nFilename: pool/main/f/foo/foo_1.0_amd64.deb\n\nPackage: bar\nFilename: pool/main/b/bar/bar_1.0_all.deb\n",
+		"dists/stable/main/binary-i386/Packages":   "Package: bar\nFilename: pool/main/b/bar/bar_1.0_all.deb\n",
+		"dists/testing/InRelease":                  "release",
+		"dists/testing/main/binary-amd64/Packages": "Package: baz\nFilename: pool/main/b/baz/baz_1.0_amd64.deb\n",
+		"pool/main/f/foo/foo_1.0_amd64.deb":        "foo 1.0",
+		"pool/main/b/bar/bar_1.0_all.deb":          "bar 1.0",
+		"pool/main/b/baz/baz_1.0_amd64.deb":        "baz 1.0",
+		"index.html":                               "web",
+	} {
+		assert.NoError(t, src.Put(ctx, name, []byte(data)))
+	}
+
+	export := func(base *Manifest) (*Manifest, []byte) {
+		buf := new(bytes.Buffer)
+		m, err := Export(ctx, buf, src, ExportOptions{
+			Dists:   []string{"stable"},
+			Base:    base,
+			SignKey: e,
+			Date:    time.Unix(1700000000, 0),
+		})
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return m, buf.Bytes()
+	}
+
+	m1, b1 := export(nil)
+	assert.Equal(t, []string{"stable"}, m1.Dists)
+	assert.Empty(t, m1.Unchanged)
+	var names []string
+	for _, f := range m1.Files {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{
+		"dists/stable/InRelease",
+		"dists/stable/main/binary-amd64/Packages",
+		"dists/stable/main/binary-i386/Packages",
+		"key.asc",
+		"pool/main/b/bar/bar_1.0_all.deb",
+		"pool/main/f/foo/foo_1.0_amd64.deb",
+	}, names, "only the selected dists and the files they reference should be exported")
+
+	rm, err := ReadManifest(bytes.NewReader(b1), openpgp.EntityList{e})
+	if assert.NoError(t, err) {
+		assert.Equal(t, m1, rm, "the manifest should round-trip")
+	}
+	_, err = ReadManifest(bytes.NewReader(b1), openpgp.EntityList{other})
+	assert.Error(t, err, "the signature should be checked")
+
+	assert.NoError(t, src.Put(ctx, "pool/main/f/foo/foo_1.1_amd64.deb", []byte("foo 1.1")))
+	assert.NoError(t, src.Put(ctx, "dists/stable/main/binary-amd64/Packages", []byte("Package: foo\nFilename: pool/main/f/foo/foo_1.1_amd64.deb\n\nPackage: bar\nFilename: pool/main/b/bar/bar_1.0_all.deb\n")))
+	assert.NoError(t, src.Put(ctx, "dists/stable/InRelease", []byte("release 2")))
+
+	m2, b2 := export(m1)
+	assert.Equal(t, m1.ID, m2.Base)
+	if assert.Len(t, m2.Unchanged, 1) {
+		assert.Equal(t, "pool/main/b/bar/bar_1.0_all.deb", m2.Unchanged[0].Name, "unchanged pool files should be left out")
+	}
+
+	extract := func(b []byte) (*Manifest, string) {
+		dir, err := ioutil.TempDir(td, "extract")
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		m, err := Extract(bytes.NewReader(b), openpgp.EntityList{e}, dir)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return m, dir
+	}
+
+	// output
+	dst := storage.NewLocal(filepath.Join(td, "out"))
+	m, dir := extract(b2)
+	assert.Error(t, MergeOutput(ctx, m, dir, dst), "the base bundle must be imported first")
+	m, dir = extract(b1)
+	assert.NoError(t, MergeOutput(ctx, m, dir, dst))
+	m, dir = extract(b2)
+	assert.NoError(t, MergeOutput(ctx, m, dir, dst))
+	for _, name := range []string{"dists/stable/InRelease", "pool/main/f/foo/foo_1.1_amd64.deb", "pool/main/b/bar/bar_1.0_all.deb"} {
+		buf, err := dst.Get(ctx, name)
+		if assert.NoError(t, err, name) {
+			exp, _ := src.Get(ctx, name)
+			assert.Equal(t, string(exp), string(buf), name)
+		}
+	}
+
+	// input
+	in := filepath.Join(td, "in")
+	m, dir = extract(b1)
+	assert.NoError(t, MergeInput(ctx, m, dir, in))
+	m, dir = extract(b2)
+	assert.NoError(t, MergeInput(ctx, m, dir, in))
+	for fn, exp := range map[string]string{
+		"stable/main/foo_1.0_amd64.deb": "foo 1.0",
+		"stable/main/foo_1.1_amd64.deb": "foo 1.1",
+		"stable/main/bar_1.0_all.deb":   "bar 1.0",
+	} {
+		buf, err := ioutil.ReadFile(filepath.Join(in, filepath.FromSlash(fn)))
+		if assert.NoError(t, err, fn) {
+			assert.Equal(t, exp, string(buf), fn)
+		}
+	}
+	fis, _ := ioutil.ReadDir(filepath.Join(in, "stable", "main"))
+	assert.Len(t, fis, 3, "there shouldn't be any leftover temp files")
+
+	// a second incremental bundle, with an unchanged package moved to another component
+	assert.NoError(t, src.Put(ctx, "dists/stable/main/binary-amd64/Packages", []byte("Package: foo\nFilename: pool/main/f/foo/foo_1.1_amd64.deb\n")))
+	assert.NoError(t, src.Delete(ctx, "dists/stable/main/binary-i386/Packages"))
+	assert.NoError(t, src.Put(ctx, "dists/stable/contrib/binary-amd64/Packages", []byte("Package: bar\nFilename: pool/main/b/bar/bar_1.0_all.deb\n")))
+	assert.NoError(t, src.Put(ctx, "dists/stable/InRelease", []byte("release 3")))
+
+	m3, b3 := export(m2)
+	assert.Equal(t, m2.ID, m3.Base)
+	assert.Len(t, m3.Unchanged, 2, "files unchanged since the base of the base bundle should be left out too")
+	m, dir = extract(b3)
+	assert.NoError(t, MergeInput(ctx, m, dir, in))
+	buf, err := ioutil.ReadFile(filepath.Join(in, "stable", "contrib", "bar_1.0_all.deb"))
+	if assert.NoError(t, err, "unchanged packages should be copied from the component they were imported into") {
+		assert.Equal(t, "bar 1.0", string(buf))
+	}
+	m, dir = extract(b3)
+	assert.NoError(t, MergeInput(ctx, m, dir, in), "importing a bundle again should work")
+
+	for _, comp := range []string{"main", "contrib"} {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(in, "stable", comp, "bar_1.0_all.deb"), []byte("modified"), 0644))
+	}
+	m, dir = extract(b2)
+	assert.Error(t, MergeInput(ctx, m, dir, in), "unchanged packages should be checked")
+}
+
+func TestExtractTampered(t *testing.T) {
+	e, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+
+	td, err := ioutil.TempDir("", "repogen-bundle")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	ctx := context.Background()
+	src := storage.NewLocal(filepath.Join(td, "src"))
+	assert.NoError(t, src.Put(ctx, "key.asc", []byte("key")))
+	assert.NoError(t, src.Put(ctx, "dists/stable/InRelease", []byte("release")))
+
+	buf := new(bytes.Buffer)
+	_, err = Export(ctx, buf, src, ExportOptions{SignKey: e})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// rewrite the bundle, modifying files
+	rewrite := func(fn func(hdr *tar.Header, data []byte) []byte) []byte {
+		out := new(bytes.Buffer)
+		tr, tw := tar.NewReader(bytes.NewReader(buf.Bytes())), tar.NewWriter(out)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			assert.NoError(t, err)
+			data, _ := ioutil.ReadAll(tr)
+			if data = fn(hdr, data); data == nil {
+				continue
+			}
+			hdr.Size = int64(len(data))
+			assert.NoError(t, tw.WriteHeader(hdr))
+			_, err = tw.Write(data)
+			assert.NoError(t, err)
+		}
+		assert.NoError(t, tw.Close())
+		return out.Bytes()
+	}
+
+	for _, c := range []struct {
+		what string
+		fn   func(hdr *tar.Header, data []byte) []byte
+	}{
+		{"a modified manifest", func(hdr *tar.Header, data []byte) []byte {
+			if hdr.Name == ManifestName {
+				return bytes.Replace(data, []byte("Dists: stable"), []byte("Dists: other"), 1)
+			}
+			return data
+		}},
+		{"a modified file", func(hdr *tar.Header, data []byte) []byte {
+			if hdr.Name == "key.asc" {
+				return []byte("abc")
+			}
+			return data
+		}},
+		{"a missing file", func(hdr *tar.Header, data []byte) []byte {
+			if hdr.Name == "key.asc" {
+				return nil
+			}
+			return data
+		}},
+		{"an extra file", func(hdr *tar.Header, data []byte) []byte {
+			if hdr.Name == "key.asc" {
+				hdr.Name = "other.asc"
+			}
+			return data
+		}},
+	} {
+		_, err := Extract(bytes.NewReader(rewrite(c.fn)), openpgp.EntityList{e}, filepath.Join(td, "out"))
+		assert.Error(t, err, "should fail with %s", c.what)
+	}
+
+	_, err = Extract(bytes.NewReader(rewrite(func(hdr *tar.Header, data []byte) []byte { return data })), openpgp.EntityList{e}, filepath.Join(td, "out"))
+	assert.NoError(t, err, "the unmodified bundle should be extracted")
+
+	// corrupt a member without changing its size
+	corrupt := rewrite(func(hdr *tar.Header, data []byte) []byte {
+		if hdr.Name == "dists/stable/InRelease" {
+			return []byte("corrupt")
+		}
+		return data
+	})
+	_, err = Extract(bytes.NewReader(corrupt), openpgp.EntityList{e}, filepath.Join(td, "out"))
+	assert.EqualError(t, err, "error extracting dists/stable/InRelease: checksum mismatch")
+	rel, err := ioutil.ReadFile(filepath.Join(td, "out", "dists", "stable", "InRelease"))
+	assert.NoError(t, err)
+	assert.Equal(t, "release", string(rel), "the existing file should be left as-is")
+	fis, _ := ioutil.ReadDir(filepath.Join(td, "out", "dists", "stable"))
+	assert.Len(t, fis, 1, "there shouldn't be any leftover temp files")
+
+	os.RemoveAll(filepath.Join(td, "out"))
+	_, err = Extract(bytes.NewReader(corrupt), openpgp.EntityList{e}, filepath.Join(td, "out"))
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(td, "out", "dists", "stable", "InRelease"))
+	assert.True(t, os.IsNotExist(err), "corrupted files shouldn't be extracted")
+}
@@ -1,7 +1,9 @@
-package main
+// Package control parses and encodes Debian control files.
+package control
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"unicode"
 )
@@ -12,16 +14,16 @@ type Control struct {
 	Order  []string
 }
 
-// NewControl returns an empty Debian control file.
-func NewControl() *Control {
+// New returns an empty Debian control file.
+func New() *Control {
 	return &Control{
 		Values: map[string]string{},
 		Order:  []string{},
 	}
 }
 
-// NewControlFromString parses a Debian control file.
-func NewControlFromString(in string) (*Control, error) {
+// Parse parses a Debian control file.
+func Parse(in string) (*Control, error) {
 	c := Control{
 		Values: map[string]string{},
 		Order:  []string{},
@@ -81,14 +83,52 @@ func NewControlFromString(in string) (*Control, error) {
 	return &c, nil
 }
 
-// String encodes to the Debian control format.
+// ParseAll parses multiple Debian control blocks separated by blank lines,
+// such as a Packages index.
+func ParseAll(in string) ([]*Control, error) {
+	var cs []*Control
+	var block []string
+	var start int
+	lines := strings.Split(strings.Replace(in, "\r\n", "\n", -1)+"\n", "\n")
+	for n, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			if len(block) == 0 {
+				start = n
+			}
+			block = append(block, line)
+			continue
+		}
+		if len(block) == 0 {
+			continue
+		}
+		c, err := Parse(strings.Join(block, "\n"))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing control block at line %d: %v", start+1, err)
+		}
+		cs = append(cs, c)
+		block = block[:0]
+	}
+	return cs, nil
+}
+
+// String encodes to the Debian control format. Values which aren't in Order
+// are written last, sorted by key.
 func (c *Control) String() string {
-	if len(c.Values) != len(c.Order) {
-		panic("control values length differs from order")
+	keys := append([]string{}, c.Order...)
+	var extra []string
+	for key := range c.Values {
+		if !inSlice(keys, key) {
+			extra = append(extra, key)
+		}
 	}
+	sort.Strings(extra)
+	keys = append(keys, extra...)
 
 	var b = new(strings.Builder)
-	for _, key := range c.Order {
+	for _, key := range keys {
+		if _, ok := c.Values[key]; !ok {
+			continue
+		}
 		val := c.Values[key]
 		val = strings.Replace(val, "\n", "\n ", -1)       // line continuations
 		val = strings.Replace(val, "\n \n", "\n .\n", -1) // blank line placeholder
@@ -104,15 +144,6 @@ func (c *Control) Get(key string) (string, bool) {
 	return val, ok
 }
 
-// MustGet gets the value of a control variable or panics if it doesn't exist.
-func (c *Control) MustGet(key string) string {
-	val, ok := c.Values[key]
-	if !ok {
-		panic("no such key " + key)
-	}
-	return val
-}
-
 // MightGet gets the value of a control variable or returns an empty string.
 func (c *Control) MightGet(key string) string {
 	val, _ := c.Values[key]
@@ -131,6 +162,17 @@ func (c *Control) Set(key, value string) {
 	return
 }
 
+// Delete removes a control variable.
+func (c *Control) Delete(key string) {
+	delete(c.Values, key)
+	for i, okey := range c.Order {
+		if okey == key {
+			c.Order = append(c.Order[:i], c.Order[i+1:]...)
+			return
+		}
+	}
+}
+
 // MoveToOrderStart moves a key to the start of the control block.
 func (c *Control) MoveToOrderStart(key string) bool {
 	for i, okey := range c.Order {
@@ -154,3 +196,12 @@ func (c *Control) Clone() *Control {
 	copy(nc.Order, c.Order)
 	return nc
 }
+
+func inSlice(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
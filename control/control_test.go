@@ -1,4 +1,4 @@
-package main
+package control
 
 import (
 	"testing"
@@ -35,7 +35,7 @@ Description: lightweight ncurses audio player
 `
 
 func TestControl(t *testing.T) {
-	c, err := NewControlFromString(cmus)
+	c, err := Parse(cmus)
 	assert.NoError(t, err, "should not error when parsing")
 	assert.NotNil(t, c, "result should not be nil")
 
@@ -84,4 +84,11 @@ It currently supports different input formats:
 	assert.Equal(t, []string{
 		"Test", "Package", "Version", "Architecture", "Maintainer", "Installed-Size", "Depends", "Recommends", "Suggests", "Section", "Priority", "Homepage", "Description",
 	}, c.Order, "order should be correct")
+
+	c.Delete("Test")
+	_, ok := c.Get("Test")
+	assert.False(t, ok, "should delete values")
+	assert.Equal(t, []string{
+		"Package", "Version", "Architecture", "Maintainer", "Installed-Size", "Depends", "Recommends", "Suggests", "Section", "Priority", "Homepage", "Description",
+	}, c.Order, "should remove deleted values from the order")
 }
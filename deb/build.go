@@ -0,0 +1,290 @@
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pgaskin/repogen/ar"
+	"github.com/pgaskin/repogen/control"
+	"github.com/ulikunitz/xz"
+)
+
+// BuildFile is a file in the data archive of a deb being built.
+type BuildFile struct {
+	Name     string      // the path without the leading slash
+	Mode     os.FileMode // the permissions and type (a regular file, os.ModeDir, or os.ModeSymlink)
+	Data     []byte      // the contents of a regular file
+	Linkname string      // the target of a symlink
+	Conffile bool        // whether the file is a conffile (it must be in etc/)
+}
+
+// BuildOptions configures Build.
+type BuildOptions struct {
+	Control      *control.Control  // the control file (Installed-Size is calculated if it isn't set)
+	Files        []*BuildFile      // the data files (missing parent dirs are added)
+	ControlFiles map[string][]byte // additional files for the control archive (e.g. postinst), which are executable if they are maintainer scripts
+	Compression  string            // the compression for the archives: gzip, xz (the default), zstd, or none
+	Date         time.Time         // the modification time of the files (the default is the current time)
+}
+
+var compressors = map[string]struct {
+	ext string
+	new func(io.Writer) (io.WriteCloser, error)
+}{
+	"none": {"", func(w io.Writer) (io.WriteCloser, error) {
+		return nopWriteCloser{w}, nil
+	}},
+	"gzip": {".gz", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriterLevel(w, gzip.BestCompression)
+	}},
+	"xz": {".xz", func(w io.Writer) (io.WriteCloser, error) {
+		return xz.NewWriter(w)
+	}},
+	"zstd": {".zst", func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+	}},
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// maintainerScripts are the control files which are executable.
+var maintainerScripts = []string{"preinst", "postinst", "prerm", "postrm", "config"}
+
+// Build writes a deb package. The md5sums and conffiles control files are
+// generated, and the files are sorted and owned by root, so the same options
+// always produce the same package.
+func Build(w io.Writer, opts BuildOptions) error {
+	if opts.Control == nil {
+		return errors.New("no control")
+	}
+	for _, key := range []string{"Package", "Version", "Architecture"} {
+		if opts.Control.MightGet(key) == "" {
+			return fmt.Errorf("no %s field in control", key)
+		}
+	}
+
+	comp := opts.Compression
+	if comp == "" {
+		comp = "xz"
+	}
+	compressor, ok := compressors[comp]
+	if !ok {
+		return fmt.Errorf("unsupported compression %#v", opts.Compression)
+	}
+
+	date := opts.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	date = date.UTC().Truncate(time.Second)
+
+	files := map[string]*BuildFile{}
+	for _, f := range opts.Files {
+		name := path.Clean(strings.TrimPrefix(f.Name, "/"))
+		if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("invalid file name %#v", f.Name)
+		}
+		if _, ok := files[name]; ok {
+			return fmt.Errorf("duplicate file %#v", name)
+		}
+		if f.Conffile && (!f.Mode.IsRegular() || !strings.HasPrefix(name, "etc/")) {
+			return fmt.Errorf("conffile %#v must be a regular file in etc/", name)
+		}
+		files[name] = f
+	}
+	for name := range files {
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if f, ok := files[dir]; !ok {
+				files[dir] = &BuildFile{Name: dir, Mode: os.ModeDir | 0755}
+			} else if !f.Mode.IsDir() {
+				return fmt.Errorf("parent %#v of %#v is not a dir", dir, name)
+			}
+		}
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var installedSize int64
+	md5sums := new(bytes.Buffer)
+	conffiles := new(bytes.Buffer)
+	data, err := buildTar(compressor.new, date, func(tw *tar.Writer) error {
+		if err := tw.WriteHeader(buildHeader("./", tar.TypeDir, 0755, 0, "", date)); err != nil {
+			return err
+		}
+		for _, name := range names {
+			f := files[name]
+			var err error
+			switch {
+			case f.Mode.IsDir():
+				installedSize++
+				err = tw.WriteHeader(buildHeader("./"+name+"/", tar.TypeDir, f.Mode, 0, "", date))
+			case f.Mode&os.ModeSymlink != 0:
+				installedSize++
+				err = tw.WriteHeader(buildHeader("./"+name, tar.TypeSymlink, f.Mode, 0, f.Linkname, date))
+			case f.Mode.IsRegular():
+				installedSize += (int64(len(f.Data)) + 1023) / 1024
+				if f.Conffile {
+					fmt.Fprintf(conffiles, "/%s\n", name)
+				} else {
+					fmt.Fprintf(md5sums, "%x  %s\n", md5.Sum(f.Data), name)
+				}
+				if err = tw.WriteHeader(buildHeader("./"+name, tar.TypeReg, f.Mode, int64(len(f.Data)), "", date)); err == nil {
+					_, err = tw.Write(f.Data)
+				}
+			default:
+				err = fmt.Errorf("unsupported file type %s", f.Mode.Type())
+			}
+			if err != nil {
+				return fmt.Errorf("error writing %s: %v", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error building data archive: %v", err)
+	}
+
+	ctrl := opts.Control.Clone()
+	if _, ok := ctrl.Get("Installed-Size"); !ok {
+		ctrl.Set("Installed-Size", strconv.FormatInt(installedSize, 10))
+	}
+
+	cfiles := map[string][]byte{
+		"control": []byte(ctrl.String()),
+	}
+	if md5sums.Len() != 0 {
+		cfiles["md5sums"] = md5sums.Bytes()
+	}
+	if conffiles.Len() != 0 {
+		cfiles["conffiles"] = conffiles.Bytes()
+	}
+	for name, buf := range opts.ControlFiles {
+		if strings.Contains(name, "/") || name == "." || name == ".." {
+			return fmt.Errorf("invalid control file name %#v", name)
+		}
+		if name == "control" || name == "md5sums" || name == "conffiles" {
+			return fmt.Errorf("control file %#v is generated", name)
+		}
+		cfiles[name] = buf
+	}
+	cnames := make([]string, 0, len(cfiles))
+	for name := range cfiles {
+		cnames = append(cnames, name)
+	}
+	sort.Strings(cnames)
+
+	ctl, err := buildTar(compressor.new, date, func(tw *tar.Writer) error {
+		if err := tw.WriteHeader(buildHeader("./", tar.TypeDir, 0755, 0, "", date)); err != nil {
+			return err
+		}
+		for _, name := range cnames {
+			var mode os.FileMode = 0644
+			for _, s := range maintainerScripts {
+				if name == s {
+					mode = 0755
+				}
+			}
+			if err := tw.WriteHeader(buildHeader("./"+name, tar.TypeReg, mode, int64(len(cfiles[name])), "", date)); err != nil {
+				return fmt.Errorf("error writing %s: %v", name, err)
+			}
+			if _, err := tw.Write(cfiles[name]); err != nil {
+				return fmt.Errorf("error writing %s: %v", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error building control archive: %v", err)
+	}
+
+	aw, err := ar.NewWriter(w)
+	if err != nil {
+		return fmt.Errorf("error writing ar archive: %v", err)
+	}
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar" + compressor.ext, ctl},
+		{"data.tar" + compressor.ext, data},
+	} {
+		if err := aw.WriteHeader(&ar.Header{
+			Name:    m.name,
+			ModTime: date,
+			Mode:    0100644,
+			Size:    int64(len(m.data)),
+		}); err != nil {
+			return fmt.Errorf("error writing ar archive: %v", err)
+		}
+		if _, err := aw.Write(m.data); err != nil {
+			return fmt.Errorf("error writing ar archive: %v", err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		return fmt.Errorf("error writing ar archive: %v", err)
+	}
+	return nil
+}
+
+// buildTar builds a compressed tar archive.
+func buildTar(compress func(io.Writer) (io.WriteCloser, error), date time.Time, fn func(tw *tar.Writer) error) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	cw, err := compress(buf)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(cw)
+	if err := fn(tw); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := cw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// buildHeader returns a tar header for a file owned by root.
+func buildHeader(name string, typ byte, mode os.FileMode, size int64, linkname string, date time.Time) *tar.Header {
+	perm := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return &tar.Header{
+		Typeflag: typ,
+		Name:     name,
+		Linkname: linkname,
+		Size:     size,
+		Mode:     perm,
+		Uname:    "root",
+		Gname:    "root",
+		ModTime:  date,
+		Format:   tar.FormatGNU,
+	}
+}
@@ -0,0 +1,83 @@
+package deb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuild(t *testing.T) {
+	ctrl, err := control.Parse("Package: foo\nVersion: 1.0\nArchitecture: all\nDescription: test\n")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	changelog := new(bytes.Buffer)
+	zw := gzip.NewWriter(changelog)
+	zw.Write([]byte("foo (1.0) stable; urgency=low\n"))
+	zw.Close()
+
+	opts := BuildOptions{
+		Control: ctrl,
+		Files: []*BuildFile{
+			{Name: "/usr/share/foo/data", Mode: 0644, Data: bytes.Repeat([]byte("x"), 2000)},
+			{Name: "usr/share/doc/foo/changelog.Debian.gz", Mode: 0644, Data: changelog.Bytes()},
+			{Name: "usr/bin/foo", Mode: os.ModeSymlink | 0777, Linkname: "../share/foo/data"},
+			{Name: "etc/foo.conf", Mode: 0644, Data: []byte("a=b\n"), Conffile: true},
+		},
+		ControlFiles: map[string][]byte{
+			"postinst": []byte("#!/bin/sh\n"),
+		},
+		Date: time.Unix(1700000000, 0),
+	}
+
+	for _, c := range []string{"", "gzip", "zstd", "none"} {
+		opts.Compression = c
+		buf := new(bytes.Buffer)
+		if !assert.NoError(t, Build(buf, opts), c) {
+			continue
+		}
+
+		d, err := Read(bytes.NewReader(buf.Bytes()), true, true)
+		if !assert.NoError(t, err, c) {
+			continue
+		}
+		assert.Equal(t, "foo", d.Package(), c)
+		assert.Equal(t, "12", d.Control.MightGet("Installed-Size"), "the installed size should be calculated (%s)", c)
+		assert.Equal(t, "foo (1.0) stable; urgency=low\n", d.Changelog, c)
+		assert.Equal(t, int64(buf.Len()), d.Size, c)
+
+		var names []string
+		for _, f := range d.Contents {
+			names = append(names, f.Name)
+			assert.Equal(t, "root", f.Uname, c)
+		}
+		assert.Equal(t, []string{
+			"etc",
+			"etc/foo.conf",
+			"usr",
+			"usr/bin",
+			"usr/bin/foo",
+			"usr/share",
+			"usr/share/doc",
+			"usr/share/doc/foo",
+			"usr/share/doc/foo/changelog.Debian.gz",
+			"usr/share/foo",
+			"usr/share/foo/data",
+		}, names, "the files should be sorted and the parent dirs should be added (%s)", c)
+
+		buf2 := new(bytes.Buffer)
+		assert.NoError(t, Build(buf2, opts))
+		assert.Equal(t, buf.Bytes(), buf2.Bytes(), "the package should be reproducible (%s)", c)
+	}
+
+	assert.Error(t, Build(new(bytes.Buffer), BuildOptions{Control: control.New()}), "the required fields should be checked")
+	assert.Error(t, Build(new(bytes.Buffer), BuildOptions{Control: ctrl, Files: []*BuildFile{{Name: "../foo", Mode: 0644}}}), "file names should be checked")
+	assert.Error(t, Build(new(bytes.Buffer), BuildOptions{Control: ctrl, Files: []*BuildFile{{Name: "usr/foo.conf", Mode: 0644, Conffile: true}}}), "conffiles should be in etc")
+	assert.Error(t, Build(new(bytes.Buffer), BuildOptions{Control: ctrl, ControlFiles: map[string][]byte{"md5sums": nil}}), "generated control files shouldn't be replaced")
+}
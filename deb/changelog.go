@@ -0,0 +1,71 @@
+package deb
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ChangelogEntry represents an entry in a Debian changelog.
+type ChangelogEntry struct {
+	Package       string `json:"package"`
+	Version       string `json:"version"`
+	Distributions string `json:"distributions"`
+	Urgency       string `json:"urgency,omitempty"`
+	Changes       string `json:"changes"`
+	Maintainer    string `json:"maintainer"`
+	Date          string `json:"date"`
+}
+
+var (
+	changelogHeaderRe  = regexp.MustCompile(`^(\S+) \(([^ )]+)\) ([^;]*);(.*)$`)
+	changelogTrailerRe = regexp.MustCompile(`^ -- (.+ <[^>]*>)  ?(.+)$`)
+)
+
+// ParseChangelog parses a Debian changelog (see deb-changelog(5)).
+func ParseChangelog(in string) ([]*ChangelogEntry, error) {
+	var entries []*ChangelogEntry
+	var cur *ChangelogEntry
+	var changes []string
+
+	lines := strings.Split(strings.Replace(in, "\r\n", "\n", -1), "\n")
+	for n, line := range lines {
+		switch {
+		case cur == nil && strings.TrimSpace(line) == "":
+			continue
+		case cur == nil && (strings.HasPrefix(line, "Local variables:") || strings.HasPrefix(line, "Old Changelog:")):
+			return entries, nil // the rest is free-form
+		case cur == nil && changelogHeaderRe.MatchString(line):
+			m := changelogHeaderRe.FindStringSubmatch(line)
+			cur = &ChangelogEntry{
+				Package:       m[1],
+				Version:       m[2],
+				Distributions: strings.TrimSpace(m[3]),
+			}
+			for _, kv := range strings.Split(m[4], ",") {
+				if kv := strings.SplitN(strings.TrimSpace(kv), "=", 2); len(kv) == 2 && strings.EqualFold(kv[0], "urgency") {
+					cur.Urgency = kv[1]
+				}
+			}
+			changes = changes[:0]
+		case cur == nil:
+			return nil, fmt.Errorf("expected changelog entry header at line %d", n+1)
+		case strings.HasPrefix(line, " -- "):
+			m := changelogTrailerRe.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("invalid changelog entry trailer at line %d", n+1)
+			}
+			cur.Maintainer, cur.Date = m[1], strings.TrimSpace(m[2])
+			cur.Changes = strings.Trim(strings.Join(changes, "\n"), "\n")
+			entries = append(entries, cur)
+			cur = nil
+		default:
+			changes = append(changes, strings.TrimRight(strings.TrimPrefix(line, "  "), " \t"))
+		}
+	}
+
+	if cur != nil {
+		return nil, fmt.Errorf("unterminated changelog entry for version %s", cur.Version)
+	}
+	return entries, nil
+}
@@ -0,0 +1,56 @@
+package deb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const changelog = `repogen (1.1-1) unstable, experimental; urgency=medium, binary-only=yes
+
+  * Fix a bug.
+    - With details.
+
+  [ Someone Else ]
+  * Another change.
+
+ -- Test User <test@example.com>  Mon, 01 Jan 2024 00:00:00 +0000
+
+repogen (1:1.0) UNRELEASED; urgency=low
+
+  * Initial release.
+
+ -- Test User <test@example.com>  Sun, 31 Dec 2023 00:00:00 +0000
+
+Local variables:
+mode: debian-changelog
+End:
+`
+
+func TestParseChangelog(t *testing.T) {
+	es, err := ParseChangelog(changelog)
+	assert.NoError(t, err, "should not error")
+	assert.Equal(t, []*ChangelogEntry{{
+		Package:       "repogen",
+		Version:       "1.1-1",
+		Distributions: "unstable, experimental",
+		Urgency:       "medium",
+		Changes:       "* Fix a bug.\n  - With details.\n\n[ Someone Else ]\n* Another change.",
+		Maintainer:    "Test User <test@example.com>",
+		Date:          "Mon, 01 Jan 2024 00:00:00 +0000",
+	}, {
+		Package:       "repogen",
+		Version:       "1:1.0",
+		Distributions: "UNRELEASED",
+		Urgency:       "low",
+		Changes:       "* Initial release.",
+		Maintainer:    "Test User <test@example.com>",
+		Date:          "Sun, 31 Dec 2023 00:00:00 +0000",
+	}}, es, "should parse entries correctly")
+
+	_, err = ParseChangelog("repogen (1.0) unstable; urgency=low\n\n  * Initial release.\n")
+	assert.Error(t, err, "should error on unterminated entries")
+
+	_, err = ParseChangelog("not a changelog\n")
+	assert.Error(t, err, "should error on invalid headers")
+}
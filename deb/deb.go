@@ -0,0 +1,326 @@
+// Package deb reads and builds Debian binary packages and their metadata.
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/kjk/lzma"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pgaskin/repogen/ar"
+	"github.com/pgaskin/repogen/control"
+	"github.com/xi2/xz"
+)
+
+// Deb represents a deb archive.
+type Deb struct {
+	Control   *control.Control
+	Contents  []*File
+	Changelog string // the decompressed changelog, if found
+	Sums      map[string]string
+	Size      int64
+	Filename  string
+}
+
+// File represents an entry in the data archive of a deb.
+type File struct {
+	Name     string      `json:"name"` // the cleaned path without the leading slash
+	Size     int64       `json:"size"`
+	Mode     os.FileMode `json:"mode"`
+	Uid      int         `json:"uid"`
+	Gid      int         `json:"gid"`
+	Uname    string      `json:"uname,omitempty"`
+	Gname    string      `json:"gname,omitempty"`
+	Linkname string      `json:"linkname,omitempty"` // the target of a symlink or hard link
+	Hardlink bool        `json:"hardlink,omitempty"`
+}
+
+// Open reads a deb archive. If getChangelog is true, the Debian changelog (or
+// the upstream one if not present) is read from /usr/share/doc/PACKAGE. The
+// Package, Version and Architecture fields are guaranteed to be present.
+func Open(fn string, getContents, getChangelog bool) (*Deb, error) {
+	abs, err := filepath.Abs(fn)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving path to deb file %v", err)
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening deb file: %v", err)
+	}
+	defer f.Close()
+
+	d, err := Read(f, getContents, getChangelog)
+	if err != nil {
+		return nil, err
+	}
+	d.Filename = abs
+	return d, nil
+}
+
+// Read is like Open, but reads a deb archive from rs. Filename is not set.
+func Read(rs io.ReadSeeker, getContents, getChangelog bool) (*Deb, error) {
+	d := Deb{}
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("error getting size of deb file: %v", err)
+	}
+	d.Size = size
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error reading deb file: %v", err)
+	}
+
+	d.Sums, err = multiSum(rs, map[string]hash.Hash{
+		"SHA512": sha512.New(),
+		"SHA256": sha256.New(),
+		"SHA1":   sha1.New(),
+		"MD5sum": md5.New(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error calculating checksums for deb file: %v", err)
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("error reading deb file: %v", err)
+	}
+
+	r, err := ar.NewReader(rs)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ar archive: %v", err)
+	}
+
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading ar archive: %v", err)
+		}
+
+		switch {
+		case h.Name == "debian-binary":
+			buf, err := ioutil.ReadAll(r)
+			if err != nil {
+				return nil, fmt.Errorf("error reading debian-binary: %v", err)
+			}
+			if !bytes.HasPrefix(buf, []byte("2.0")) {
+				return nil, fmt.Errorf("unknown debian-binary version: %s", string(buf))
+			}
+			continue
+		case strings.HasPrefix(h.Name, "control.tar"):
+			tr, err := openTar(strings.TrimRight(h.Name, "/"), r)
+			if err != nil {
+				return nil, fmt.Errorf("error reading control archive: %v", err)
+			}
+			var foundControl bool
+			for {
+				th, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return nil, fmt.Errorf("error reading control archive: %v", err)
+				}
+				if path.Clean(th.Name) == "control" {
+					buf, err := ioutil.ReadAll(tr)
+					if err != nil {
+						return nil, fmt.Errorf("error reading control archive: %v", err)
+					}
+					d.Control, err = control.Parse(string(buf))
+					if err != nil {
+						return nil, fmt.Errorf("error parsing control: %v", err)
+					}
+					foundControl = true
+				}
+			}
+			if !foundControl {
+				return nil, fmt.Errorf("no control file in control archive for deb")
+			}
+		case strings.HasPrefix(h.Name, "data.tar") && (getContents || getChangelog):
+			tr, err := openTar(strings.TrimRight(h.Name, "/"), r)
+			if err != nil {
+				return nil, fmt.Errorf("error reading data archive: %v", err)
+			}
+			var docDir string
+			if d.Control != nil {
+				docDir = path.Join("usr/share/doc", d.Control.MightGet("Package"))
+			}
+			var changelog, upstreamChangelog []byte
+			if getContents {
+				d.Contents = []*File{}
+			}
+			for {
+				th, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return nil, fmt.Errorf("error reading data archive: %v", err)
+				}
+				if getContents && path.Clean(th.Name) != "." && path.Clean(th.Name) != "/" {
+					d.Contents = append(d.Contents, &File{
+						Name:     strings.TrimPrefix(path.Clean(th.Name), "/"),
+						Size:     th.Size,
+						Mode:     th.FileInfo().Mode(),
+						Uid:      th.Uid,
+						Gid:      th.Gid,
+						Uname:    th.Uname,
+						Gname:    th.Gname,
+						Linkname: th.Linkname,
+						Hardlink: th.Typeflag == tar.TypeLink,
+					})
+				}
+				if th.FileInfo().IsDir() {
+					continue
+				}
+				if getChangelog && docDir != "" && th.Typeflag == tar.TypeReg {
+					switch path.Clean(th.Name) {
+					case path.Join(docDir, "changelog.Debian.gz"):
+						if changelog, err = ioutil.ReadAll(tr); err != nil {
+							return nil, fmt.Errorf("error reading changelog: %v", err)
+						}
+					case path.Join(docDir, "changelog.gz"):
+						if upstreamChangelog, err = ioutil.ReadAll(tr); err != nil {
+							return nil, fmt.Errorf("error reading changelog: %v", err)
+						}
+					}
+				}
+			}
+			if changelog == nil {
+				changelog = upstreamChangelog
+			}
+			if changelog != nil {
+				zr, err := gzip.NewReader(bytes.NewReader(changelog))
+				if err != nil {
+					return nil, fmt.Errorf("error decompressing changelog: %v", err)
+				}
+				buf, err := ioutil.ReadAll(zr)
+				if err != nil {
+					return nil, fmt.Errorf("error decompressing changelog: %v", err)
+				}
+				d.Changelog = string(buf)
+			}
+		}
+	}
+
+	if d.Control == nil {
+		return nil, fmt.Errorf("no control archive in deb")
+	}
+
+	for _, key := range []string{"Package", "Architecture", "Version"} {
+		if d.Control.MightGet(key) == "" {
+			return nil, fmt.Errorf("no %s field in control", key)
+		}
+	}
+
+	return &d, nil
+}
+
+// Package returns the package name.
+func (d *Deb) Package() string {
+	return d.Control.MightGet("Package")
+}
+
+// Version returns the package version.
+func (d *Deb) Version() string {
+	return d.Control.MightGet("Version")
+}
+
+// Architecture returns the package architecture.
+func (d *Deb) Architecture() string {
+	return d.Control.MightGet("Architecture")
+}
+
+// Source returns the source package name and version. If the Source field
+// does not specify a name or version, the binary package name or version is
+// used.
+func (d *Deb) Source() (name, version string) {
+	name, version = d.Control.MightGet("Package"), d.Control.MightGet("Version")
+	if src := strings.TrimSpace(d.Control.MightGet("Source")); src != "" {
+		srcName := src
+		if i := strings.Index(src, "("); i >= 0 {
+			srcName = strings.TrimSpace(src[:i])
+			version = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(src[i+1:]), ")"))
+		}
+		if srcName != "" {
+			name = srcName
+		}
+	}
+	return name, version
+}
+
+var decompressors = map[string]func(io.Reader) (io.Reader, error){
+	".tar": func(r io.Reader) (io.Reader, error) {
+		return r, nil
+	},
+	".gz": func(r io.Reader) (io.Reader, error) {
+		return gzip.NewReader(r)
+	},
+	".bz2": func(r io.Reader) (io.Reader, error) {
+		return bzip2.NewReader(r), nil
+	},
+	".xz": func(r io.Reader) (io.Reader, error) {
+		return xz.NewReader(r, 0)
+	},
+	".lzma": func(r io.Reader) (io.Reader, error) {
+		return lzma.NewReader(r), nil
+	},
+	".zst": func(r io.Reader) (io.Reader, error) {
+		return zstd.NewReader(r, zstd.WithDecoderConcurrency(1)) // synchronous, so it doesn't need to be closed
+	},
+}
+
+// Decompressor returns the decompressor for a file extension (e.g. .xz), or
+// nil if it isn't a supported compression format.
+func Decompressor(ext string) func(io.Reader) (io.Reader, error) {
+	return decompressors[ext]
+}
+
+func openTar(fn string, r io.Reader) (*tar.Reader, error) {
+	d := Decompressor(filepath.Ext(fn))
+	if d == nil {
+		return nil, fmt.Errorf("unknown compression format %s", filepath.Ext(fn))
+	}
+	dr, err := d(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing data: %v", err)
+	}
+	return tar.NewReader(dr), nil
+}
+
+// multiSum checksums r in multiple hash formats.
+func multiSum(r io.Reader, algs map[string]hash.Hash) (map[string]string, error) {
+	var ws []io.Writer
+	for _, alg := range algs {
+		alg.Reset()
+		ws = append(ws, alg)
+	}
+	hw := io.MultiWriter(ws...)
+
+	_, err := io.Copy(hw, r)
+	if err != nil {
+		return nil, err
+	}
+
+	hm := map[string]string{}
+	for n, alg := range algs {
+		hm[n] = fmt.Sprintf("%x", alg.Sum(nil))
+	}
+
+	return hm, nil
+}
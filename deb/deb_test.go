@@ -0,0 +1,134 @@
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pgaskin/repogen/ar"
+	"github.com/pgaskin/repogen/control"
+	"github.com/stretchr/testify/assert"
+	"github.com/ulikunitz/xz"
+)
+
+func TestMultiSum(t *testing.T) {
+	s, err := multiSum(strings.NewReader("test"), map[string]hash.Hash{
+		"SHA256": sha256.New(),
+		"SHA1":   sha1.New(),
+		"MD5":    md5.New(),
+	})
+	assert.NoError(t, err, "should not error")
+	assert.Equal(t, map[string]string{
+		"SHA256": "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		"SHA1":   "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+		"MD5":    "098f6bcd4621d373cade4e832627b4f6",
+	}, s, "sums should be correct")
+}
+
+func TestOpenTar(t *testing.T) {
+	tb := new(bytes.Buffer)
+	tw := tar.NewWriter(tb)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: 4}), "should not error")
+	_, err := tw.Write([]byte("test"))
+	assert.NoError(t, err, "should not error")
+	assert.NoError(t, tw.Close(), "should not error")
+
+	for ext, buf := range map[string][]byte{
+		"":     tb.Bytes(),
+		".gz":  testCompress(t, ".gz", tb.Bytes()),
+		".xz":  testCompress(t, ".xz", tb.Bytes()),
+		".zst": testCompress(t, ".zst", tb.Bytes()),
+	} {
+		tr, err := openTar("control.tar"+ext, bytes.NewReader(buf))
+		assert.NoError(t, err, "should not error for %#v", ext)
+		th, err := tr.Next()
+		assert.NoError(t, err, "should not error for %#v", ext)
+		assert.Equal(t, "./control", th.Name, "should read the tar for %#v", ext)
+	}
+
+	_, err = openTar("control.tar.lz", bytes.NewReader(nil))
+	assert.Error(t, err, "should error on unknown compression formats")
+}
+
+func testCompress(t *testing.T, ext string, data []byte) []byte {
+	b := new(bytes.Buffer)
+	var w io.WriteCloser
+	var err error
+	switch ext {
+	case ".gz":
+		w = gzip.NewWriter(b)
+	case ".xz":
+		w, err = xz.NewWriter(b)
+	case ".zst":
+		w, err = zstd.NewWriter(b)
+	}
+	assert.NoError(t, err, "should not error")
+	_, err = w.Write(data)
+	assert.NoError(t, err, "should not error")
+	assert.NoError(t, w.Close(), "should not error")
+	return b.Bytes()
+}
+
+func TestReadControl(t *testing.T) {
+	build := func(ctrl string) []byte {
+		tb := new(bytes.Buffer)
+		tw := tar.NewWriter(tb)
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(ctrl))}))
+		_, err := tw.Write([]byte(ctrl))
+		assert.NoError(t, err)
+		assert.NoError(t, tw.Close())
+
+		b := new(bytes.Buffer)
+		aw, err := ar.NewWriter(b)
+		assert.NoError(t, err)
+		assert.NoError(t, aw.WriteHeader(&ar.Header{Name: "debian-binary", Mode: 0100644, Size: 4}))
+		_, err = aw.Write([]byte("2.0\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, aw.WriteHeader(&ar.Header{Name: "control.tar", Mode: 0100644, Size: int64(tb.Len())}))
+		_, err = aw.Write(tb.Bytes())
+		assert.NoError(t, err)
+		assert.NoError(t, aw.Close())
+		return b.Bytes()
+	}
+
+	d, err := Read(bytes.NewReader(build("Package: foo\nVersion: 1.0\nArchitecture: all\n")), false, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "foo", d.Package())
+	}
+
+	_, err = Read(bytes.NewReader(build("Package:\nVersion: 1.0\nArchitecture: all\n")), false, false)
+	assert.EqualError(t, err, "no Package field in control", "an empty package name should be rejected")
+
+	_, err = Read(bytes.NewReader(build("Package: foo\nArchitecture: all\n")), false, false)
+	assert.EqualError(t, err, "no Version field in control")
+}
+
+func TestSource(t *testing.T) {
+	for _, c := range []struct {
+		source, name, version string
+	}{
+		{"", "foo", "1.0-1"},
+		{"bar", "bar", "1.0-1"},
+		{"bar (2.0)", "bar", "2.0"},
+		{" bar  ( 2.0 ) ", "bar", "2.0"},
+		{"(2.0)", "foo", "2.0"},
+	} {
+		ctrl := control.New()
+		ctrl.Set("Package", "foo")
+		ctrl.Set("Version", "1.0-1")
+		if c.source != "" {
+			ctrl.Set("Source", c.source)
+		}
+		name, version := (&Deb{Control: ctrl}).Source()
+		assert.Equal(t, c.name, name, c.source)
+		assert.Equal(t, c.version, version, c.source)
+	}
+}
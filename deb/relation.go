@@ -0,0 +1,170 @@
+package deb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pgaskin/repogen/version"
+)
+
+// Relation represents a single package in a relationship field, such as
+// "libc6 (>= 2.15)", "python3:any" or "foo [amd64 !i386]".
+type Relation struct {
+	Name     string
+	ArchQual string   // the architecture qualifier after the colon, if any
+	Op       string   // one of <<, <=, =, >=, >> (empty if unversioned)
+	Version  string   // the version to compare against (empty if unversioned)
+	Archs    []string // the architecture restriction list, if any
+}
+
+// Dependency is a list of alternative relations, any of which satisfies it
+// (i.e. "a | b").
+type Dependency []Relation
+
+// ParseRelations parses a relationship field, such as Depends or Provides.
+func ParseRelations(field string) ([]Dependency, error) {
+	var deps []Dependency
+	for _, spec := range strings.Split(field, ",") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		var dep Dependency
+		for _, alt := range strings.Split(spec, "|") {
+			rel, err := ParseRelation(alt)
+			if err != nil {
+				return nil, err
+			}
+			dep = append(dep, rel)
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+// ParseRelation parses a single relation (without alternatives).
+func ParseRelation(spec string) (Relation, error) {
+	var rel Relation
+	s := strings.TrimSpace(spec)
+
+	if i := strings.Index(s, "["); i >= 0 {
+		j := strings.Index(s, "]")
+		if j < i {
+			return rel, fmt.Errorf("unterminated architecture restriction in relation '%s'", spec)
+		}
+		rel.Archs = strings.Fields(s[i+1 : j])
+		s = strings.TrimSpace(s[:i] + s[j+1:])
+	}
+
+	if i := strings.Index(s, "("); i >= 0 {
+		j := strings.Index(s, ")")
+		if j < i {
+			return rel, fmt.Errorf("unterminated version restriction in relation '%s'", spec)
+		}
+		vs := strings.TrimSpace(s[i+1 : j])
+		for _, op := range []string{"<<", "<=", ">=", ">>", "=", "<", ">"} {
+			if strings.HasPrefix(vs, op) {
+				rel.Op, rel.Version = op, strings.TrimSpace(vs[len(op):])
+				break
+			}
+		}
+		switch rel.Op {
+		case "":
+			return rel, fmt.Errorf("invalid version restriction in relation '%s'", spec)
+		case "<":
+			rel.Op = "<=" // deprecated, but still means <=
+		case ">":
+			rel.Op = ">=" // deprecated, but still means >=
+		}
+		if rel.Version == "" {
+			return rel, fmt.Errorf("missing version in relation '%s'", spec)
+		}
+		s = strings.TrimSpace(s[:i] + s[j+1:])
+	}
+
+	if strings.ContainsAny(s, " \t\n") {
+		return rel, fmt.Errorf("invalid relation '%s'", spec)
+	}
+
+	rel.Name = s
+	if i := strings.Index(s, ":"); i >= 0 {
+		rel.Name, rel.ArchQual = s[:i], s[i+1:]
+	}
+	if rel.Name == "" {
+		return rel, fmt.Errorf("missing package name in relation '%s'", spec)
+	}
+
+	return rel, nil
+}
+
+// AppliesTo checks if the relation applies to the specified architecture (based
+// on the architecture restriction list).
+func (r Relation) AppliesTo(arch string) bool {
+	if len(r.Archs) == 0 {
+		return true
+	}
+	negated := strings.HasPrefix(r.Archs[0], "!")
+	for _, a := range r.Archs {
+		if strings.TrimPrefix(a, "!") == arch || strings.TrimPrefix(a, "!") == "any" {
+			return !negated
+		}
+	}
+	return negated
+}
+
+// SatisfiedBy checks if the specified version satisfies the version
+// restriction. If the relation is unversioned, it is always satisfied. An
+// unparseable version never satisfies a versioned relation.
+func (r Relation) SatisfiedBy(v string) bool {
+	if r.Op == "" {
+		return true
+	}
+
+	va, err := version.NewVersion(v)
+	if err != nil {
+		return false
+	}
+
+	vb, err := version.NewVersion(r.Version)
+	if err != nil {
+		return false
+	}
+
+	c := va.Compare(vb)
+	switch r.Op {
+	case "<<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case "=":
+		return c == 0
+	case ">=":
+		return c >= 0
+	case ">>":
+		return c > 0
+	}
+	return false
+}
+
+// String encodes the relation in the control file format.
+func (r Relation) String() string {
+	s := r.Name
+	if r.ArchQual != "" {
+		s += ":" + r.ArchQual
+	}
+	if r.Op != "" {
+		s += " (" + r.Op + " " + r.Version + ")"
+	}
+	if len(r.Archs) != 0 {
+		s += " [" + strings.Join(r.Archs, " ") + "]"
+	}
+	return s
+}
+
+// String encodes the dependency in the control file format.
+func (d Dependency) String() string {
+	ss := make([]string, len(d))
+	for i, r := range d {
+		ss[i] = r.String()
+	}
+	return strings.Join(ss, " | ")
+}
@@ -0,0 +1,71 @@
+package deb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRelations(t *testing.T) {
+	deps, err := ParseRelations("libc6 (>= 2.15), libjack-jackd2-0 (>= 1.9.10+20150825) | libjack-0.125, python3:any, foo [amd64 !i386], bar (< 1)")
+	assert.NoError(t, err, "should not error")
+	assert.Equal(t, []Dependency{
+		{{Name: "libc6", Op: ">=", Version: "2.15"}},
+		{{Name: "libjack-jackd2-0", Op: ">=", Version: "1.9.10+20150825"}, {Name: "libjack-0.125"}},
+		{{Name: "python3", ArchQual: "any"}},
+		{{Name: "foo", Archs: []string{"amd64", "!i386"}}},
+		{{Name: "bar", Op: "<=", Version: "1"}},
+	}, deps, "relations should be parsed correctly")
+
+	assert.Equal(t, "libjack-jackd2-0 (>= 1.9.10+20150825) | libjack-0.125", deps[1].String(), "should encode correctly")
+
+	for _, s := range []string{"foo (>= 1", "foo (~ 1)", "foo (>=)", "foo bar", "(>= 1)"} {
+		_, err := ParseRelations(s)
+		assert.Error(t, err, "should error on invalid relation %#v", s)
+	}
+
+	deps, err = ParseRelations("")
+	assert.NoError(t, err, "should not error on empty field")
+	assert.Empty(t, deps, "should not return relations for empty field")
+}
+
+func TestRelationSatisfiedBy(t *testing.T) {
+	for _, c := range []struct {
+		rel     string
+		version string
+		ok      bool
+	}{
+		{"a", "1.0", true},
+		{"a (>= 1.0)", "1.0", true},
+		{"a (>= 1.0)", "1.0~rc1", false},
+		{"a (>> 1.0)", "1.0", false},
+		{"a (>> 1.0)", "1.0-1", true},
+		{"a (<< 2)", "1:1.0", false},
+		{"a (<= 2)", "2", true},
+		{"a (= 2.0-1)", "2.0-1", true},
+		{"a (= 2.0-1)", "2.0-2", false},
+		{"a (>= 1.0)", "invalid", false},
+	} {
+		rel, err := ParseRelation(c.rel)
+		assert.NoError(t, err, "should not error")
+		assert.Equal(t, c.ok, rel.SatisfiedBy(c.version), "%s should be satisfied by %s: %t", c.rel, c.version, c.ok)
+	}
+}
+
+func TestRelationAppliesTo(t *testing.T) {
+	for _, c := range []struct {
+		rel  string
+		arch string
+		ok   bool
+	}{
+		{"a", "amd64", true},
+		{"a [amd64]", "amd64", true},
+		{"a [amd64]", "i386", false},
+		{"a [!amd64]", "amd64", false},
+		{"a [!amd64 !armhf]", "i386", true},
+	} {
+		rel, err := ParseRelation(c.rel)
+		assert.NoError(t, err, "should not error")
+		assert.Equal(t, c.ok, rel.AppliesTo(c.arch), "%s should apply to %s: %t", c.rel, c.arch, c.ok)
+	}
+}
@@ -0,0 +1,341 @@
+package deb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/version"
+)
+
+// maxResolveSteps limits the number of backtracking steps the resolver will
+// try before giving up.
+const maxResolveSteps = 100000
+
+// Resolver simulates installing packages from a set of available packages,
+// similarly to apt.
+type Resolver struct {
+	Arch              string
+	InstallRecommends bool
+
+	available map[string][]*ResolvedPackage // package name -> versions (newest first)
+	providers map[string][]*ResolvedPackage // virtual package name -> providers
+	pinned    map[string]string             // package name -> version requested by the user
+	steps     int
+}
+
+// ResolvedPackage is a package which can be chosen by the resolver.
+type ResolvedPackage struct {
+	Name    string
+	Version string
+	Arch    string
+	Origin  string // where the package is from (e.g. dist/component or an index file)
+	Control *control.Control
+}
+
+// ResolveError explains why a resolution failed.
+type ResolveError struct {
+	Reason string
+	Causes []*ResolveError
+}
+
+// NewResolver creates a new resolver for the specified architecture.
+func NewResolver(arch string) *Resolver {
+	return &Resolver{
+		Arch:      arch,
+		available: map[string][]*ResolvedPackage{},
+		providers: map[string][]*ResolvedPackage{},
+	}
+}
+
+// Add makes a package available to the resolver. Packages for other
+// architectures are ignored.
+func (r *Resolver) Add(c *control.Control, origin string) error {
+	name, ok := c.Get("Package")
+	if !ok {
+		return errors.New("no Package field in control")
+	}
+	ver, ok := c.Get("Version")
+	if !ok {
+		return fmt.Errorf("no Version field in control for %s", name)
+	}
+	arch, ok := c.Get("Architecture")
+	if !ok {
+		return fmt.Errorf("no Architecture field in control for %s", name)
+	}
+	if arch != r.Arch && arch != "all" {
+		return nil
+	}
+	for _, field := range []string{"Depends", "Pre-Depends", "Recommends", "Conflicts", "Breaks", "Provides"} {
+		if _, err := ParseRelations(c.MightGet(field)); err != nil {
+			return fmt.Errorf("error parsing %s of %s %s: %v", field, name, ver, err)
+		}
+	}
+
+	p := &ResolvedPackage{
+		Name:    name,
+		Version: ver,
+		Arch:    arch,
+		Origin:  origin,
+		Control: c,
+	}
+	for _, ap := range r.available[name] {
+		if ap.Version == ver {
+			return nil // the first one wins
+		}
+	}
+	r.available[name] = append(r.available[name], p)
+	sort.SliceStable(r.available[name], func(i, j int) bool {
+		return version.Newer(r.available[name][i].Version, r.available[name][j].Version)
+	})
+	for _, pr := range p.relations("Provides") {
+		r.providers[pr[0].Name] = append(r.providers[pr[0].Name], p)
+	}
+	return nil
+}
+
+// Resolve chooses the packages required to install the specified packages,
+// which are in the format name[=version]. Like apt, only the newest version of
+// each package is considered unless a specific version is requested.
+func (r *Resolver) Resolve(pkgs ...string) ([]*ResolvedPackage, error) {
+	var goals []resolveGoal
+	r.pinned = map[string]string{}
+	for _, pkg := range pkgs {
+		rel := Relation{Name: pkg}
+		if i := strings.Index(pkg, "="); i >= 0 {
+			rel = Relation{Name: pkg[:i], Op: "=", Version: pkg[i+1:]}
+			r.pinned[rel.Name] = rel.Version
+		}
+		if rel.Name == "" || (rel.Op != "" && rel.Version == "") {
+			return nil, fmt.Errorf("invalid package '%s'", pkg)
+		}
+		goals = append(goals, resolveGoal{Dep: Dependency{rel}, Kind: "Depends"})
+	}
+
+	r.steps = 0
+	sel, rerr := r.solve(map[string]*ResolvedPackage{}, goals)
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	res := make([]*ResolvedPackage, 0, len(sel))
+	for _, p := range sel {
+		res = append(res, p)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res, nil
+}
+
+type resolveGoal struct {
+	Dep  Dependency
+	Kind string
+	From *ResolvedPackage // nil if requested by the user
+	Soft bool             // if it can be skipped if unsatisfiable
+}
+
+func (g resolveGoal) String() string {
+	if g.From == nil {
+		return fmt.Sprintf("requested package %s", g.Dep)
+	}
+	return fmt.Sprintf("%s %s %s: %s", g.From.Name, g.From.Version, strings.ToLower(g.Kind), g.Dep)
+}
+
+func (r *Resolver) solve(sel map[string]*ResolvedPackage, goals []resolveGoal) (map[string]*ResolvedPackage, *ResolveError) {
+	for len(goals) != 0 && r.satisfied(sel, goals[0].Dep) {
+		goals = goals[1:]
+	}
+	if len(goals) == 0 {
+		return sel, nil
+	}
+	g, rest := goals[0], goals[1:]
+
+	if r.steps++; r.steps > maxResolveSteps {
+		return nil, &ResolveError{Reason: fmt.Sprintf("gave up after %d steps", maxResolveSteps)}
+	}
+
+	rerr := &ResolveError{Reason: g.String()}
+	cands, why := r.candidates(g.Dep)
+	rerr.Causes = append(rerr.Causes, why...)
+	for _, c := range cands {
+		if s, ok := sel[c.Name]; ok {
+			rerr.Causes = append(rerr.Causes, &ResolveError{Reason: fmt.Sprintf("%s %s is already chosen instead of %s", s.Name, s.Version, c.Version)})
+			continue
+		}
+		if reason := r.conflicts(sel, c); reason != "" {
+			rerr.Causes = append(rerr.Causes, &ResolveError{Reason: reason})
+			continue
+		}
+
+		nsel := make(map[string]*ResolvedPackage, len(sel)+1)
+		for k, v := range sel {
+			nsel[k] = v
+		}
+		nsel[c.Name] = c
+
+		ngoals := make([]resolveGoal, 0, len(rest)+8)
+		for _, kind := range []string{"Pre-Depends", "Depends", "Recommends"} {
+			if kind == "Recommends" && !r.InstallRecommends {
+				continue
+			}
+			for _, dep := range c.relations(kind) {
+				ngoals = append(ngoals, resolveGoal{Dep: dep, Kind: kind, From: c, Soft: kind == "Recommends"})
+			}
+		}
+		ngoals = append(ngoals, rest...)
+
+		res, cerr := r.solve(nsel, ngoals)
+		if cerr == nil {
+			return res, nil
+		}
+		rerr.Causes = append(rerr.Causes, &ResolveError{
+			Reason: fmt.Sprintf("could not choose %s %s (%s)", c.Name, c.Version, c.Origin),
+			Causes: []*ResolveError{cerr},
+		})
+		if r.steps > maxResolveSteps {
+			break
+		}
+	}
+
+	if g.Soft {
+		return r.solve(sel, rest)
+	}
+	if len(rerr.Causes) == 0 {
+		rerr.Causes = append(rerr.Causes, &ResolveError{Reason: "no candidates"})
+	}
+	return nil, rerr
+}
+
+// satisfied checks if a dependency is satisfied by the already chosen packages.
+// Alternatives which don't apply to the architecture are ignored, and if none
+// of them apply, the dependency is satisfied.
+func (r *Resolver) satisfied(sel map[string]*ResolvedPackage, dep Dependency) bool {
+	applies := false
+	for _, rel := range dep {
+		if !rel.AppliesTo(r.Arch) {
+			continue
+		}
+		applies = true
+		if p, ok := sel[rel.Name]; ok && rel.SatisfiedBy(p.Version) {
+			return true
+		}
+		for _, p := range sel {
+			if p.provides(rel) {
+				return true
+			}
+		}
+	}
+	return !applies
+}
+
+// candidates returns the packages which can satisfy a dependency in order of
+// preference, along with reasons why other packages cannot.
+func (r *Resolver) candidates(dep Dependency) ([]*ResolvedPackage, []*ResolveError) {
+	var cands []*ResolvedPackage
+	var why []*ResolveError
+	for _, rel := range dep {
+		if !rel.AppliesTo(r.Arch) {
+			why = append(why, &ResolveError{Reason: fmt.Sprintf("%s: does not apply to %s", rel, r.Arch)})
+			continue
+		}
+		if rel.ArchQual != "" && rel.ArchQual != "any" && rel.ArchQual != "native" && rel.ArchQual != r.Arch {
+			why = append(why, &ResolveError{Reason: fmt.Sprintf("%s: architecture %s is not being resolved", rel, rel.ArchQual)})
+			continue
+		}
+		if p := r.candidate(rel.Name); p != nil {
+			if rel.SatisfiedBy(p.Version) {
+				cands = append(cands, p)
+			} else {
+				why = append(why, &ResolveError{Reason: fmt.Sprintf("%s: candidate version %s does not match", rel, p.Version)})
+			}
+		}
+		for _, p := range r.providers[rel.Name] {
+			if p == r.candidate(p.Name) && p.provides(rel) {
+				cands = append(cands, p)
+			}
+		}
+		if len(r.available[rel.Name]) == 0 && len(r.providers[rel.Name]) == 0 {
+			why = append(why, &ResolveError{Reason: fmt.Sprintf("%s: no package named %s is available", rel, rel.Name)})
+		}
+	}
+	return cands, why
+}
+
+// candidate returns the version of a package which will be installed: the
+// version requested by the user, or the newest one.
+func (r *Resolver) candidate(name string) *ResolvedPackage {
+	if v, ok := r.pinned[name]; ok {
+		for _, p := range r.available[name] {
+			if p.Version == v {
+				return p
+			}
+		}
+		return nil
+	}
+	if len(r.available[name]) != 0 {
+		return r.available[name][0]
+	}
+	return nil
+}
+
+// conflicts checks if a package conflicts with the already chosen packages,
+// and returns the reason if so.
+func (r *Resolver) conflicts(sel map[string]*ResolvedPackage, p *ResolvedPackage) string {
+	for _, s := range sel {
+		for _, kind := range []string{"Conflicts", "Breaks"} {
+			for _, dep := range p.relations(kind) {
+				if rel := dep[0]; rel.AppliesTo(r.Arch) && s.Name != p.Name && s.matches(rel) {
+					return fmt.Sprintf("%s %s %s %s %s", p.Name, p.Version, strings.ToLower(kind), s.Name, s.Version)
+				}
+			}
+			for _, dep := range s.relations(kind) {
+				if rel := dep[0]; rel.AppliesTo(r.Arch) && s.Name != p.Name && p.matches(rel) {
+					return fmt.Sprintf("%s %s %s %s %s", s.Name, s.Version, strings.ToLower(kind), p.Name, p.Version)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// relations returns the parsed relationship field. The fields are validated
+// when the package is added, so errors are ignored.
+func (p *ResolvedPackage) relations(field string) []Dependency {
+	deps, _ := ParseRelations(p.Control.MightGet(field))
+	return deps
+}
+
+// matches checks if the package matches a relation either by name or by a
+// provided virtual package.
+func (p *ResolvedPackage) matches(rel Relation) bool {
+	return (p.Name == rel.Name && rel.SatisfiedBy(p.Version)) || p.provides(rel)
+}
+
+// provides checks if the package provides a virtual package matching the
+// relation. Unversioned provides never satisfy versioned relations.
+func (p *ResolvedPackage) provides(rel Relation) bool {
+	for _, dep := range p.relations("Provides") {
+		if pr := dep[0]; pr.Name == rel.Name {
+			if rel.Op == "" || (pr.Op == "=" && rel.SatisfiedBy(pr.Version)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *ResolveError) Error() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (e *ResolveError) write(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth) + e.Reason + "\n")
+	for _, c := range e.Causes {
+		c.write(b, depth+1)
+	}
+}
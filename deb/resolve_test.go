@@ -0,0 +1,120 @@
+package deb
+
+import (
+	"testing"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/stretchr/testify/assert"
+)
+
+const resolveTestPackages = `Package: ourapp
+Version: 1.2
+Architecture: amd64
+Depends: libfoo (>= 2), mail-transport-agent
+
+Package: ourapp
+Version: 1.1
+Architecture: amd64
+Depends: libfoo (>= 1)
+
+Package: ourapp
+Version: 1.3
+Architecture: amd64
+Depends: libfoo (>= 3)
+
+Package: libfoo
+Version: 2.1
+Architecture: amd64
+Depends: libc6
+
+Package: libfoo
+Version: 1.0
+Architecture: amd64
+
+Package: libc6
+Version: 2.28-10
+Architecture: amd64
+
+Package: exim4
+Version: 4.92
+Architecture: all
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent
+
+Package: postfix
+Version: 3.4
+Architecture: amd64
+Provides: mail-transport-agent
+Conflicts: mail-transport-agent, libc6 (<< 2.30)
+
+Package: other
+Version: 1.0
+Architecture: i386
+
+Package: archdep
+Version: 1.0
+Architecture: amd64
+Depends: libc6 [i386] | libfoo (>= 2), other [i386] | missing [i386]
+
+Package: archalt
+Version: 1.0
+Architecture: amd64
+Depends: missing [i386] | libc6 [amd64]
+`
+
+func testResolver(t *testing.T) *Resolver {
+	cs, err := control.ParseAll(resolveTestPackages)
+	assert.NoError(t, err, "should not error")
+	assert.Len(t, cs, 11, "should parse all packages")
+
+	r := NewResolver("amd64")
+	for _, c := range cs {
+		assert.NoError(t, r.Add(c, "test"), "should not error")
+	}
+	return r
+}
+
+func TestResolve(t *testing.T) {
+	r := testResolver(t)
+
+	sel, err := r.Resolve("ourapp=1.2")
+	assert.NoError(t, err, "should resolve")
+
+	var names []string
+	for _, p := range sel {
+		names = append(names, p.Name+"="+p.Version)
+	}
+	assert.Equal(t, []string{"exim4=4.92", "libc6=2.28-10", "libfoo=2.1", "ourapp=1.2"}, names, "should choose the correct packages")
+
+	sel, err = r.Resolve("ourapp=1.1")
+	assert.NoError(t, err, "should resolve")
+	assert.Len(t, sel, 3, "should choose the newest libfoo and its dependencies")
+
+	sel, err = r.Resolve("ourapp=1.1", "libfoo=1.0")
+	assert.NoError(t, err, "should resolve")
+	assert.Len(t, sel, 2, "should choose the requested libfoo version")
+
+	_, err = r.Resolve("ourapp")
+	assert.Error(t, err, "should not resolve the newest version with an unsatisfiable dependency")
+	assert.Contains(t, err.Error(), "libfoo (>= 3): candidate version 2.1 does not match", "should explain why it failed")
+
+	_, err = r.Resolve("ourapp=1.2", "postfix")
+	assert.Error(t, err, "should not resolve conflicting packages")
+	assert.Contains(t, err.Error(), "postfix 3.4 conflicts libc6 2.28-10", "should explain why it failed")
+
+	_, err = r.Resolve("other")
+	assert.Error(t, err, "should not resolve packages for other architectures")
+	assert.Contains(t, err.Error(), "no package named other is available", "should explain why it failed")
+
+	sel, err = r.Resolve("archdep")
+	assert.NoError(t, err, "should resolve")
+	names = nil
+	for _, p := range sel {
+		names = append(names, p.Name+"="+p.Version)
+	}
+	assert.Equal(t, []string{"archdep=1.0", "libc6=2.28-10", "libfoo=2.1"}, names, "should skip alternatives for other architectures instead of treating them as satisfied, and ignore dependencies which only apply to other architectures")
+
+	sel, err = r.Resolve("archalt")
+	assert.NoError(t, err, "should resolve")
+	assert.Len(t, sel, 2, "should choose the alternative for the architecture")
+}
@@ -1,18 +1,24 @@
 module github.com/pgaskin/repogen
 
-go 1.12
+go 1.22
 
 require (
-	github.com/davecgh/go-spew v0.0.0-20180830191138-d8f796af33cc // indirect
 	github.com/kjk/lzma v0.0.0-20161016003348-3fd93898850d
+	github.com/klauspost/compress v1.18.0
 	github.com/mattn/go-zglob v0.0.1
-	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/spf13/pflag v1.0.3
 	github.com/stretchr/testify v1.2.2
 	github.com/tdewolff/minify v0.0.0-20180913035026-a8ba821b5bd8
-	github.com/tdewolff/parse v0.0.0-20180825090006-bcb5c6a1c04e // indirect
-	github.com/tdewolff/test v1.0.0 // indirect
 	github.com/ulikunitz/xz v0.0.0-20180703112113-636d36a76670
 	github.com/xi2/xz v0.0.0-20171230120015-48954b6210f8
 	golang.org/x/crypto v0.0.0-20180910181607-0e37d006457b
+	golang.org/x/sys v0.20.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/davecgh/go-spew v0.0.0-20180830191138-d8f796af33cc // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/tdewolff/parse v0.0.0-20180825090006-bcb5c6a1c04e // indirect
+	github.com/tdewolff/test v1.0.0 // indirect
 )
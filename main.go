@@ -1,31 +1,43 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/mattn/go-zglob"
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/repo"
+	"github.com/pgaskin/repogen/storage"
+	"github.com/pgaskin/repogen/web"
 	"github.com/spf13/pflag"
 )
 
 var version = "unknown"
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "resolve":
+			os.Exit(resolveMain(os.Args[2:]))
+		case "serve":
+			os.Exit(serveMain(os.Args[2:]))
+		case "bundle":
+			os.Exit(bundleMain(os.Args[2:]))
+		case "import":
+			os.Exit(importMain(os.Args[2:]))
+		case "pack":
+			os.Exit(packMain(os.Args[2:]))
+		}
+	}
+
 	// TODO: cache contents and control as gzipped JSON (strict) to .cache/repogen/v{DEB-PARSER-REVISION}/{SHA1-OF-PATH}-{FILE-SIZE}-{FILE-CTIME}
 	// TODO: refactor the entire thing (it's a mess)
-	maintainerOverride := pflag.StringP("maintainer-override", "m", "", "overrides the maintainer of all packages (format: First Last <email@address.com>)")
-	origin := pflag.StringP("origin", "o", "repogen", "sets the origin field used in the Release file (this field is used as a user-friendly way to identify the repository)")
-	description := pflag.StringP("description", "d", "Generated by repogen (version: "+version+")", "sets the description field used in the Release file")
-	generateContents := pflag.BoolP("generate-contents", "c", false, "generates the Contents index (makes repogen slower to load)")
-	generateWeb := pflag.BoolP("generate-web", "b", false, "generate a web interface for browsing the packages")
-	watch := pflag.BoolP("watch", "w", false, "watch the input directory for new packages")
-	watchInterval := pflag.DurationP("watch-interval", "i", time.Second, "the interval to check for new packages (if watch is enabled)")
-	symlink := pflag.BoolP("symlink", "l", false, "Symlink packages instead of copying them")
+	opts := repoFlags(pflag.CommandLine)
 	help := pflag.BoolP("help", "h", false, "show this help text")
 	sversion := pflag.Bool("version", false, "show the version")
 	pflag.Parse()
@@ -36,9 +48,9 @@ func main() {
 	}
 
 	if *help || pflag.NArg() != 3 {
-		fmt.Fprintf(os.Stderr, "Usage: repogen [OPTIONS] PRIVATE_KEY_FILE INPUT_DIR OUTPUT_DIR\n\nVersion:\n  repogen %s\n\nOptions:\n", version)
+		fmt.Fprintf(os.Stderr, "Usage: repogen [OPTIONS] PRIVATE_KEY_FILE INPUT_DIR OUTPUT_DIR\n       repogen serve [OPTIONS] PRIVATE_KEY_FILE INPUT_DIR OUTPUT_DIR\n       repogen resolve [OPTIONS] INPUT_DIR DIST PACKAGE[=VERSION]...\n       repogen bundle [OPTIONS] PRIVATE_KEY_FILE OUTPUT_DIR BUNDLE_FILE\n       repogen import [OPTIONS] PUBLIC_KEY_FILE BUNDLE_FILE DIR\n       repogen pack [OPTIONS] DIR|SPEC_FILE\n\nVersion:\n  repogen %s\n\nOptions:\n", version)
 		pflag.PrintDefaults()
-		fmt.Fprintf(os.Stderr, "\nArguments:\n  PRIVATE_KEY_FILE is the path to a ascii-armoured gpg private key with no passphrase. It is used to sign the repository.\n  INPUT_DIR is the path to the directory containing the deb packages. It should be in the following layout (and must not contain any unrelated files): INPUT_DIR/dist/component/*.deb\n  OUTPUT_DIR is the path to place the generated repository in. It must not exist.\n")
+		fmt.Fprintf(os.Stderr, "\nArguments:\n  PRIVATE_KEY_FILE is the path to a ascii-armoured gpg private key with no passphrase. It is used to sign the repository.\n  INPUT_DIR is the path to the directory containing the deb packages. It should be in the following layout (and must not contain any unrelated files): INPUT_DIR/dist/component/*.deb\n  OUTPUT_DIR is the path to place the generated repository in. It must not exist. In watch mode, it may also be a symlink from a previous run, each update is generated in OUTPUT_DIR.gen-*, and OUTPUT_DIR is atomically switched to it once it is complete, so the last successful update is kept if one fails. It may also be an S3 URL in the format s3://BUCKET[/PREFIX], in which case the repository is updated in-place, only uploading changed files, and deleting the files repogen manages (dists, pool, changelogs, packages, .web, and key.asc) which are no longer needed (see README).\n")
 		os.Exit(1)
 	}
 
@@ -46,143 +58,455 @@ func main() {
 	inRoot := pflag.Arg(1)
 	outRoot := pflag.Arg(2)
 
-	buf, err := ioutil.ReadFile(pkFile)
+	key, inRoot, outRoot, err := opts.check(pkFile, inRoot, outRoot)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: could not read private key from '%s': %v\n", pkFile, err)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	if fi, err := os.Stat(inRoot); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: error reading input directory '%s': %v\n", inRoot, err)
-		os.Exit(1)
-	} else if !fi.IsDir() {
-		fmt.Fprintf(os.Stderr, "Error: input directory '%s' must be a directory\n", inRoot)
-		os.Exit(1)
-	}
+	if isS3(outRoot) {
+		if opts.Symlink {
+			fmt.Fprintf(os.Stderr, "Error: symlinks are not supported when the output is S3\n")
+			os.Exit(1)
+		}
 
-	if _, err := os.Stat(outRoot); err == nil {
-		fmt.Fprintf(os.Stderr, "Error: output directory '%s' must not exist\n", outRoot)
-		os.Exit(1)
+		var dists map[string]map[string][]*deb.Deb
+		u := newUpdater(func(changed []string) (string, error) {
+			ds, err := opts.generate(key, inRoot, outRoot, "", dists, changed)
+			if err == nil {
+				dists = ds
+			}
+			return outRoot, err
+		}, opts.StatusFile)
+		if !opts.Watch {
+			if err := u.Update(nil); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println("Info: successfully generated repository")
+			os.Exit(0)
+		}
+
+		w := newWatcher(inRoot, opts.WatchInterval, opts.WatchPoll)
+		defer w.Close()
+
+		u.Update(nil)
+		u.Run(w)
+		return
 	}
 
-	if inRoot, err = filepath.Abs(inRoot); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: could not resolve path to input directory '%s': %v\n", inRoot, err)
-		os.Exit(1)
+	if !opts.Watch {
+		if _, err := os.Stat(outRoot); err == nil {
+			fmt.Fprintf(os.Stderr, "Error: output directory '%s' must not exist\n", outRoot)
+			os.Exit(1)
+		}
+
+		u := newUpdater(func(changed []string) (string, error) {
+			if _, err := opts.generate(key, inRoot, outRoot, "", nil, nil); err != nil {
+				return "", err
+			}
+			if err := opts.Hooks.Publish("", outRoot, func() error { return nil }); err != nil {
+				os.RemoveAll(outRoot)
+				return "", err
+			}
+			return outRoot, nil
+		}, opts.StatusFile)
+		if err := u.Update(nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Info: successfully generated repository")
+		os.Exit(0)
 	}
 
-	if outRoot, err = filepath.Abs(outRoot); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: could not resolve path to output directory '%s': %v\n", outRoot, err)
+	if fi, err := os.Lstat(outRoot); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		fmt.Fprintf(os.Stderr, "Error: output directory '%s' must not exist or must be a symlink (in watch mode)\n", outRoot)
 		os.Exit(1)
 	}
 
-	var ls string
-	for {
-		for {
-			if !*watch {
-				break
-			}
+	w := newWatcher(inRoot, opts.WatchInterval, opts.WatchPoll)
+	defer w.Close()
 
-			fs, err := zglob.Glob(filepath.Join(inRoot, "**", "*.deb"))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: could not search for files in input directory '%s': %v\n", outRoot, err)
-				time.Sleep(*watchInterval)
-				continue
-			}
+	var dists map[string]map[string][]*deb.Deb
+	u := newUpdater(func(changed []string) (string, error) {
+		gen, ds, err := opts.generateGeneration(key, inRoot, outRoot, dists, changed)
+		if err == nil {
+			dists = ds
+		}
+		return gen, err
+	}, opts.StatusFile)
+	u.Update(nil)
+	u.Run(w)
+}
 
-			var e bool
-			var s1, s2 int64
-			for _, fn := range fs {
-				if fi, err := os.Stat(fn); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: could not search for files in input directory '%s': %v\n", outRoot, err)
-					e = true
-					break
-				} else {
-					s1 += fi.Size()
-				}
-			}
-			if e {
-				time.Sleep(*watchInterval)
-				continue
-			}
-			time.Sleep(time.Second)
-			for _, fn := range fs {
-				if fi, err := os.Stat(fn); err != nil {
-					fmt.Fprintf(os.Stderr, "Warning: could not search for files in input directory '%s': %v\n", outRoot, err)
-					e = true
-					break
-				} else {
-					s2 += fi.Size()
-				}
-			}
-			if e {
-				time.Sleep(*watchInterval)
-				continue
-			}
+// repoOptions are the options for generating a repository, which are shared
+// by the default command and serve.
+type repoOptions struct {
+	MaintainerOverride string
+	Overrides          []string
+	Origin             string
+	Description        string
+	GenerateContents   bool
+	Zstd               bool
+	GenerateChangelogs bool
+	BaseURL            string
+	GenerateWeb        bool
+	WebSearchShardSize int
+	WebTemplateDir     string
+	WebCDN             bool
+	Watch              bool
+	WatchInterval      time.Duration
+	WatchPoll          bool
+	StatusFile         string
+	Hooks              Hooks
+	Symlink            bool
+	PoolMode           string
+	PoolLayout         string
+	S3Endpoint         string
+	S3Region           string
+	S3PathStyle        bool
+	PDiffs             int
+	KeyringPackage     bool
+	SetupPackage       bool
+	KeyringVersion     string
+	KeyringComponent   string
+	Date               time.Time // from SOURCE_DATE_EPOCH
+	Access             *Access   // if set, additional web interfaces are generated for users who can access private dists and components (for serve)
+}
 
-			if s1 != s2 {
-				fmt.Fprintf(os.Stderr, "Warning: file probably still being written (will check again in 2s): total size of input directory changed: %d -> %d\n", s1, s2)
-				time.Sleep(time.Second * 2)
-				continue
-			}
+// repoFlags adds the flags for repoOptions to fs.
+func repoFlags(fs *pflag.FlagSet) *repoOptions {
+	o := &repoOptions{}
+	fs.StringVarP(&o.MaintainerOverride, "maintainer-override", "m", "", "overrides the maintainer of all packages (format: First Last <email@address.com>)")
+	fs.StringArrayVar(&o.Overrides, "override", nil, "a DIST or DIST/COMPONENT pattern and an override file to apply to the matching packages, in the format PATTERN=FILE (can be specified multiple times) (see README)")
+	fs.StringVarP(&o.Origin, "origin", "o", "repogen", "sets the origin field used in the Release file (this field is used as a user-friendly way to identify the repository)")
+	fs.StringVarP(&o.Description, "description", "d", "Generated by repogen (version: "+version+")", "sets the description field used in the Release file")
+	fs.BoolVarP(&o.GenerateContents, "generate-contents", "c", false, "generates the Contents index (makes repogen slower to load)")
+	fs.BoolVarP(&o.Zstd, "zstd", "z", false, "also generate zstd-compressed indexes (Packages.zst and Contents-*.zst)")
+	fs.BoolVarP(&o.GenerateChangelogs, "generate-changelogs", "C", false, "extracts the changelogs from the packages for use with apt changelog and the web interface (makes repogen slower to load)")
+	fs.IntVar(&o.PDiffs, "pdiffs", 0, "the number of PDiffs (Packages.diff) to keep so apt can download incremental updates to the Packages indexes instead of the full ones (in watch mode, or when the output is S3) (0 to disable)")
+	fs.StringVarP(&o.BaseURL, "base-url", "u", "", "the public URL of the repository (required for the Changelogs field in the Release file and --setup-package)")
+	fs.BoolVar(&o.KeyringPackage, "keyring-package", false, "build and publish an ORIGIN-archive-keyring package which installs the public key to /usr/share/keyrings (see README)")
+	fs.BoolVar(&o.SetupPackage, "setup-package", false, "also build and publish an ORIGIN-repo package which adds the repository to apt using the keyring package (see README)")
+	fs.StringVar(&o.KeyringVersion, "keyring-package-version", "", "the version of the keyring and setup packages (default the creation date of the key, e.g. 2023.11.14)")
+	fs.StringVar(&o.KeyringComponent, "keyring-package-component", "", "the component to add the keyring and setup packages to in each dist (default main if it exists, otherwise the first one)")
+	fs.BoolVarP(&o.GenerateWeb, "generate-web", "b", false, "generate a web interface for browsing the packages")
+	fs.IntVar(&o.WebSearchShardSize, "web-search-shard-size", 0, "split the search index for each dist into parts with at most this many packages, which are loaded in parallel (0 for no limit)")
+	fs.StringVar(&o.WebTemplateDir, "web-template-dir", "", "a directory containing templates, base.css, and an assets directory to override the defaults for the web interface (see README)")
+	fs.BoolVar(&o.WebCDN, "web-cdn", false, "load font-awesome in the web interface from cdnjs (with subresource integrity) rather than from the generated assets")
+	fs.BoolVarP(&o.Watch, "watch", "w", false, "watch the input directory for new packages")
+	fs.DurationVarP(&o.WatchInterval, "watch-interval", "i", time.Second, "the interval to check for new packages, or to wait for more changes before updating when using filesystem notifications (if watch is enabled)")
+	fs.StringVar(&o.StatusFile, "status-file", "", "write the status of the last update (including the last error) to this file as JSON (see README)")
+	fs.BoolVar(&o.WatchPoll, "watch-poll", false, "poll the input directory for changes instead of using filesystem notifications (if watch is enabled)")
+	fs.StringArrayVar(&o.Hooks.PrePublish, "pre-publish-hook", nil, "a shell command to run after generating the repository and before publishing it, which prevents it from being published if it fails (can be specified multiple times) (see README)")
+	fs.StringArrayVar(&o.Hooks.PostPublish, "post-publish-hook", nil, "a shell command to run after publishing the repository (can be specified multiple times) (see README)")
+	fs.StringArrayVar(&o.Hooks.Webhooks, "webhook", nil, "a URL to POST a JSON description of the changes to after publishing the repository (can be specified multiple times) (see README)")
+	fs.DurationVar(&o.Hooks.Timeout, "hook-timeout", time.Minute*5, "the maximum time to wait for each hook or webhook")
+	fs.BoolVarP(&o.Symlink, "symlink", "l", false, "Symlink packages instead of copying them")
+	fs.StringVar(&o.PoolLayout, "pool-layout", "package", "how to group packages in the pool: package (pool/COMPONENT/LETTER/PACKAGE/) or source (pool/COMPONENT/LETTER/SOURCE/, like the Debian archive)")
+	fs.StringVar(&o.PoolMode, "pool-mode", "copy", "how to add packages to the pool: copy, symlink, hardlink (falls back to copy if on a different filesystem), or reflink (copy-on-write, falls back to copy if not supported)")
+	fs.StringVar(&o.S3Endpoint, "s3-endpoint", "", "the base URL of the S3-compatible service to use if OUTPUT_DIR is an S3 URL (e.g. http://localhost:9000 for MinIO) (default AWS)")
+	fs.StringVar(&o.S3Region, "s3-region", "", "the region to use if OUTPUT_DIR is an S3 URL (default $AWS_REGION or $AWS_DEFAULT_REGION or us-east-1)")
+	fs.BoolVar(&o.S3PathStyle, "s3-path-style", false, "use path-style S3 URLs (ENDPOINT/BUCKET/KEY) instead of virtual-hosted ones (usually needed for MinIO)")
+	return o
+}
 
-			fs = append(fs, fmt.Sprint(s1))
-			sort.Strings(fs)
-			if s := fmt.Sprintf("%x", sha256sum([]byte(strings.Join(fs, ";")))); ls != s {
-				ls = s
-				break
-			}
+// isS3 checks if outRoot is an S3 URL.
+func isS3(outRoot string) bool {
+	return strings.HasPrefix(outRoot, "s3://")
+}
 
-			time.Sleep(*watchInterval)
-		}
+// s3 returns the S3 storage for outRoot (see isS3).
+func (o *repoOptions) s3(outRoot string) (*storage.S3, error) {
+	s, err := storage.NewS3(outRoot)
+	if err != nil {
+		return nil, err
+	}
+	if o.S3Endpoint != "" {
+		s.Endpoint = strings.TrimSuffix(o.S3Endpoint, "/")
+	}
+	if o.S3Region != "" {
+		s.Region = o.S3Region
+	}
+	s.PathStyle = o.S3PathStyle
+	return s, nil
+}
 
-		fmt.Println("Info: updating repo")
+// link returns the storage.LinkMode for PoolMode.
+func (o *repoOptions) link() storage.LinkMode {
+	switch o.PoolMode {
+	case "hardlink":
+		return storage.LinkHardlink
+	case "reflink":
+		return storage.LinkReflink
+	default:
+		return storage.LinkCopy
+	}
+}
 
-		os.RemoveAll(outRoot)
-		r, err := NewRepo(inRoot, outRoot, *generateContents, *maintainerOverride, *origin, *description, string(buf))
+// layout returns the repo.PoolLayout for PoolLayout.
+func (o *repoOptions) layout() repo.PoolLayout {
+	if o.PoolLayout == "source" {
+		return repo.PoolBySource
+	}
+	return repo.PoolByPackage
+}
+
+// overrides loads the override files.
+func (o *repoOptions) overrides() ([]*repo.Override, error) {
+	var overrides []*repo.Override
+	for _, arg := range o.Overrides {
+		spl := strings.SplitN(arg, "=", 2)
+		if len(spl) != 2 || spl[0] == "" || spl[1] == "" {
+			return nil, fmt.Errorf("invalid override %#v: must be in the format PATTERN=FILE", arg)
+		}
+		ov, err := repo.LoadOverrides(spl[1], spl[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: could not generate repository: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("could not load override file '%s': %v", spl[1], err)
 		}
+		overrides = append(overrides, ov...)
+	}
+	return overrides, nil
+}
 
-		r.Symlink = *symlink
+// check reads the private key and resolves the input and output directories.
+func (o *repoOptions) check(pkFile, inRoot, outRoot string) (string, string, string, error) {
+	if o.GenerateChangelogs && o.BaseURL == "" {
+		fmt.Fprintf(os.Stderr, "Warning: --base-url is not set, so the Changelogs field will not be added to the Release file\n")
+	}
 
-		err = r.Scan()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: could not generate repository: could not scan deb packages: %v\n", err)
-			os.Exit(1)
+	if o.SetupPackage && o.BaseURL == "" {
+		return "", "", "", fmt.Errorf("--base-url is required for --setup-package")
+	}
+
+	switch o.PoolMode {
+	case "copy", "hardlink", "reflink":
+	case "symlink":
+		o.Symlink = true
+	default:
+		return "", "", "", fmt.Errorf("invalid pool mode %#v", o.PoolMode)
+	}
+
+	switch o.PoolLayout {
+	case "package", "source":
+	default:
+		return "", "", "", fmt.Errorf("invalid pool layout %#v", o.PoolLayout)
+	}
+
+	if _, err := o.overrides(); err != nil {
+		return "", "", "", err
+	}
+
+	if date, err := sourceDateEpoch(); err != nil {
+		return "", "", "", err
+	} else if !date.IsZero() {
+		o.Date = date
+	}
+
+	buf, err := ioutil.ReadFile(pkFile)
+	if err != nil {
+		return "", "", "", fmt.Errorf("could not read private key from '%s': %v", pkFile, err)
+	}
+
+	if fi, err := os.Stat(inRoot); err != nil {
+		return "", "", "", fmt.Errorf("error reading input directory '%s': %v", inRoot, err)
+	} else if !fi.IsDir() {
+		return "", "", "", fmt.Errorf("input directory '%s' must be a directory", inRoot)
+	}
+
+	if inRoot, err = filepath.Abs(inRoot); err != nil {
+		return "", "", "", fmt.Errorf("could not resolve path to input directory '%s': %v", inRoot, err)
+	}
+
+	if isS3(outRoot) {
+		if _, err := o.s3(outRoot); err != nil {
+			return "", "", "", err
 		}
+	} else if outRoot, err = filepath.Abs(outRoot); err != nil {
+		return "", "", "", fmt.Errorf("could not resolve path to output directory '%s': %v", outRoot, err)
+	}
+
+	return string(buf), inRoot, outRoot, nil
+}
+
+// generate generates the repository in outRoot, which must not exist unless it
+// is an S3 URL (in which case it is updated in-place, and the hooks are run
+// before and after the files outside the pool are uploaded). If prevRoot is
+// set, it is the previous version of the repository to generate PDiffs
+// against. The packages from prev (the dists returned by the previous call) are
+// reused for components which aren't in changed (see Repo.ScanChanged). It
+// returns the scanned dists.
+func (o *repoOptions) generate(key, inRoot, outRoot, prevRoot string, prev map[string]map[string][]*deb.Deb, changed []string) (map[string]map[string][]*deb.Deb, error) {
+	ctx := context.Background()
 
-		err = r.MakePool()
+	overrides, err := o.overrides()
+	if err != nil {
+		return nil, fmt.Errorf("could not generate repository: %v", err)
+	}
+
+	ropts := repo.Options{
+		InRoot:             inRoot,
+		OutRoot:            outRoot,
+		SignKey:            key,
+		GenerateContents:   o.GenerateContents,
+		GenerateChangelogs: o.GenerateChangelogs,
+		Symlink:            o.Symlink,
+		Link:               o.link(),
+		PoolLayout:         o.layout(),
+		Zstd:               o.Zstd,
+		BaseURL:            o.BaseURL,
+		MaintainerOverride: o.MaintainerOverride,
+		Overrides:          overrides,
+		Date:               o.Date,
+		PDiffs:             o.PDiffs,
+		KeyringPackage:     o.KeyringPackage,
+		SetupPackage:       o.SetupPackage,
+		KeyringVersion:     o.KeyringVersion,
+		KeyringComponent:   o.KeyringComponent,
+		Origin:             o.Origin,
+		Description:        o.Description,
+	}
+	var staged *stagedStorage
+	var published map[PublishPackage][]string
+	if isS3(outRoot) {
+		s, err := o.s3(outRoot)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: could not generate repository: could not generate pool: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("could not generate repository: %v", err)
+		}
+		ropts.OutRoot, ropts.Storage = "", s
+		if !o.Hooks.Empty() {
+			if published, _, err = readPublished(ctx, s); err != nil {
+				return nil, fmt.Errorf("could not read published repository: %v", err)
+			}
+			staged = newStagedStorage(s)
+			ropts.Storage = staged
 		}
+	}
+	if prevRoot != "" {
+		ropts.Previous = storage.NewLocal(prevRoot)
+	}
+
+	r, err := repo.New(ropts)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate repository: %v", err)
+	}
+
+	err = r.ScanChanged(ctx, prev, changed)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate repository: could not scan deb packages: %v", err)
+	}
+
+	err = r.MakeKeyring(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate repository: could not generate keyring package: %v", err)
+	}
+
+	wopts := web.Options{
+		TemplateDir:     o.WebTemplateDir,
+		CDN:             o.WebCDN,
+		SearchShardSize: o.WebSearchShardSize,
+	}
+	if o.Access != nil {
+		wopts.Public, wopts.Views = o.Access.WebViews(r.Dists)
+	}
 
-		err = r.MakeDist()
+	err = r.MakePool(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate repository: could not generate pool: %v", err)
+	}
+
+	if o.GenerateChangelogs {
+		err = r.MakeChangelogs(ctx)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: could not generate repository: could not generate dists: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("could not generate repository: could not generate changelogs: %v", err)
 		}
+	}
 
-		err = r.MakeRoot()
+	err = r.MakeDist(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate repository: could not generate dists: %v", err)
+	}
+
+	err = r.MakeRoot(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate repository: %v", err)
+	}
+
+	if o.GenerateWeb {
+		err = web.Generate(ctx, r, wopts)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: could not generate repository: %v\n", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("could not generate web interface: %v", err)
 		}
+	}
 
-		if *generateWeb {
-			err = r.GenerateWeb()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: could not generate web interface: %v\n", err)
-				os.Exit(1)
+	err = r.Prune(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate repository: could not remove old files: %v", err)
+	}
+
+	if staged != nil {
+		pkgs, release, err := readPublished(ctx, staged)
+		if err != nil {
+			return nil, fmt.Errorf("could not read generated repository: %v", err)
+		}
+		if err := o.Hooks.publish(comparePublished(outRoot, published, pkgs, release), "", outRoot, func() error {
+			if err := staged.Commit(ctx); err != nil {
+				return fmt.Errorf("could not publish repository: %v", err)
 			}
+			return nil
+		}); err != nil {
+			return nil, err
 		}
+	}
+
+	return r.Dists, nil
+}
 
-		if !*watch {
-			break
+// generateGeneration generates a new generation of the repository and switches
+// outRoot to it (running the hooks). The previous generation is kept so
+// requests which are still using it can complete, and older ones are removed.
+// If it fails, outRoot is left as-is. It returns the path to the new generation
+// and the scanned dists (see generate).
+func (o *repoOptions) generateGeneration(key, inRoot, outRoot string, prev map[string]map[string][]*deb.Deb, changed []string) (string, map[string]map[string][]*deb.Deb, error) {
+	cur, err := filepath.EvalSymlinks(outRoot)
+	if err != nil {
+		cur = ""
+	}
+
+	gen := fmt.Sprintf("%s.gen-%d", outRoot, time.Now().UnixNano())
+	dists, err := o.generate(key, inRoot, gen, cur, prev, changed)
+	if err != nil {
+		os.RemoveAll(gen)
+		return "", nil, err
+	}
+
+	var prevGen string
+	if err := o.Hooks.Publish(cur, gen, func() error {
+		if prevGen, err = switchGeneration(outRoot, gen); err != nil {
+			return fmt.Errorf("could not switch to new generation: %v", err)
 		}
+		return nil
+	}); err != nil {
+		os.RemoveAll(gen)
+		return "", nil, err
+	}
+
+	if err := cleanGenerations(outRoot, gen, prevGen); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not clean old generations: %v\n", err)
+	}
+	return gen, dists, nil
+}
 
-		fmt.Println("Info: waiting for changes")
+// sourceDateEpoch returns the time from SOURCE_DATE_EPOCH, or the zero time if
+// it isn't set.
+func sourceDateEpoch() (time.Time, error) {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}, nil
+	}
+	sec, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %#v: %v", v, err)
 	}
-	fmt.Println("Info: successfully generated repository")
+	return time.Unix(sec, 0), nil
 }
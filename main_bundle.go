@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pgaskin/repogen/bundle"
+	"github.com/pgaskin/repogen/storage"
+	"github.com/spf13/pflag"
+	"golang.org/x/crypto/openpgp"
+)
+
+// bundleMain implements the bundle command, which exports a signed bundle of a
+// generated repository.
+func bundleMain(args []string) int {
+	fs := pflag.NewFlagSet("bundle", pflag.ContinueOnError)
+	dists := fs.StringArrayP("dist", "d", nil, "a dist to export (can be specified multiple times) (default all)")
+	base := fs.String("base", "", "a previous bundle to make an incremental bundle relative to, which leaves out the pool files which haven't changed since it")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Usage = func() {}
+
+	if err := fs.Parse(args); err != nil || *help || fs.NArg() != 3 {
+		if err != nil && err != pflag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Usage: repogen bundle [OPTIONS] PRIVATE_KEY_FILE OUTPUT_DIR BUNDLE_FILE\n\nVersion:\n  repogen %s\n\nOptions:\n", version)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nArguments:\n  PRIVATE_KEY_FILE is the path to a ascii-armoured gpg private key with no passphrase. It is used to sign the bundle.\n  OUTPUT_DIR is the path to a repository generated by repogen.\n  BUNDLE_FILE is the path to write the bundle to (see README).\n")
+		return 2
+	}
+
+	pkFile, outRoot, bundleFile := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+
+	key, err := readKeyRing(pkFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not read private key from '%s': %v\n", pkFile, err)
+		return 1
+	}
+	if key[0].PrivateKey == nil {
+		fmt.Fprintf(os.Stderr, "Error: could not read private key from '%s': no private key\n", pkFile)
+		return 1
+	}
+
+	if fi, err := os.Stat(outRoot); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: error reading output directory '%s': %v\n", outRoot, err)
+		return 1
+	} else if !fi.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: output directory '%s' must be a directory\n", outRoot)
+		return 1
+	}
+	if outRoot, err = filepath.EvalSymlinks(outRoot); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not resolve path to output directory '%s': %v\n", outRoot, err)
+		return 1
+	}
+
+	opts := bundle.ExportOptions{
+		Dists:   *dists,
+		SignKey: key[0],
+	}
+	if *base != "" {
+		f, err := os.Open(*base)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not read base bundle '%s': %v\n", *base, err)
+			return 1
+		}
+		opts.Base, err = bundle.ReadManifest(f, key)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not read base bundle '%s': %v\n", *base, err)
+			return 1
+		}
+	}
+
+	tf, err := ioutil.TempFile(filepath.Dir(bundleFile), "."+filepath.Base(bundleFile)+".*.tmp")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not create bundle: %v\n", err)
+		return 1
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+
+	if err := tf.Chmod(0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not create bundle: %v\n", err)
+		return 1
+	}
+
+	m, err := bundle.Export(context.Background(), tf, storage.NewLocal(outRoot), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not export bundle: %v\n", err)
+		return 1
+	}
+	if err := tf.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not write bundle: %v\n", err)
+		return 1
+	}
+	if err := os.Rename(tf.Name(), bundleFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not write bundle: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Info: exported %d files (%d unchanged) from %v to bundle %s\n", len(m.Files), len(m.Unchanged), m.Dists, m.ID)
+	return 0
+}
+
+// importMain implements the import command, which verifies a bundle and merges
+// it into an input or output directory.
+func importMain(args []string) int {
+	fs := pflag.NewFlagSet("import", pflag.ContinueOnError)
+	input := fs.BoolP("input", "i", false, "merge the packages into an input directory instead of merging the repository into an output directory")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Usage = func() {}
+
+	if err := fs.Parse(args); err != nil || *help || fs.NArg() != 3 {
+		if err != nil && err != pflag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Usage: repogen import [OPTIONS] PUBLIC_KEY_FILE BUNDLE_FILE DIR\n\nVersion:\n  repogen %s\n\nOptions:\n", version)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nArguments:\n  PUBLIC_KEY_FILE is the path to the ascii-armoured gpg public key the bundle must be signed with.\n  BUNDLE_FILE is the path to a bundle made by repogen bundle.\n  DIR is the path to the output directory (or the input directory if --input is set) to merge the bundle into. Incremental bundles can only be merged into a directory which the bundle they are based on was already merged into.\n")
+		return 2
+	}
+
+	pubFile, bundleFile, dir := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+
+	keyring, err := readKeyRing(pubFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not read public key from '%s': %v\n", pubFile, err)
+		return 1
+	}
+
+	f, err := os.Open(bundleFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not read bundle: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	td, err := ioutil.TempDir("", "repogen-import")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not create temp dir: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(td)
+
+	m, err := bundle.Extract(f, keyring, td)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not verify bundle: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Info: verified bundle %s from %s with %d files (%d unchanged) from %v\n", m.ID, m.Date.Format("2006-01-02 15:04:05 MST"), len(m.Files), len(m.Unchanged), m.Dists)
+
+	ctx := context.Background()
+	if *input {
+		err = bundle.MergeInput(ctx, m, td, dir)
+	} else {
+		err = bundle.MergeOutput(ctx, m, td, storage.NewLocal(dir))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not merge bundle into '%s': %v\n", dir, err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "Info: merged bundle into '%s'\n", dir)
+	return 0
+}
+
+// readKeyRing reads an ascii-armoured gpg key.
+func readKeyRing(fn string) (openpgp.EntityList, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return openpgp.ReadArmoredKeyRing(f)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/repo"
+	"github.com/spf13/pflag"
+)
+
+// packMain implements the pack command, which builds a deb package from a dir
+// or a YAML spec.
+func packMain(args []string) int {
+	fs := pflag.NewFlagSet("pack", pflag.ContinueOnError)
+	ctrlFile := fs.String("control", "", "the control file to use instead of DIR/DEBIAN/control")
+	compression := fs.StringP("compression", "Z", "xz", "the compression for the archives (gzip, xz, zstd, or none)")
+	output := fs.StringP("output", "o", "", "the file to write the package to (default PACKAGE_VERSION_ARCH.deb)")
+	inputDir := fs.StringP("input-dir", "i", "", "add the package to INPUT_DIR/DIST/COMPONENT instead of writing it to a file (a package with the same name must be identical)")
+	dist := fs.StringP("dist", "d", "", "the dist for --input-dir")
+	component := fs.StringP("component", "c", "main", "the component for --input-dir")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Usage = func() {}
+
+	if err := fs.Parse(args); err != nil || *help || fs.NArg() != 1 {
+		if err != nil && err != pflag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Usage: repogen pack [OPTIONS] DIR|SPEC_FILE\n\nVersion:\n  repogen %s\n\nOptions:\n", version)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nArguments:\n  DIR is the path to the package root, laid out like for dpkg-deb --build. DIR/DEBIAN contains the control file and maintainer scripts.\n  SPEC_FILE is the path to a YAML spec for the package (see README).\n\nIf SOURCE_DATE_EPOCH is set, it is used for the file dates instead of the newest modification time.\n")
+		return 2
+	}
+
+	if *inputDir != "" {
+		if *output != "" {
+			fmt.Fprintf(os.Stderr, "Error: --output can't be used with --input-dir\n")
+			return 2
+		}
+		if !repo.ValidName(*dist) || !repo.ValidName(*component) {
+			fmt.Fprintf(os.Stderr, "Error: invalid dist or component name: must match [a-z-]\n")
+			return 2
+		}
+		if fi, err := os.Stat(*inputDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: error reading input directory '%s': %v\n", *inputDir, err)
+			return 1
+		} else if !fi.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: input directory '%s' must be a directory\n", *inputDir)
+			return 1
+		}
+	} else if fs.Changed("dist") || fs.Changed("component") {
+		fmt.Fprintf(os.Stderr, "Error: --dist and --component can only be used with --input-dir\n")
+		return 2
+	}
+
+	src := fs.Arg(0)
+	fi, err := os.Stat(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not read '%s': %v\n", src, err)
+		return 1
+	}
+
+	var opts *deb.BuildOptions
+	if fi.IsDir() {
+		opts, err = packDir(src, *ctrlFile)
+	} else if *ctrlFile != "" {
+		fmt.Fprintf(os.Stderr, "Error: --control can only be used with a dir\n")
+		return 2
+	} else {
+		opts, err = packSpecFile(src)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not read package: %v\n", err)
+		return 1
+	}
+	opts.Compression = *compression
+
+	if date, err := sourceDateEpoch(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	} else if !date.IsZero() {
+		opts.Date = date
+	}
+
+	for _, key := range []string{"Maintainer", "Description"} {
+		if opts.Control.MightGet(key) == "" {
+			fmt.Fprintf(os.Stderr, "Warning: no %s field in control\n", key)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := deb.Build(buf, *opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not build package: %v\n", err)
+		return 1
+	}
+
+	d, err := deb.Read(bytes.NewReader(buf.Bytes()), false, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not read built package: %v\n", err)
+		return 1
+	}
+	pkgName, pkgVer, pkgArch := d.Package(), d.Version(), d.Architecture()
+
+	fn := *output
+	if *inputDir != "" {
+		compRoot := filepath.Join(*inputDir, *dist, *component)
+		if err := os.MkdirAll(compRoot, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not make component dir: %v\n", err)
+			return 1
+		}
+		fn = filepath.Join(compRoot, debFilename(pkgName, pkgVer, pkgArch))
+		if _, err := os.Stat(fn); err == nil {
+			ed, err := deb.Open(fn, false, false)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: could not read existing package: %v\n", err)
+				return 1
+			}
+			if ed.Sums["SHA256"] != d.Sums["SHA256"] {
+				fmt.Fprintf(os.Stderr, "Error: %s %s (%s) already exists in %s/%s with different contents\n", pkgName, pkgVer, pkgArch, *dist, *component)
+				return 1
+			}
+			fmt.Printf("Info: %s %s (%s) already exists in %s/%s\n", pkgName, pkgVer, pkgArch, *dist, *component)
+			return 0
+		}
+	} else if fn == "" {
+		fn = debFilename(pkgName, pkgVer, pkgArch)
+	}
+
+	// the temp file is hidden, so it is ignored if the repository is generated
+	// while it is being written
+	tf, err := ioutil.TempFile(filepath.Dir(fn), "."+filepath.Base(fn)+".*.tmp")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not create package: %v\n", err)
+		return 1
+	}
+	defer os.Remove(tf.Name())
+	defer tf.Close()
+
+	if err := tf.Chmod(0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not create package: %v\n", err)
+		return 1
+	}
+	if _, err := tf.Write(buf.Bytes()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not write package: %v\n", err)
+		return 1
+	}
+	if err := tf.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not write package: %v\n", err)
+		return 1
+	}
+	if err := os.Rename(tf.Name(), fn); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not write package: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Info: built %s %s (%s) to %s\n", pkgName, pkgVer, pkgArch, fn)
+	return 0
+}
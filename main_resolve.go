@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/repo"
+	"github.com/spf13/pflag"
+)
+
+// resolveMain implements the resolve command, which simulates installing
+// packages from a dist in the input directory.
+func resolveMain(args []string) int {
+	fs := pflag.NewFlagSet("resolve", pflag.ContinueOnError)
+	arch := fs.StringP("arch", "a", "amd64", "the architecture to resolve packages for")
+	base := fs.StringArrayP("base", "B", nil, "an additional Packages index (optionally compressed) to make available to the resolver, such as one from the Debian archive (can be specified multiple times)")
+	recommends := fs.BoolP("install-recommends", "r", false, "also install recommended packages (if they can be resolved)")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Usage = func() {}
+
+	if err := fs.Parse(args); err != nil || *help || fs.NArg() < 3 {
+		if err != nil && err != pflag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Usage: repogen resolve [OPTIONS] INPUT_DIR DIST PACKAGE[=VERSION]...\n\nVersion:\n  repogen %s\n\nOptions:\n", version)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nArguments:\n  INPUT_DIR is the path to the directory containing the deb packages (see repogen --help).\n  DIST is the dist to take the packages from.\n  PACKAGE is the name of a package to install, optionally with a specific version.\n")
+		return 2
+	}
+
+	inRoot, dist, pkgs := fs.Arg(0), fs.Arg(1), fs.Args()[2:]
+
+	r, err := repo.New(repo.Options{InRoot: inRoot})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not scan deb packages: %v\n", err)
+		return 1
+	}
+	if err := r.Scan(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not scan deb packages: %v\n", err)
+		return 1
+	}
+
+	if _, ok := r.Dists[dist]; !ok {
+		fmt.Fprintf(os.Stderr, "Error: no such dist '%s' in input directory\n", dist)
+		return 1
+	}
+
+	res := deb.NewResolver(*arch)
+	res.InstallRecommends = *recommends
+
+	var compNames []string
+	for compName := range r.Dists[dist] {
+		compNames = append(compNames, compName)
+	}
+	sort.Strings(compNames)
+
+	for _, compName := range compNames {
+		for _, d := range r.Dists[dist][compName] {
+			if err := res.Add(d.Control, dist+"/"+compName); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: could not load '%s': %v\n", d.Filename, err)
+				return 1
+			}
+		}
+	}
+
+	for _, fn := range *base {
+		buf, err := readIndex(fn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not read base index '%s': %v\n", fn, err)
+			return 1
+		}
+		cs, err := control.ParseAll(buf)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not parse base index '%s': %v\n", fn, err)
+			return 1
+		}
+		for _, c := range cs {
+			if err := res.Add(c, filepath.Base(fn)); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: ignoring package from base index '%s': %v\n", fn, err)
+			}
+		}
+	}
+
+	sel, err := res.Resolve(pkgs...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not resolve %s:\n%v\n", strings.Join(pkgs, " "), err)
+		return 1
+	}
+
+	for _, p := range sel {
+		fmt.Printf("%s %s %s (%s)\n", p.Name, p.Version, p.Arch, p.Origin)
+	}
+	fmt.Fprintf(os.Stderr, "Info: resolved %d packages\n", len(sel))
+	return 0
+}
+
+// readIndex reads an index file, decompressing it based on the extension.
+func readIndex(fn string) (string, error) {
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return "", err
+	}
+	d := deb.Decompressor(filepath.Ext(fn))
+	if d == nil {
+		return string(buf), nil
+	}
+	dr, err := d(bytes.NewReader(buf))
+	if err != nil {
+		return "", fmt.Errorf("error decompressing index: %v", err)
+	}
+	dbuf, err := ioutil.ReadAll(dr)
+	if err != nil {
+		return "", fmt.Errorf("error decompressing index: %v", err)
+	}
+	return string(dbuf), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pgaskin/repogen/deb"
+	"github.com/spf13/pflag"
+)
+
+// serveMain implements the serve command, which generates the repository and
+// serves it over HTTP. In watch mode, each update is generated into a new
+// directory, and OUTPUT_DIR is atomically switched to it once it is complete.
+func serveMain(args []string) int {
+	fs := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	opts := repoFlags(fs)
+	listen := fs.StringP("listen", "L", ":8080", "the address to listen on")
+	apiTokenFile := fs.String("api-token-file", "", "enable the HTTP API for managing packages, using the bearer tokens in this file (one per line) for authentication (see README)")
+	authFile := fs.String("auth-file", "", "a htpasswd-style file containing the users who can access private dists and components (see README)")
+	private := fs.StringArray("private", nil, "a DIST or DIST/COMPONENT pattern (e.g. stable/internal or */internal) which requires authentication (can be specified multiple times)")
+	tlsCert := fs.String("tls-cert", "", "serve over HTTPS using this certificate file (PEM)")
+	tlsKey := fs.String("tls-key", "", "the private key for --tls-cert (PEM)")
+	tlsClientCA := fs.String("tls-client-ca", "", "request TLS client certificates signed by the CAs in this file (PEM) for authentication (requires --tls-cert)")
+	accessLog := fs.String("access-log", "-", "the file to append access logs to in the combined log format (- for stdout, empty to disable)")
+	help := fs.BoolP("help", "h", false, "show this help text")
+	fs.Usage = func() {}
+
+	if err := fs.Parse(args); err != nil || *help || fs.NArg() != 3 {
+		if err != nil && err != pflag.ErrHelp {
+			fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+		}
+		fmt.Fprintf(os.Stderr, "Usage: repogen serve [OPTIONS] PRIVATE_KEY_FILE INPUT_DIR OUTPUT_DIR\n\nVersion:\n  repogen %s\n\nOptions:\n", version)
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nArguments:\n  PRIVATE_KEY_FILE is the path to a ascii-armoured gpg private key with no passphrase (see repogen --help).\n  INPUT_DIR is the path to the directory containing the deb packages (see repogen --help).\n  OUTPUT_DIR is the path to place the generated repository in. It must not exist, or must be a symlink from a previous run of repogen serve or repogen --watch. Each generation is placed in OUTPUT_DIR.gen-*, and OUTPUT_DIR is a symlink to the current one.\n")
+		return 2
+	}
+
+	key, inRoot, outRoot, err := opts.check(fs.Arg(0), fs.Arg(1), fs.Arg(2))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if isS3(outRoot) {
+		fmt.Fprintf(os.Stderr, "Error: output directory must be a local directory for serve\n")
+		return 1
+	}
+
+	if fi, err := os.Lstat(outRoot); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		fmt.Fprintf(os.Stderr, "Error: output directory '%s' must not exist or must be a symlink\n", outRoot)
+		return 1
+	}
+
+	var tokens []string
+	if *apiTokenFile != "" {
+		buf, err := ioutil.ReadFile(*apiTokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not read API tokens: %v\n", err)
+			return 1
+		}
+		for _, line := range strings.Split(string(buf), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				tokens = append(tokens, line)
+			}
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no API tokens in '%s'\n", *apiTokenFile)
+			return 1
+		}
+	}
+
+	var access *Access
+	if *authFile != "" || len(*private) != 0 {
+		if *authFile == "" {
+			fmt.Fprintf(os.Stderr, "Error: --private requires --auth-file\n")
+			return 1
+		}
+		users, err := LoadAccessUsers(*authFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not load users from '%s': %v\n", *authFile, err)
+			return 1
+		}
+		for _, p := range *private {
+			if _, err := path.Match(p, ""); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid private pattern '%s': %v\n", p, err)
+				return 1
+			}
+		}
+		if len(*private) == 0 {
+			fmt.Fprintf(os.Stderr, "Warning: --auth-file is set, but no dists or components are --private\n")
+		}
+		access = &Access{
+			Private: *private,
+			Users:   users,
+		}
+		opts.Access = access
+	}
+
+	var tlsConfig *tls.Config
+	if *tlsCert != "" || *tlsKey != "" || *tlsClientCA != "" {
+		if *tlsCert == "" || *tlsKey == "" {
+			fmt.Fprintf(os.Stderr, "Error: --tls-cert and --tls-key must both be specified\n")
+			return 1
+		}
+		tlsConfig = &tls.Config{}
+		if *tlsClientCA != "" {
+			buf, err := ioutil.ReadFile(*tlsClientCA)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: could not read client CAs: %v\n", err)
+				return 1
+			}
+			tlsConfig.ClientCAs = x509.NewCertPool()
+			if !tlsConfig.ClientCAs.AppendCertsFromPEM(buf) {
+				fmt.Fprintf(os.Stderr, "Error: no certificates in '%s'\n", *tlsClientCA)
+				return 1
+			}
+			tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	var lw io.Writer
+	switch *accessLog {
+	case "":
+	case "-":
+		lw = os.Stdout
+	default:
+		f, err := os.OpenFile(*accessLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not open access log: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		lw = f
+	}
+
+	// regenerations from the watcher and the API are run by the updater, so
+	// they don't overlap
+	var srv *Server
+	var root string
+	var dists map[string]map[string][]*deb.Deb
+	u := newUpdater(func(changed []string) (string, error) {
+		gen, ds, err := opts.generateGeneration(key, inRoot, outRoot, dists, changed)
+		if err != nil {
+			return "", err
+		}
+		dists, root = ds, gen
+		if srv != nil {
+			srv.SetRoot(gen)
+			fmt.Println("Info: switched to new generation")
+		}
+		return gen, nil
+	}, opts.StatusFile)
+
+	var w watcher
+	if opts.Watch {
+		w = newWatcher(inRoot, opts.WatchInterval, opts.WatchPoll)
+		defer w.Close()
+	}
+
+	if err := u.Update(nil); err != nil {
+		if !opts.Watch || !isDir(outRoot) {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if root, err = filepath.EvalSymlinks(outRoot); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not resolve previous generation: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "Warning: serving the previous generation from the last run\n")
+	}
+
+	srv = NewServer(root)
+	srv.AccessLog = lw
+	srv.Access = access
+	srv.Status = u.Status
+
+	if len(tokens) != 0 {
+		srv.API = &API{
+			InRoot: inRoot,
+			Tokens: tokens,
+			Publish: func() error {
+				return u.Update(nil)
+			},
+		}
+	}
+
+	if opts.Watch {
+		go u.Run(w)
+	}
+
+	hs := &http.Server{Addr: *listen, Handler: srv, TLSConfig: tlsConfig}
+	if tlsConfig != nil {
+		fmt.Printf("Info: serving repository on %s (https)\n", *listen)
+		err = hs.ListenAndServeTLS(*tlsCert, *tlsKey)
+	} else {
+		fmt.Printf("Info: serving repository on %s\n", *listen)
+		err = hs.ListenAndServe()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: could not serve repository: %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+	"gopkg.in/yaml.v3"
+)
+
+// packSpec is a YAML spec for the pack command. Paths are relative to the spec.
+type packSpec struct {
+	Root      string            `yaml:"root"`      // the dir containing the package files, like for dpkg-deb (a DEBIAN dir is ignored)
+	Control   yaml.Node         `yaml:"control"`   // the control fields, in order
+	Scripts   map[string]string `yaml:"scripts"`   // the maintainer scripts and other control files (name: src)
+	Files     map[string]string `yaml:"files"`     // additional files or dirs to add (src: dst)
+	Conffiles []string          `yaml:"conffiles"` // the conffiles (default: all regular files in /etc)
+}
+
+// packDir reads a package from a dir laid out like for dpkg-deb --build. The
+// control file is read from ctrlFile if set, or DIR/DEBIAN/control. The other
+// files in DEBIAN are added to the control archive, except for md5sums, which
+// is generated. If DEBIAN/conffiles doesn't exist, all regular files in /etc
+// are conffiles. The date is set to the newest modification time.
+func packDir(dir, ctrlFile string) (*deb.BuildOptions, error) {
+	opts := &deb.BuildOptions{
+		ControlFiles: map[string][]byte{},
+	}
+
+	var conffiles []string
+	fis, err := ioutil.ReadDir(filepath.Join(dir, "DEBIAN"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading control dir: %v", err)
+	}
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			return nil, fmt.Errorf("control file %s is not a regular file", fi.Name())
+		}
+		switch fi.Name() {
+		case "md5sums":
+			continue
+		case "control":
+			if ctrlFile != "" {
+				continue
+			}
+		}
+		buf, err := packRead(opts, filepath.Join(dir, "DEBIAN", fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		switch fi.Name() {
+		case "control":
+			if opts.Control, err = control.Parse(string(buf)); err != nil {
+				return nil, fmt.Errorf("error parsing control: %v", err)
+			}
+		case "conffiles":
+			if conffiles, err = parseConffiles(string(buf)); err != nil {
+				return nil, err
+			}
+		default:
+			opts.ControlFiles[fi.Name()] = buf
+		}
+	}
+
+	if ctrlFile != "" {
+		buf, err := packRead(opts, ctrlFile)
+		if err != nil {
+			return nil, err
+		}
+		if opts.Control, err = control.Parse(string(buf)); err != nil {
+			return nil, fmt.Errorf("error parsing control: %v", err)
+		}
+	} else if opts.Control == nil {
+		return nil, fmt.Errorf("no control file in %s", filepath.Join(dir, "DEBIAN"))
+	}
+
+	if err := packAdd(opts, dir, "/", true); err != nil {
+		return nil, err
+	}
+	if err := packConffiles(opts.Files, conffiles); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// packSpecFile reads a package from a YAML spec. The date is set to the newest
+// modification time.
+func packSpecFile(fn string) (*deb.BuildOptions, error) {
+	opts := &deb.BuildOptions{
+		Control:      control.New(),
+		ControlFiles: map[string][]byte{},
+	}
+
+	buf, err := packRead(opts, fn)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec packSpec
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	dec.KnownFields(true)
+	if err := dec.Decode(&spec); err != nil {
+		return nil, fmt.Errorf("error parsing spec: %v", err)
+	}
+
+	if spec.Control.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("error parsing spec: control must be a mapping")
+	}
+	for i := 0; i+1 < len(spec.Control.Content); i += 2 {
+		k, v := spec.Control.Content[i], spec.Control.Content[i+1]
+		if v.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("error parsing spec: control field %s must be a string (line %d)", k.Value, v.Line)
+		}
+		if strings.ContainsAny(k.Value, ": \t\n") || k.Value == "" {
+			return nil, fmt.Errorf("error parsing spec: invalid control field name %#v (line %d)", k.Value, k.Line)
+		}
+		opts.Control.Set(k.Value, strings.TrimRight(v.Value, "\n"))
+	}
+
+	base := filepath.Dir(fn)
+	rel := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(base, filepath.FromSlash(p))
+	}
+
+	for name, src := range spec.Scripts {
+		if name == "md5sums" || name == "conffiles" || name == "control" {
+			return nil, fmt.Errorf("error parsing spec: control file %s can't be specified as a script", name)
+		}
+		if opts.ControlFiles[name], err = packRead(opts, rel(src)); err != nil {
+			return nil, err
+		}
+	}
+
+	if spec.Root != "" {
+		if err := packAdd(opts, rel(spec.Root), "/", true); err != nil {
+			return nil, err
+		}
+	}
+	srcs := make([]string, 0, len(spec.Files))
+	for src := range spec.Files {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	for _, src := range srcs {
+		if err := packAdd(opts, rel(src), spec.Files[src], false); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := packConffiles(opts.Files, spec.Conffiles); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// packRead reads a file, and updates the date of opts.
+func packRead(opts *deb.BuildOptions, fn string) ([]byte, error) {
+	fi, err := os.Stat(fn)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", fn, err)
+	}
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", fn, err)
+	}
+	if fi.ModTime().After(opts.Date) {
+		opts.Date = fi.ModTime()
+	}
+	return buf, nil
+}
+
+// packAdd adds the file or dir (recursively) at src to opts at dst, and updates
+// the date of opts. If skipControl is set, the DEBIAN dir in src is skipped.
+func packAdd(opts *deb.BuildOptions, src, dst string, skipControl bool) error {
+	return filepath.Walk(src, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", p, err)
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if skipControl && rel == "DEBIAN" {
+			return filepath.SkipDir
+		}
+		if fi.ModTime().After(opts.Date) {
+			opts.Date = fi.ModTime()
+		}
+
+		f := &deb.BuildFile{
+			Name: path.Join("/", dst, filepath.ToSlash(rel)),
+			Mode: fi.Mode(),
+		}
+		switch {
+		case fi.IsDir():
+			if f.Name == "/" {
+				return nil
+			}
+		case fi.Mode()&os.ModeSymlink != 0:
+			if f.Linkname, err = os.Readlink(p); err != nil {
+				return fmt.Errorf("error reading %s: %v", p, err)
+			}
+		case fi.Mode().IsRegular():
+			if f.Data, err = ioutil.ReadFile(p); err != nil {
+				return fmt.Errorf("error reading %s: %v", p, err)
+			}
+		default:
+			return fmt.Errorf("unsupported file type %s for %s", fi.Mode().Type(), p)
+		}
+		opts.Files = append(opts.Files, f)
+		return nil
+	})
+}
+
+// packConffiles marks the conffiles. If names is nil, all regular files in /etc
+// are conffiles, like debhelper does.
+func packConffiles(files []*deb.BuildFile, names []string) error {
+	if names == nil {
+		for _, f := range files {
+			f.Conffile = f.Mode.IsRegular() && strings.HasPrefix(f.Name, "/etc/")
+		}
+		return nil
+	}
+	for _, name := range names {
+		name = path.Clean("/" + name)
+		var found bool
+		for _, f := range files {
+			if f.Name == name {
+				f.Conffile, found = true, true
+			}
+		}
+		if !found {
+			return fmt.Errorf("conffile %s does not exist", name)
+		}
+	}
+	return nil
+}
+
+// parseConffiles parses a conffiles control file.
+func parseConffiles(s string) ([]string, error) {
+	names := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, "/") || strings.ContainsAny(line, " \t") {
+			return nil, fmt.Errorf("unsupported conffiles entry %#v", line)
+		}
+		names = append(names, line)
+	}
+	return names, nil
+}
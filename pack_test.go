@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/repogen/deb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPack(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-pack")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	write := func(fn, contents string, mode os.FileMode) {
+		fn = filepath.Join(td, filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, []byte(contents), mode))
+		assert.NoError(t, os.Chtimes(fn, time.Unix(1700000000, 0), time.Unix(1700000000, 0)))
+	}
+	write("dir/DEBIAN/control", "Package: foo\nVersion: 1.0\nArchitecture: all\nMaintainer: Test <test@example.com>\nDescription: test\n", 0644)
+	write("dir/DEBIAN/postinst", "#!/bin/sh\n", 0755)
+	write("dir/DEBIAN/md5sums", "invalid\n", 0644)
+	write("dir/etc/foo.conf", "a=b\n", 0644)
+	write("dir/usr/share/foo/data", "data\n", 0644)
+	assert.NoError(t, os.Symlink("../share/foo/data", filepath.Join(td, "dir", "usr", "bin")))
+	write("dir/usr/share/foo/new", "new\n", 0644)
+
+	build := func(opts *deb.BuildOptions) *deb.Deb {
+		buf := new(bytes.Buffer)
+		if !assert.NoError(t, deb.Build(buf, *opts)) {
+			return nil
+		}
+		d, err := deb.Read(bytes.NewReader(buf.Bytes()), true, false)
+		assert.NoError(t, err)
+		return d
+	}
+
+	opts, err := packDir(filepath.Join(td, "dir"), "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string][]byte{"postinst": []byte("#!/bin/sh\n")}, opts.ControlFiles, "md5sums should be regenerated")
+		if d := build(opts); assert.NotNil(t, d) {
+			assert.Equal(t, "foo", d.Package())
+			var names []string
+			for _, f := range d.Contents {
+				names = append(names, f.Name)
+			}
+			assert.Equal(t, []string{"etc", "etc/foo.conf", "usr", "usr/bin", "usr/share", "usr/share/foo", "usr/share/foo/data", "usr/share/foo/new"}, names)
+		}
+		for _, f := range opts.Files {
+			assert.Equal(t, f.Name == "/etc/foo.conf", f.Conffile, "files in /etc should be conffiles by default (%s)", f.Name)
+		}
+	}
+
+	write("control", "Package: bar\nVersion: 1.0\nArchitecture: all\n", 0644)
+	write("dir/DEBIAN/conffiles", "\n", 0644)
+	opts, err = packDir(filepath.Join(td, "dir"), filepath.Join(td, "control"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "bar", opts.Control.MightGet("Package"), "the control file should be overridden")
+		for _, f := range opts.Files {
+			assert.False(t, f.Conffile, "the conffiles should be read from DEBIAN/conffiles (%s)", f.Name)
+		}
+	}
+
+	_, err = packDir(filepath.Join(td, "dir", "usr"), "")
+	assert.Error(t, err, "the control file should be required")
+
+	write("dated/DEBIAN/control", "Package: foo\nVersion: 1.0\nArchitecture: all\n", 0644)
+	write("dated/new", "new\n", 0644)
+	for _, fn := range []string{"dated/DEBIAN", "dated"} {
+		assert.NoError(t, os.Chtimes(filepath.Join(td, fn), time.Unix(1700000000, 0), time.Unix(1700000000, 0)))
+	}
+	assert.NoError(t, os.Chtimes(filepath.Join(td, "dated", "new"), time.Unix(1700000100, 0), time.Unix(1700000100, 0)))
+	opts, err = packDir(filepath.Join(td, "dated"), "")
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1700000100), opts.Date.Unix(), "the date should be the newest modification time")
+	}
+
+	write("spec/foo.yaml", `root: ../dir
+control:
+  Package: baz
+  Version: 1.0
+  Architecture: all
+  Depends: foo
+  Description: |
+    test
+    long description
+
+    more
+scripts:
+  prerm: ./prerm
+files:
+  ./bin: /usr/lib/baz
+conffiles:
+  - /etc/foo.conf
+`, 0644)
+	write("spec/prerm", "#!/bin/sh\n", 0755)
+	write("spec/bin/baz", "baz\n", 0755)
+
+	opts, err = packSpecFile(filepath.Join(td, "spec", "foo.yaml"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"Package", "Version", "Architecture", "Depends", "Description"}, opts.Control.Order, "the order of the control fields should be kept")
+		assert.Equal(t, "1.0", opts.Control.MightGet("Version"), "the version shouldn't be parsed as a number")
+		assert.Equal(t, "test\nlong description\n\nmore", opts.Control.MightGet("Description"))
+		assert.Contains(t, opts.ControlFiles, "prerm")
+		if d := build(opts); assert.NotNil(t, d) {
+			var found bool
+			for _, f := range d.Contents {
+				if f.Name == "usr/lib/baz/baz" {
+					found = true
+					assert.Equal(t, os.FileMode(0755), f.Mode.Perm())
+				}
+			}
+			assert.True(t, found, "the additional files should be added")
+		}
+	}
+
+	write("spec/bad.yaml", "control:\n  Package: baz\nunknown: true\n", 0644)
+	_, err = packSpecFile(filepath.Join(td, "spec", "bad.yaml"))
+	assert.Error(t, err, "unknown fields should be rejected")
+
+	write("spec/bad.yaml", "control:\n  Package: baz\nconffiles:\n  - /etc/none\n", 0644)
+	_, err = packSpecFile(filepath.Join(td, "spec", "bad.yaml"))
+	assert.Error(t, err, "conffiles should exist")
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/storage"
+	debversion "github.com/pgaskin/repogen/version"
+)
+
+// PublishEvent describes a new generation of the repository. It is passed to
+// hooks on stdin and POSTed to webhooks as JSON.
+type PublishEvent struct {
+	Phase      string                    `json:"phase"`      // pre-publish or post-publish
+	Time       time.Time                 `json:"time"`       // when the generation was published (or generated for pre-publish)
+	Generation string                    `json:"generation"` // the name of the generated dir (or the S3 URL)
+	Dists      []string                  `json:"dists"`      // the dists which changed since the previous generation
+	Added      []PublishPackage          `json:"added"`
+	Removed    []PublishPackage          `json:"removed"`
+	Upgraded   []PublishPackage          `json:"upgraded"`
+	Release    map[string]PublishRelease `json:"release"` // for each dist
+}
+
+// PublishPackage is a package version in a PublishEvent.
+type PublishPackage struct {
+	Dist         string `json:"dist"`
+	Component    string `json:"component"`
+	Package      string `json:"package"`
+	Architecture string `json:"architecture"`
+	Version      string `json:"version"`
+	OldVersion   string `json:"old_version,omitempty"` // for upgrades
+}
+
+// PublishRelease contains the checksums for a dist in a PublishEvent.
+type PublishRelease struct {
+	SHA256 string            `json:"sha256"` // the checksum of the Release file
+	Files  map[string]string `json:"files"`  // the SHA256 field of the Release file (path -> checksum)
+}
+
+// newPublishEvent compares the generated repository in root with the previous
+// one in prev (which can be empty if there isn't one).
+func newPublishEvent(prev, root string) (*PublishEvent, error) {
+	ctx := context.Background()
+
+	var oldPkgs map[PublishPackage][]string
+	if prev != "" {
+		var err error
+		if oldPkgs, _, err = readPublished(ctx, storage.NewLocal(prev)); err != nil {
+			return nil, fmt.Errorf("could not read previous generation: %v", err)
+		}
+	}
+
+	newPkgs, release, err := readPublished(ctx, storage.NewLocal(root))
+	if err != nil {
+		return nil, fmt.Errorf("could not read generated repository: %v", err)
+	}
+	return comparePublished(filepath.Base(root), oldPkgs, newPkgs, release), nil
+}
+
+// comparePublished makes a PublishEvent from the package versions of the
+// previous and new repositories (see readPublished).
+func comparePublished(generation string, oldPkgs, newPkgs map[PublishPackage][]string, release map[string]PublishRelease) *PublishEvent {
+	ev := &PublishEvent{
+		Time:       time.Now().UTC(),
+		Generation: generation,
+		Dists:      []string{},
+		Added:      []PublishPackage{},
+		Removed:    []PublishPackage{},
+		Upgraded:   []PublishPackage{},
+		Release:    release,
+	}
+
+	keys := map[PublishPackage]bool{}
+	for k := range oldPkgs {
+		keys[k] = true
+	}
+	for k := range newPkgs {
+		keys[k] = true
+	}
+
+	dists := map[string]bool{}
+	for k := range keys {
+		var added, removed []string
+		for _, v := range newPkgs[k] {
+			if !inSlice(oldPkgs[k], v) {
+				added = append(added, v)
+			}
+		}
+		for _, v := range oldPkgs[k] {
+			if !inSlice(newPkgs[k], v) {
+				removed = append(removed, v)
+			}
+		}
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		dists[k.Dist] = true
+
+		// if the latest version was replaced by a newer one, it's an upgrade
+		if len(added) != 0 && len(removed) != 0 {
+			if na, ro := added[len(added)-1], removed[len(removed)-1]; debversion.Newer(na, ro) {
+				p := k
+				p.Version, p.OldVersion = na, ro
+				ev.Upgraded = append(ev.Upgraded, p)
+				added, removed = added[:len(added)-1], removed[:len(removed)-1]
+			}
+		}
+		for _, v := range added {
+			p := k
+			p.Version = v
+			ev.Added = append(ev.Added, p)
+		}
+		for _, v := range removed {
+			p := k
+			p.Version = v
+			ev.Removed = append(ev.Removed, p)
+		}
+	}
+	for dist := range dists {
+		ev.Dists = append(ev.Dists, dist)
+	}
+	sort.Strings(ev.Dists)
+	for _, ps := range [][]PublishPackage{ev.Added, ev.Removed, ev.Upgraded} {
+		sort.Slice(ps, func(i, j int) bool {
+			a, b := ps[i], ps[j]
+			if a.Dist != b.Dist {
+				return a.Dist < b.Dist
+			}
+			if a.Component != b.Component {
+				return a.Component < b.Component
+			}
+			if a.Package != b.Package {
+				return a.Package < b.Package
+			}
+			if a.Architecture != b.Architecture {
+				return a.Architecture < b.Architecture
+			}
+			return debversion.Newer(b.Version, a.Version)
+		})
+	}
+	return ev
+}
+
+// readPublished reads the package versions (sorted, for each package without a
+// version) and the Release checksums from a generated repository.
+func readPublished(ctx context.Context, s storage.Storage) (map[PublishPackage][]string, map[string]PublishRelease, error) {
+	pkgs := map[PublishPackage][]string{}
+	release := map[string]PublishRelease{}
+
+	names, err := s.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if ok, _ := path.Match("dists/*/*/binary-*/Packages", name); !ok {
+			continue
+		}
+		compRoot := path.Dir(path.Dir(name))
+		buf, err := s.Get(ctx, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading index: %v", err)
+		}
+		cs, err := control.ParseAll(string(buf))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing index %s: %v", name, err)
+		}
+		for _, c := range cs {
+			k := PublishPackage{
+				Dist:         path.Base(path.Dir(compRoot)),
+				Component:    path.Base(compRoot),
+				Package:      c.MightGet("Package"),
+				Architecture: c.MightGet("Architecture"),
+			}
+			pkgs[k] = append(pkgs[k], c.MightGet("Version"))
+		}
+	}
+	for _, vs := range pkgs {
+		sort.Slice(vs, func(i, j int) bool {
+			return debversion.Newer(vs[j], vs[i])
+		})
+	}
+
+	for _, name := range names {
+		if ok, _ := path.Match("dists/*/Release", name); !ok {
+			continue
+		}
+		buf, err := s.Get(ctx, name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading release file: %v", err)
+		}
+		c, err := control.Parse(string(buf))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing release file %s: %v", name, err)
+		}
+		r := PublishRelease{
+			SHA256: fmt.Sprintf("%x", sha256.Sum256(buf)),
+			Files:  map[string]string{},
+		}
+		for _, line := range strings.Split(c.MightGet("SHA256"), "\n") {
+			if f := strings.Fields(line); len(f) == 3 {
+				r.Files[f[2]] = f[0]
+			}
+		}
+		release[path.Base(path.Dir(name))] = r
+	}
+	return pkgs, release, nil
+}
+
+// Hooks runs commands and webhooks when a new generation of the repository is
+// published.
+type Hooks struct {
+	PrePublish  []string      // shell commands to run before publishing, which can prevent it by failing
+	PostPublish []string      // shell commands to run after publishing
+	Webhooks    []string      // URLs to POST the PublishEvent to after publishing
+	Timeout     time.Duration // the maximum time for each command or webhook (0 for no limit)
+	Client      *http.Client  // the client for webhooks (optional)
+}
+
+// Empty checks if there aren't any hooks.
+func (h *Hooks) Empty() bool {
+	return len(h.PrePublish) == 0 && len(h.PostPublish) == 0 && len(h.Webhooks) == 0
+}
+
+// Publish runs the pre-publish hooks for the generated repository in root,
+// calls fn to publish it, then runs the post-publish hooks and webhooks. If a
+// pre-publish hook fails, fn isn't called and an error is returned. Errors
+// from the post-publish hooks and webhooks are only logged. prev is the
+// currently published repository (or empty if there isn't one).
+func (h *Hooks) Publish(prev, root string, fn func() error) error {
+	if h.Empty() {
+		return fn()
+	}
+
+	ev, err := newPublishEvent(prev, root)
+	if err != nil {
+		return fmt.Errorf("could not compare with previous generation: %v", err)
+	}
+	return h.publish(ev, prev, root, fn)
+}
+
+// publish is like Publish, but uses an existing event.
+func (h *Hooks) publish(ev *PublishEvent, prev, root string, fn func() error) error {
+	ev.Phase = "pre-publish"
+	for _, cmd := range h.PrePublish {
+		if err := h.run(cmd, ev, prev, root); err != nil {
+			return fmt.Errorf("pre-publish hook %#v failed: %v", cmd, err)
+		}
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	ev.Phase = "post-publish"
+	ev.Time = time.Now().UTC()
+	for _, cmd := range h.PostPublish {
+		if err := h.run(cmd, ev, prev, root); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: post-publish hook %#v failed: %v\n", cmd, err)
+		}
+	}
+	for _, url := range h.Webhooks {
+		if err := h.post(url, ev); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: webhook %s failed: %v\n", url, err)
+		}
+	}
+	return nil
+}
+
+// run runs a hook command with the event on stdin.
+func (h *Hooks) run(cmd string, ev *PublishEvent, prev, root string) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if h.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	c := exec.CommandContext(ctx, "sh", "-c", cmd)
+	c.Stdin = bytes.NewReader(buf)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = append(os.Environ(),
+		"REPOGEN_PHASE="+ev.Phase,
+		"REPOGEN_OUTPUT_DIR="+root,
+		"REPOGEN_PREVIOUS_DIR="+prev,
+		"REPOGEN_DISTS="+strings.Join(ev.Dists, " "),
+	)
+	return c.Run()
+}
+
+// post POSTs the event to a webhook.
+func (h *Hooks) post(url string, ev *PublishEvent) error {
+	buf, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if h.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "repogen/"+version)
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("response status %s", resp.Status)
+	}
+	return nil
+}
+
+// stagedStorage wraps storage which is updated in-place (i.e. S3) so a new
+// version of the repository can be checked by the pre-publish hooks before
+// clients see it. Files outside the pool are kept in memory, and deletions are
+// deferred until Commit is called. Files in the pool are written directly,
+// since they aren't referenced by the published indexes until then.
+type stagedStorage struct {
+	storage.Storage
+	staged  map[string][]byte
+	deleted map[string]bool
+}
+
+func newStagedStorage(s storage.Storage) *stagedStorage {
+	return &stagedStorage{
+		Storage: s,
+		staged:  map[string][]byte{},
+		deleted: map[string]bool{},
+	}
+}
+
+// isStaged checks if a file is kept until Commit is called.
+func (s *stagedStorage) isStaged(name string) bool {
+	return !strings.HasPrefix(path.Clean(strings.TrimPrefix(name, "/")), "pool/")
+}
+
+// Put implements storage.Storage.
+func (s *stagedStorage) Put(ctx context.Context, name string, data []byte) error {
+	if !s.isStaged(name) {
+		return s.Storage.Put(ctx, name, data)
+	}
+	s.staged[name] = append([]byte(nil), data...)
+	delete(s.deleted, name)
+	return nil
+}
+
+// PutFile implements storage.Storage.
+func (s *stagedStorage) PutFile(ctx context.Context, name, fn string) error {
+	if !s.isStaged(name) {
+		return s.Storage.PutFile(ctx, name, fn)
+	}
+	buf, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", fn, err)
+	}
+	return s.Put(ctx, name, buf)
+}
+
+// Get implements storage.Storage.
+func (s *stagedStorage) Get(ctx context.Context, name string) ([]byte, error) {
+	if buf, ok := s.staged[name]; ok {
+		return buf, nil
+	}
+	return s.Storage.Get(ctx, name)
+}
+
+// List implements storage.Storage.
+func (s *stagedStorage) List(ctx context.Context) ([]string, error) {
+	names, err := s.Storage.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for name := range s.staged {
+		if !inSlice(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Delete implements storage.Storage.
+func (s *stagedStorage) Delete(ctx context.Context, name string) error {
+	s.deleted[name] = true
+	return nil
+}
+
+// Copy implements storage.Copier if the underlying storage does.
+func (s *stagedStorage) Copy(ctx context.Context, name, src string) error {
+	if cp, ok := s.Storage.(storage.Copier); ok && !s.isStaged(name) && !s.isStaged(src) {
+		return cp.Copy(ctx, name, src)
+	}
+	buf, err := s.Get(ctx, src)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, name, buf)
+}
+
+// Commit writes the staged files in the same order as the repository would
+// have (the other files and indexes, then Release and Release.gpg, and
+// InRelease last), then deletes the old files.
+func (s *stagedStorage) Commit(ctx context.Context) error {
+	order := func(name string) int {
+		if ok, _ := path.Match("dists/*/InRelease", name); ok {
+			return 2
+		}
+		if ok, _ := path.Match("dists/*/Release*", name); ok {
+			return 1
+		}
+		return 0
+	}
+	names := make([]string, 0, len(s.staged))
+	for name := range s.staged {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if a, b := order(names[i]), order(names[j]); a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		if err := s.Storage.Put(ctx, name, s.staged[name]); err != nil {
+			return err
+		}
+	}
+	for name := range s.deleted {
+		if err := s.Storage.Delete(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
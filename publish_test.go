@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pgaskin/repogen/storage"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+func TestPublish(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-publish")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	write := func(fn, contents string) {
+		fn = filepath.Join(td, filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, []byte(contents), 0644))
+	}
+	write("gen1/dists/stable/main/binary-amd64/Packages", "Package: foo\nVersion: 1.0\nArchitecture: amd64\n\nPackage: bar\nVersion: 1.0\nArchitecture: amd64\n\nPackage: baz\nVersion: 1.0\nArchitecture: amd64\n")
+	write("gen1/dists/stable/Release", "Suite: stable\nSHA256:\n aaaa 10 main/binary-amd64/Packages\n")
+	write("gen1/dists/testing/main/binary-amd64/Packages", "Package: foo\nVersion: 1.0\nArchitecture: amd64\n")
+	write("gen1/dists/testing/Release", "Suite: testing\n")
+	write("gen2/dists/stable/main/binary-amd64/Packages", "Package: foo\nVersion: 1.0\nArchitecture: amd64\n\nPackage: foo\nVersion: 1:0.9\nArchitecture: amd64\n\nPackage: bar\nVersion: 1.0-1\nArchitecture: amd64\n\nPackage: qux\nVersion: 1.0\nArchitecture: all\n")
+	write("gen2/dists/stable/Release", "Suite: stable\nSHA256:\n bbbb 20 main/binary-amd64/Packages\n cccc 30 main/binary-amd64/Packages.gz\n")
+	write("gen2/dists/testing/main/binary-amd64/Packages", "Package: foo\nVersion: 1.0\nArchitecture: amd64\n")
+	write("gen2/dists/testing/Release", "Suite: testing\n")
+
+	ev, err := newPublishEvent(filepath.Join(td, "gen1"), filepath.Join(td, "gen2"))
+	assert.NoError(t, err)
+	assert.Equal(t, "gen2", ev.Generation)
+	assert.Equal(t, []string{"stable"}, ev.Dists, "only dists with changes should be included")
+	assert.Equal(t, []PublishPackage{
+		{Dist: "stable", Component: "main", Package: "foo", Architecture: "amd64", Version: "1:0.9"},
+		{Dist: "stable", Component: "main", Package: "qux", Architecture: "all", Version: "1.0"},
+	}, ev.Added)
+	assert.Equal(t, []PublishPackage{
+		{Dist: "stable", Component: "main", Package: "baz", Architecture: "amd64", Version: "1.0"},
+	}, ev.Removed)
+	assert.Equal(t, []PublishPackage{
+		{Dist: "stable", Component: "main", Package: "bar", Architecture: "amd64", Version: "1.0-1", OldVersion: "1.0"},
+	}, ev.Upgraded)
+	assert.Equal(t, map[string]string{
+		"main/binary-amd64/Packages":    "bbbb",
+		"main/binary-amd64/Packages.gz": "cccc",
+	}, ev.Release["stable"].Files)
+	assert.Len(t, ev.Release["stable"].SHA256, 64)
+	assert.Contains(t, ev.Release, "testing", "release checksums should be included for all dists")
+
+	ev1, err := newPublishEvent("", filepath.Join(td, "gen1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stable", "testing"}, ev1.Dists, "everything should be added if there isn't a previous generation")
+	assert.Len(t, ev1.Added, 4)
+
+	var hooked []string
+	var payload PublishEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		hooked = append(hooked, "webhook")
+	}))
+	defer srv.Close()
+
+	fail := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "test", http.StatusInternalServerError)
+	}))
+	defer fail.Close()
+
+	h := &Hooks{
+		PrePublish:  []string{fmt.Sprintf("cat > %s/pre.json && test \"$REPOGEN_PHASE\" = pre-publish && test \"$REPOGEN_DISTS\" = stable", td)},
+		PostPublish: []string{fmt.Sprintf("cat > %s/post.json && test \"$REPOGEN_OUTPUT_DIR\" = %s/gen2", td, td), "exit 1"},
+		Webhooks:    []string{fail.URL, srv.URL},
+	}
+	assert.NoError(t, h.Publish(filepath.Join(td, "gen1"), filepath.Join(td, "gen2"), func() error {
+		assert.FileExists(t, filepath.Join(td, "pre.json"), "pre-publish hooks should run before publishing")
+		_, err := os.Stat(filepath.Join(td, "post.json"))
+		assert.True(t, os.IsNotExist(err), "post-publish hooks should run after publishing")
+		hooked = append(hooked, "publish")
+		return nil
+	}), "post-publish hook and webhook failures should be ignored")
+	assert.Equal(t, []string{"publish", "webhook"}, hooked)
+	assert.Equal(t, "post-publish", payload.Phase)
+	assert.Equal(t, []string{"stable"}, payload.Dists)
+	assert.Len(t, payload.Upgraded, 1)
+	assert.Equal(t, ev.Release, payload.Release)
+
+	buf, err := ioutil.ReadFile(filepath.Join(td, "pre.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), `"phase":"pre-publish"`, "hooks should get the event on stdin")
+
+	h.PrePublish = append(h.PrePublish, "exit 1")
+	err = h.Publish(filepath.Join(td, "gen1"), filepath.Join(td, "gen2"), func() error {
+		t.Errorf("pre-publish hooks should be able to prevent publishing")
+		return nil
+	})
+	assert.Error(t, err)
+}
+
+// orderStorage records the order of writes to a storage.Storage.
+type orderStorage struct {
+	storage.Storage
+	order []string
+}
+
+func (s *orderStorage) Put(ctx context.Context, name string, data []byte) error {
+	s.order = append(s.order, "put "+name)
+	return s.Storage.Put(ctx, name, data)
+}
+
+func (s *orderStorage) Delete(ctx context.Context, name string) error {
+	s.order = append(s.order, "delete "+name)
+	return s.Storage.Delete(ctx, name)
+}
+
+func TestStagedStorage(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-staged")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	ctx := context.Background()
+	st := &orderStorage{Storage: storage.NewLocal(td)}
+	assert.NoError(t, st.Put(ctx, "pool/old.deb", []byte("old")))
+	assert.NoError(t, st.Put(ctx, "dists/stable/main/binary-amd64/Packages", []byte("Package: foo\nVersion: 1.0\nArchitecture: amd64\n")))
+	assert.NoError(t, st.Put(ctx, "dists/stable/Release", []byte("Suite: stable\n")))
+	st.order = nil
+
+	s := newStagedStorage(st)
+	assert.NoError(t, s.Put(ctx, "pool/new.deb", []byte("new")))
+	assert.NoError(t, s.Put(ctx, "dists/stable/InRelease", []byte("new")))
+	assert.NoError(t, s.Put(ctx, "dists/stable/Release.gpg", []byte("new")))
+	assert.NoError(t, s.Put(ctx, "dists/stable/Release", []byte("Suite: stable\nSHA256:\n aaaa 10 main/binary-amd64/Packages\n")))
+	assert.NoError(t, s.Put(ctx, "dists/stable/main/binary-amd64/Packages", []byte("Package: foo\nVersion: 1.1\nArchitecture: amd64\n")))
+	assert.NoError(t, s.Delete(ctx, "pool/old.deb"))
+	assert.Equal(t, []string{"put pool/new.deb"}, st.order, "only files outside dists should be written before committing")
+
+	buf, err := s.Get(ctx, "dists/stable/Release")
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), "SHA256", "staged files should be readable")
+	names, err := s.List(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, names, "dists/stable/InRelease", "staged files should be listed")
+
+	published, _, err := readPublished(ctx, st)
+	assert.NoError(t, err)
+	pkgs, release, err := readPublished(ctx, s)
+	assert.NoError(t, err)
+	ev := comparePublished("s3://bucket", published, pkgs, release)
+	assert.Equal(t, []PublishPackage{
+		{Dist: "stable", Component: "main", Package: "foo", Architecture: "amd64", Version: "1.1", OldVersion: "1.0"},
+	}, ev.Upgraded)
+	assert.Equal(t, map[string]string{"main/binary-amd64/Packages": "aaaa"}, ev.Release["stable"].Files)
+
+	assert.NoError(t, s.Commit(ctx))
+	assert.Equal(t, []string{
+		"put pool/new.deb",
+		"put dists/stable/main/binary-amd64/Packages",
+		"put dists/stable/Release",
+		"put dists/stable/Release.gpg",
+		"put dists/stable/InRelease",
+		"delete pool/old.deb",
+	}, st.order, "the indexes should be written first, InRelease last, then old files should be deleted")
+	assert.FileExists(t, filepath.Join(td, "dists", "stable", "InRelease"))
+}
+
+func TestGenerateS3Hooks(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-s3")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		switch r.Method {
+		case http.MethodGet:
+			if key != "" {
+				if buf, ok := objects[key]; ok {
+					w.Write(buf)
+				} else {
+					w.WriteHeader(http.StatusNotFound)
+				}
+				return
+			}
+			fmt.Fprint(w, "<ListBucketResult>")
+			for k, buf := range objects {
+				if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+					fmt.Fprintf(w, `<Contents><Key>%s</Key><ETag>"%x"</ETag></Contents>`, k, md5.Sum(buf))
+				}
+			}
+			fmt.Fprint(w, "</ListBucketResult>")
+		case http.MethodPut:
+			if src := r.Header.Get("X-Amz-Copy-Source"); src != "" {
+				objects[key] = objects[strings.TrimPrefix(src, "/bucket/")]
+				fmt.Fprintf(w, `<CopyObjectResult><ETag>"%x"</ETag></CopyObjectResult>`, md5.Sum(objects[key]))
+				return
+			}
+			objects[key], _ = ioutil.ReadAll(r.Body)
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+
+	snapshot := func() map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		m := map[string]string{}
+		for k, buf := range objects {
+			if !strings.HasPrefix(k, "repo/pool/") {
+				m[k] = string(buf)
+			}
+		}
+		return m
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	e, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	kb := new(bytes.Buffer)
+	aw, err := armor.Encode(kb, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, e.SerializePrivate(aw, nil))
+	assert.NoError(t, aw.Close())
+
+	write := func(fn, pkg string) {
+		fn = filepath.Join(td, "in", filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, testDeb(t, "Package: "+pkg+"\nVersion: 1.0\nArchitecture: amd64\nDescription: test\n"), 0644))
+	}
+	write("stable/main/foo_1.0_amd64.deb", "foo")
+
+	o := &repoOptions{
+		GenerateWeb: true,
+		S3Endpoint:  srv.URL,
+		S3PathStyle: true,
+		Hooks:       Hooks{PrePublish: []string{"true"}},
+	}
+	outRoot := "s3://bucket/repo"
+	_, err = o.generate(kb.String(), filepath.Join(td, "in"), outRoot, "", nil, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	published := snapshot()
+	assert.Contains(t, published, "repo/key.asc")
+	assert.Contains(t, published, "repo/packages/index.html")
+	assert.Contains(t, published["repo/dists/stable/main/binary-amd64/Packages"], "Package: foo")
+
+	write("stable/main/bar_1.0_amd64.deb", "bar")
+	assert.NoError(t, os.Remove(filepath.Join(td, "in", "stable", "main", "foo_1.0_amd64.deb")))
+	o.Hooks.PrePublish = []string{"exit 1"}
+	_, err = o.generate(kb.String(), filepath.Join(td, "in"), outRoot, "", nil, nil)
+	assert.Error(t, err, "the pre-publish hook should prevent publishing")
+	assert.Equal(t, published, snapshot(), "nothing outside the pool should change if a pre-publish hook fails")
+	mu.Lock()
+	assert.Contains(t, objects, "repo/pool/main/f/foo/foo_1.0_amd64.deb", "old packages shouldn't be deleted if a pre-publish hook fails")
+	mu.Unlock()
+
+	o.Hooks.PrePublish = []string{"true"}
+	_, err = o.generate(kb.String(), filepath.Join(td, "in"), outRoot, "", nil, nil)
+	assert.NoError(t, err)
+	assert.Contains(t, snapshot()["repo/dists/stable/main/binary-amd64/Packages"], "Package: bar")
+	mu.Lock()
+	assert.NotContains(t, objects, "repo/pool/main/f/foo/foo_1.0_amd64.deb", "old packages should be deleted once published")
+	mu.Unlock()
+}
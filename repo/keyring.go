@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+)
+
+var pkgNameRe = regexp.MustCompile("[^a-z0-9+.-]+")
+
+// KeyringPackageName returns the name of the keyring package.
+func (r *Repo) KeyringPackageName() string {
+	return r.packagePrefix() + "-archive-keyring"
+}
+
+// SetupPackageName returns the name of the setup package.
+func (r *Repo) SetupPackageName() string {
+	return r.packagePrefix() + "-repo"
+}
+
+// KeyringPath returns the path the keyring package installs the public key to.
+func (r *Repo) KeyringPath() string {
+	return "/usr/share/keyrings/" + r.KeyringPackageName() + ".gpg"
+}
+
+// packagePrefix returns the origin as a package name.
+func (r *Repo) packagePrefix() string {
+	if p := strings.Trim(pkgNameRe.ReplaceAllString(strings.ToLower(r.Origin), "-"), "+.-"); p != "" {
+		return p
+	}
+	return "repogen"
+}
+
+// MakeKeyring builds the keyring package if KeyringPackage or SetupPackage is
+// set (and the setup package if SetupPackage is set), and adds them to the
+// pool and KeyringComponent (or main, or the first component) of each dist. It
+// must be called after scanning and before MakePool. If a package with the
+// same name was already scanned, it is left as-is.
+//
+// The keyring package installs the public key to KeyringPath. The setup
+// package depends on it, and installs a deb822 sources file for the dist to
+// /etc/apt/sources.list.d/ which uses it for Signed-By. The packages are
+// versioned by the creation date of the signing key unless KeyringVersion is
+// set, and are identical every time they are built.
+func (r *Repo) MakeKeyring(ctx context.Context) error {
+	if !r.KeyringPackage && !r.SetupPackage {
+		return nil
+	}
+	if r.Storage == nil {
+		return errors.New("no out dir")
+	}
+	if r.signEntity == nil {
+		return errors.New("no signing key")
+	}
+	if r.SetupPackage && r.BaseURL == "" {
+		return errors.New("the base url is required for the setup package")
+	}
+
+	date := r.signEntity.PrimaryKey.CreationTime
+	ver := r.KeyringVersion
+	if ver == "" {
+		ver = date.UTC().Format("2006.01.02")
+	}
+
+	pub := new(bytes.Buffer)
+	if err := r.signEntity.Serialize(pub); err != nil {
+		return fmt.Errorf("error encoding pubkey: %v", err)
+	}
+
+	keyring, err := r.buildPackage(deb.BuildOptions{
+		Control: r.packageControl(r.KeyringPackageName(), ver, "",
+			fmt.Sprintf("GnuPG archive key of the %s repository", r.packagePrefix()),
+			fmt.Sprintf("This package contains the key used to sign the %s repository, installed to %s.", r.packagePrefix(), r.KeyringPath())),
+		Files: []*deb.BuildFile{
+			{Name: r.KeyringPath(), Mode: 0644, Data: pub.Bytes()},
+		},
+		Date: date,
+	})
+	if err != nil {
+		return fmt.Errorf("error building keyring package: %v", err)
+	}
+
+	for _, distName := range sortedKeys(r.Dists) {
+		dist := r.Dists[distName]
+		compNames := sortedKeys(dist)
+		if len(compNames) == 0 {
+			continue
+		}
+		compName := r.KeyringComponent
+		if compName == "" {
+			compName = compNames[0]
+			if _, ok := dist["main"]; ok {
+				compName = "main"
+			}
+		} else if _, ok := dist[compName]; !ok {
+			return fmt.Errorf("no such component %#v in dist %s for keyring package", compName, distName)
+		}
+
+		pkgs := []*generatedDeb{keyring}
+		if r.SetupPackage {
+			sources := control.New()
+			sources.Set("Types", "deb")
+			sources.Set("URIs", r.BaseURL)
+			sources.Set("Suites", distName)
+			sources.Set("Components", strings.Join(compNames, " "))
+			sources.Set("Signed-By", r.KeyringPath())
+
+			setup, err := r.buildPackage(deb.BuildOptions{
+				Control: r.packageControl(r.SetupPackageName(), ver+"+"+strings.Replace(distName, "-", ".", -1), r.KeyringPackageName(),
+					fmt.Sprintf("apt sources for the %s repository (%s)", r.packagePrefix(), distName),
+					fmt.Sprintf("This package adds the %s dist of the %s repository at %s to apt.", distName, r.packagePrefix(), r.BaseURL)),
+				Files: []*deb.BuildFile{
+					{Name: "/etc/apt/sources.list.d/" + r.packagePrefix() + ".sources", Mode: 0644, Data: []byte(sources.String()), Conffile: true},
+				},
+				Date: date,
+			})
+			if err != nil {
+				return fmt.Errorf("error building setup package: %v", err)
+			}
+			pkgs = append(pkgs, setup)
+		}
+
+		comp := append([]*deb.Deb{}, dist[compName]...)
+		for _, g := range pkgs {
+			d := g.Deb
+			var exists bool
+			for _, e := range comp {
+				if e.Package() == d.Package() {
+					exists = true
+					break
+				}
+			}
+			if exists {
+				r.warn(fmt.Sprintf("not adding generated package %s to %s/%s, since it already has a package with the same name", d.Package(), distName, compName))
+				continue
+			}
+			if err := r.Put(ctx, r.PoolPath(compName, d), g.raw); err != nil {
+				return fmt.Errorf("error writing package file: %v", err)
+			}
+			comp = append(comp, d)
+		}
+		sortDebs(comp)
+		dist[compName] = comp
+	}
+	return nil
+}
+
+// packageControl returns the control for a generated package.
+func (r *Repo) packageControl(name, ver, depends, summary, description string) *control.Control {
+	c := control.New()
+	c.Set("Package", name)
+	c.Set("Version", ver)
+	c.Set("Architecture", "all")
+	if depends != "" {
+		c.Set("Depends", depends)
+	}
+	c.Set("Priority", "optional")
+	c.Set("Section", "misc")
+	c.Set("Description", summary+"\n"+description)
+	return c
+}
+
+// generatedDeb is a package built by repogen. Filename is not set.
+type generatedDeb struct {
+	*deb.Deb
+	raw []byte
+}
+
+// buildPackage builds a generated package.
+func (r *Repo) buildPackage(opts deb.BuildOptions) (*generatedDeb, error) {
+	buf := new(bytes.Buffer)
+	if err := deb.Build(buf, opts); err != nil {
+		return nil, err
+	}
+	d, err := deb.Read(bytes.NewReader(buf.Bytes()), r.GenerateContents, r.GenerateChangelogs)
+	if err != nil {
+		return nil, err
+	}
+	return &generatedDeb{d, buf.Bytes()}, nil
+}
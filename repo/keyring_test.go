@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/repogen/deb"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+func TestMakeKeyring(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-keyring")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	e, err := openpgp.NewEntity("test", "", "test@example.com", &packet.Config{
+		Time: func() time.Time { return time.Unix(1700000000, 0) },
+	})
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	kb := new(bytes.Buffer)
+	aw, err := armor.Encode(kb, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, e.SerializePrivate(aw, nil))
+	assert.NoError(t, aw.Close())
+
+	for fn, pkg := range map[string]string{
+		"stable/main/foo_1.0_amd64.deb":      "foo",
+		"stable/contrib/bar_1.0_amd64.deb":   "bar",
+		"testing/contrib/bar_1.0_amd64.deb":  "bar",
+		"testing/non-free/baz_1.0_amd64.deb": "baz",
+		"other/main/a_1.0_all.deb":           "my-archive-keyring",
+	} {
+		fn = filepath.Join(td, "in", filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, testDeb(t, "Package: "+pkg+"\nVersion: 1.0\nArchitecture: amd64\n"), 0644))
+	}
+
+	var warnings []string
+	ctx := context.Background()
+	r, err := New(Options{
+		InRoot:         filepath.Join(td, "in"),
+		OutRoot:        filepath.Join(td, "out"),
+		SignKey:        kb.String(),
+		KeyringPackage: true,
+		SetupPackage:   true,
+		BaseURL:        "https://example.com/repo",
+		Origin:         "My Repo",
+		Warn:           func(msg string) { warnings = append(warnings, msg) },
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "my-repo-archive-keyring", r.KeyringPackageName())
+	assert.Equal(t, "my-repo-repo", r.SetupPackageName())
+
+	assert.NoError(t, r.Scan(ctx))
+	assert.NoError(t, r.MakeKeyring(ctx))
+	assert.NoError(t, r.MakePool(ctx))
+
+	pkgs := func(dist, comp string) []string {
+		var pkgs []string
+		for _, d := range r.Dists[dist][comp] {
+			pkgs = append(pkgs, d.Package()+" "+d.Version())
+		}
+		return pkgs
+	}
+	assert.Equal(t, []string{"foo 1.0", "my-repo-archive-keyring 2023.11.14", "my-repo-repo 2023.11.14+stable"}, pkgs("stable", "main"), "the packages should be added to main")
+	assert.Equal(t, []string{"bar 1.0", "my-repo-archive-keyring 2023.11.14", "my-repo-repo 2023.11.14+testing"}, pkgs("testing", "contrib"), "the packages should be added to the first component if there isn't a main one")
+	assert.Empty(t, warnings)
+
+	d, err := deb.Open(filepath.Join(td, "out", filepath.FromSlash(r.PoolPath("main", r.Dists["stable"]["main"][2]))), true, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "my-repo-archive-keyring", d.Control.MightGet("Depends"))
+		assert.Equal(t, "etc/apt/sources.list.d/my-repo.sources", d.Contents[len(d.Contents)-1].Name)
+	}
+
+	d, err = deb.Open(filepath.Join(td, "out", filepath.FromSlash(r.PoolPath("contrib", r.Dists["testing"]["contrib"][1]))), true, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "usr/share/keyrings/my-repo-archive-keyring.gpg", d.Contents[len(d.Contents)-1].Name)
+	}
+
+	// the generated packages shouldn't be reused when rescanning
+	prev := r.Dists
+	assert.NoError(t, r.ScanChanged(ctx, prev, []string{}))
+	assert.Len(t, r.Dists["stable"]["main"], 1)
+	assert.NoError(t, r.MakeKeyring(ctx))
+	assert.Len(t, r.Dists["stable"]["main"], 3)
+
+	// existing packages should be kept
+	r.Origin = "my"
+	r.SetupPackage = false
+	assert.NoError(t, r.Scan(ctx))
+	assert.NoError(t, r.MakeKeyring(ctx))
+	assert.Equal(t, []string{"my-archive-keyring 1.0"}, pkgs("other", "main"))
+	assert.Len(t, warnings, 1)
+
+	r.KeyringComponent = "contrib"
+	assert.Error(t, r.MakeKeyring(ctx), "the component should exist in every dist")
+
+	r.SetupPackage, r.BaseURL = true, ""
+	assert.Error(t, r.MakeKeyring(ctx), "the base url should be required for the setup package")
+}
@@ -0,0 +1,194 @@
+package repo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+)
+
+// Override changes a field of the matching packages in the indexes and the web
+// interface. Overrides are applied in order.
+type Override struct {
+	Scope   string // DIST or DIST/COMPONENT pattern (a pattern without a slash matches all components)
+	Package string // package name pattern
+	Field   string // the field to set, or a field name pattern if Remove is set
+	Value   string
+	Remove  bool
+	Source  string // where the override is from (e.g. FILE:LINE), for warnings
+}
+
+// protectedFields are the index fields which can't be overridden, since apt
+// relies on them to identify and download packages.
+var protectedFields = []string{"Package", "Version", "Architecture", "Filename", "Size", "MD5sum", "SHA1", "SHA256", "SHA512"}
+
+// protectedField returns the protected field matching a field name or pattern,
+// if any.
+func protectedField(pattern string) (string, bool) {
+	for _, field := range protectedFields {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(field)); ok {
+			return field, true
+		}
+	}
+	return "", false
+}
+
+// LoadOverrides reads overrides for scope from a file (see ParseOverrides).
+func LoadOverrides(fn, scope string) ([]*Override, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseOverrides(f, fn, scope)
+}
+
+// ParseOverrides parses overrides for scope. Each line is a dpkg-scanpackages
+// style override, a field to set, or a field to remove:
+//
+//	PACKAGE PRIORITY SECTION [MAINTAINER]
+//	PACKAGE FIELD: VALUE
+//	PACKAGE -FIELD
+//
+// where PACKAGE and the field to remove are patterns, and the priority or
+// section can be - to leave them as-is. Empty lines and lines starting with #
+// are ignored. Patterns are matched using path.Match, and field names are
+// case-insensitive. Overrides can't set or remove the Package, Version,
+// Architecture, Filename, Size, or checksum fields.
+func ParseOverrides(r io.Reader, name, scope string) ([]*Override, error) {
+	if _, err := path.Match(scope, ""); err != nil {
+		return nil, fmt.Errorf("invalid scope %#v: %v", scope, err)
+	}
+
+	var overrides []*Override
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		spl := strings.Fields(line)
+		if len(spl) < 2 {
+			return nil, fmt.Errorf("line %d: expected a package and an override", n)
+		}
+		if _, err := path.Match(spl[0], ""); err != nil {
+			return nil, fmt.Errorf("line %d: invalid package pattern: %v", n, err)
+		}
+
+		add := func(field, value string, remove bool) {
+			overrides = append(overrides, &Override{
+				Scope:   scope,
+				Package: spl[0],
+				Field:   field,
+				Value:   value,
+				Remove:  remove,
+				Source:  fmt.Sprintf("%s:%d", name, n),
+			})
+		}
+
+		switch {
+		case strings.HasPrefix(spl[1], "-") && len(spl[1]) > 1:
+			if len(spl) != 2 {
+				return nil, fmt.Errorf("line %d: expected PACKAGE -FIELD", n)
+			}
+			if _, err := path.Match(spl[1][1:], ""); err != nil {
+				return nil, fmt.Errorf("line %d: invalid field pattern: %v", n, err)
+			}
+			if p, ok := protectedField(spl[1][1:]); ok {
+				return nil, fmt.Errorf("line %d: %s can't be removed", n, p)
+			}
+			add(spl[1][1:], "", true)
+		case strings.HasSuffix(spl[1], ":"):
+			field := strings.TrimSuffix(spl[1], ":")
+			if field == "" {
+				return nil, fmt.Errorf("line %d: empty field name", n)
+			}
+			value := strings.TrimSpace(strings.SplitN(line, ":", 2)[1])
+			if value == "" {
+				return nil, fmt.Errorf("line %d: empty value for %s (use -%s to remove it)", n, field, field)
+			}
+			if p, ok := protectedField(field); ok {
+				return nil, fmt.Errorf("line %d: %s can't be overridden", n, p)
+			}
+			add(field, value, false)
+		default:
+			if len(spl) < 3 {
+				return nil, fmt.Errorf("line %d: expected PACKAGE PRIORITY SECTION [MAINTAINER]", n)
+			}
+			if spl[1] != "-" {
+				add("Priority", spl[1], false)
+			}
+			if spl[2] != "-" {
+				add("Section", spl[2], false)
+			}
+			if len(spl) > 3 {
+				add("Maintainer", strings.Join(spl[3:], " "), false)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// match checks if the override applies to a package.
+func (o *Override) match(distName, compName, pkgName string) bool {
+	scope := o.Scope
+	if !strings.Contains(scope, "/") {
+		scope += "/*"
+	}
+	if ok, _ := path.Match(scope, distName+"/"+compName); !ok {
+		return false
+	}
+	ok, _ := path.Match(o.Package, pkgName)
+	return ok
+}
+
+// Control returns a copy of the control for a package in a dist and component
+// with MaintainerOverride and the Overrides applied. It also returns warnings
+// for overrides which contradict the package's own control.
+func (r *Repo) Control(distName, compName string, d *deb.Deb) (*control.Control, []string) {
+	c := d.Control.Clone()
+	if r.MaintainerOverride != "" {
+		c.Set("Maintainer", r.MaintainerOverride)
+	}
+
+	var warnings []string
+	for _, o := range r.Overrides {
+		if !o.match(distName, compName, d.Package()) {
+			continue
+		}
+		if o.Remove {
+			for field := range c.Values {
+				if ok, _ := path.Match(strings.ToLower(o.Field), strings.ToLower(field)); ok {
+					c.Delete(field)
+				}
+			}
+			continue
+		}
+		field := fieldName(c, o.Field)
+		if cur := d.Control.MightGet(fieldName(d.Control, o.Field)); cur != "" && cur != o.Value {
+			warnings = append(warnings, fmt.Sprintf("%s: %s %s in %s/%s has %s %#v, overriding with %#v", o.Source, d.Package(), d.Version(), distName, compName, field, cur, o.Value))
+		}
+		c.Set(field, o.Value)
+	}
+	return c, warnings
+}
+
+// fieldName returns the name of the existing field in c which matches name
+// case-insensitively, or name if there isn't one.
+func fieldName(c *control.Control, name string) string {
+	for _, field := range c.Order {
+		if strings.EqualFold(field, name) {
+			return field
+		}
+	}
+	return name
+}
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOverrides(t *testing.T) {
+	ov, err := ParseOverrides(strings.NewReader(`
+# comment
+foo optional utils
+lib* - libs Jane Doe <jane@example.com>
+foo Bugs: https://bugs.example.com/foo
+* -X-*
+`), "override", "stable")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []*Override{
+			{Scope: "stable", Package: "foo", Field: "Priority", Value: "optional", Source: "override:3"},
+			{Scope: "stable", Package: "foo", Field: "Section", Value: "utils", Source: "override:3"},
+			{Scope: "stable", Package: "lib*", Field: "Section", Value: "libs", Source: "override:4"},
+			{Scope: "stable", Package: "lib*", Field: "Maintainer", Value: "Jane Doe <jane@example.com>", Source: "override:4"},
+			{Scope: "stable", Package: "foo", Field: "Bugs", Value: "https://bugs.example.com/foo", Source: "override:5"},
+			{Scope: "stable", Package: "*", Field: "X-*", Remove: true, Source: "override:6"},
+		}, ov)
+	}
+
+	for _, c := range []struct {
+		in  string
+		err string
+	}{
+		{"foo", "line 1: expected a package and an override"},
+		{"foo optional", "line 1: expected PACKAGE PRIORITY SECTION [MAINTAINER]"},
+		{"foo Bugs:", "line 1: empty value for Bugs (use -Bugs to remove it)"},
+		{"foo -Bugs extra", "line 1: expected PACKAGE -FIELD"},
+		{"[ optional utils", "line 1: invalid package pattern: syntax error in pattern"},
+		{"foo Package: bar", "line 1: Package can't be overridden"},
+		{"foo version: 2.0", "line 1: Version can't be overridden"},
+		{"foo SHA256: abcd", "line 1: SHA256 can't be overridden"},
+		{"foo -Filename", "line 1: Filename can't be removed"},
+		{"foo -*", "line 1: Package can't be removed"},
+		{"foo -S*", "line 1: Size can't be removed"},
+		{"foo -MD5*", "line 1: MD5sum can't be removed"},
+		{"foo -filename", "line 1: Filename can't be removed"},
+		{"foo ARCHITECTURE: all", "line 1: Architecture can't be overridden"},
+	} {
+		_, err := ParseOverrides(strings.NewReader(c.in), "override", "stable")
+		assert.EqualError(t, err, c.err, c.in)
+	}
+}
+
+func TestControl(t *testing.T) {
+	ctrl, err := control.Parse("Package: foo\nVersion: 1.0\nArchitecture: amd64\nSection: admin\nMaintainer: John Doe <john@example.com>\nX-Build-Id: 1234\n")
+	if !assert.NoError(t, err) {
+		return
+	}
+	d := &deb.Deb{Control: ctrl}
+
+	r := &Repo{Options: Options{Overrides: []*Override{
+		{Scope: "stable/main", Package: "f*", Field: "Section", Value: "utils", Source: "override:1"},
+		{Scope: "stable", Package: "foo", Field: "Priority", Value: "optional", Source: "override:2"},
+		{Scope: "*", Package: "*", Field: "X-*", Remove: true, Source: "override:3"},
+		{Scope: "testing", Package: "*", Field: "Bugs", Value: "https://example.com", Source: "override:4"},
+		{Scope: "testing", Package: "foo", Field: "section", Value: "net", Source: "override:5"},
+		{Scope: "testing", Package: "foo", Field: "maintainer*", Remove: true, Source: "override:6"},
+	}}}
+
+	c, warnings := r.Control("stable", "main", d)
+	assert.Equal(t, "utils", c.MightGet("Section"), "fields should be overridden")
+	assert.Equal(t, "optional", c.MightGet("Priority"), "fields should be added")
+	assert.NotContains(t, c.Values, "X-Build-Id", "fields should be removed")
+	assert.NotContains(t, c.Order, "X-Build-Id", "fields should be removed")
+	assert.NotContains(t, c.Values, "Bugs", "overrides for other dists should not apply")
+	assert.Equal(t, []string{`override:1: foo 1.0 in stable/main has Section "admin", overriding with "utils"`}, warnings, "contradicting overrides should be warned about")
+	assert.Equal(t, "admin", d.Control.MightGet("Section"), "the original control should not be modified")
+
+	c, warnings = r.Control("stable", "contrib", d)
+	assert.Equal(t, "admin", c.MightGet("Section"), "overrides for other components should not apply")
+	assert.Empty(t, warnings)
+
+	c, warnings = r.Control("testing", "main", d)
+	assert.Equal(t, "net", c.MightGet("Section"), "field names should be case-insensitive")
+	assert.NotContains(t, c.Values, "section", "existing fields should be replaced")
+	assert.Equal(t, []string{`override:5: foo 1.0 in testing/main has Section "admin", overriding with "net"`}, warnings)
+	assert.NotContains(t, c.Values, "Maintainer", "field patterns should be case-insensitive")
+
+	r.Overrides = r.Overrides[:4]
+	r.MaintainerOverride = "Jane Doe <jane@example.com>"
+	c, _ = r.Control("testing", "main", d)
+	assert.Equal(t, "Jane Doe <jane@example.com>", c.MightGet("Maintainer"), "the maintainer override should apply")
+	assert.Equal(t, "https://example.com", c.MightGet("Bugs"))
+}
@@ -0,0 +1,289 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pgaskin/repogen/control"
+)
+
+// maxPDiffLines is the maximum number of changed lines in a PDiff. If there are
+// more, the history is discarded, and apt downloads the full index instead.
+const maxPDiffLines = 10000
+
+// pdiffIndex is a Packages.diff/Index file, which lists the patches to update
+// previous versions of an index to the current one, in the format used by dak
+// and apt.
+type pdiffIndex struct {
+	Current  string
+	History  []pdiffEntry // the index each patch applies to
+	Patches  []pdiffEntry // the uncompressed patches
+	Download []pdiffEntry // the compressed patches (NAME.gz)
+}
+
+// pdiffEntry is a file in a pdiffIndex.
+type pdiffEntry struct {
+	SHA256 string
+	Size   int
+	Name   string
+}
+
+// parsePDiffIndex parses a Packages.diff/Index file.
+func parsePDiffIndex(buf []byte) (*pdiffIndex, error) {
+	c, err := control.Parse(string(buf))
+	if err != nil {
+		return nil, err
+	}
+	idx := &pdiffIndex{Current: strings.TrimSpace(c.MightGet("SHA256-Current"))}
+	for _, f := range []struct {
+		field   string
+		entries *[]pdiffEntry
+	}{
+		{"SHA256-History", &idx.History},
+		{"SHA256-Patches", &idx.Patches},
+		{"SHA256-Download", &idx.Download},
+	} {
+		for _, line := range strings.Split(c.MightGet(f.field), "\n") {
+			spl := strings.Fields(line)
+			if len(spl) == 0 {
+				continue
+			}
+			if len(spl) != 3 {
+				return nil, fmt.Errorf("invalid %s line %#v", f.field, line)
+			}
+			size, err := strconv.Atoi(spl[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s line %#v: %v", f.field, line, err)
+			}
+			*f.entries = append(*f.entries, pdiffEntry{spl[0], size, spl[2]})
+		}
+	}
+	if len(idx.History) != len(idx.Patches) || len(idx.History) != len(idx.Download) {
+		return nil, errors.New("mismatched number of patches")
+	}
+	return idx, nil
+}
+
+// String encodes the index.
+func (idx *pdiffIndex) String() string {
+	c := control.New()
+	c.Set("SHA256-Current", idx.Current)
+	for _, f := range []struct {
+		field   string
+		entries []pdiffEntry
+	}{
+		{"SHA256-History", idx.History},
+		{"SHA256-Patches", idx.Patches},
+		{"SHA256-Download", idx.Download},
+	} {
+		var lines []string
+		for _, e := range f.entries {
+			lines = append(lines, fmt.Sprintf("%s % 8d %s", e.SHA256, e.Size, e.Name))
+		}
+		c.Set(f.field, "\n"+strings.Join(lines, "\n"))
+	}
+	return c.String()
+}
+
+// makePDiffs updates the PDiffs in dir (e.g. dists/stable/main/binary-amd64/
+// Packages.diff) for the new version of an index, keeping the last r.PDiffs
+// patches. It returns the new Index, or nil if there isn't one.
+func (r *Repo) makePDiffs(ctx context.Context, dir string, cur []byte) ([]byte, error) {
+	prev := r.Previous
+	if prev == nil {
+		prev = r.Storage
+	}
+
+	old, err := prev.Get(ctx, path.Join(path.Dir(dir), strings.TrimSuffix(path.Base(dir), ".diff")))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading previous index: %v", err)
+	}
+
+	idx := &pdiffIndex{}
+	if buf, err := prev.Get(ctx, path.Join(dir, "Index")); err == nil {
+		if idx, err = parsePDiffIndex(buf); err != nil {
+			return nil, fmt.Errorf("error parsing previous pdiff index: %v", err)
+		}
+		if idx.Current != fmt.Sprintf("%x %d", sha256.Sum256(old), len(old)) {
+			idx = &pdiffIndex{} // doesn't match the previous index
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading previous pdiff index: %v", err)
+	}
+
+	if !bytes.Equal(old, cur) {
+		patch, ok := edDiff(splitLines(string(old)), splitLines(string(cur)), maxPDiffLines)
+		if !ok {
+			return nil, nil
+		}
+		patchGz, err := gz([]byte(patch))
+		if err != nil {
+			return nil, fmt.Errorf("error compressing pdiff: %v", err)
+		}
+
+		date := r.Date
+		if date.IsZero() {
+			date = time.Now()
+		}
+		name := pdiffName(date)
+		for _, e := range idx.Patches {
+			if e.Name >= name {
+				name = pdiffName(date.Add(time.Second)) // must be unique and in order
+				date = date.Add(time.Second)
+			}
+		}
+
+		if err := r.Put(ctx, path.Join(dir, name+".gz"), patchGz); err != nil {
+			return nil, fmt.Errorf("error writing pdiff: %v", err)
+		}
+
+		idx.History = append(idx.History, pdiffEntry{fmt.Sprintf("%x", sha256.Sum256(old)), len(old), name})
+		idx.Patches = append(idx.Patches, pdiffEntry{fmt.Sprintf("%x", sha256.Sum256([]byte(patch))), len(patch), name})
+		idx.Download = append(idx.Download, pdiffEntry{fmt.Sprintf("%x", sha256.Sum256(patchGz)), len(patchGz), name + ".gz"})
+		idx.Current = fmt.Sprintf("%x %d", sha256.Sum256(cur), len(cur))
+	}
+
+	if n := len(idx.Patches) - r.PDiffs; n > 0 {
+		idx.History, idx.Patches, idx.Download = idx.History[n:], idx.Patches[n:], idx.Download[n:]
+	}
+	if len(idx.Patches) == 0 {
+		return nil, nil
+	}
+
+	for _, e := range idx.Download {
+		name := path.Join(dir, e.Name)
+		if r.written[name] {
+			continue
+		}
+		buf, err := prev.Get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading previous pdiff: %v", err)
+		}
+		if err := r.Put(ctx, name, buf); err != nil {
+			return nil, fmt.Errorf("error writing pdiff: %v", err)
+		}
+	}
+
+	buf := []byte(idx.String())
+	if err := r.Put(ctx, path.Join(dir, "Index"), buf); err != nil {
+		return nil, fmt.Errorf("error writing pdiff index: %v", err)
+	}
+	return buf, nil
+}
+
+// pdiffName returns the name of a patch made at t.
+func pdiffName(t time.Time) string {
+	return t.UTC().Format("T-2006-01-02-1504.05")
+}
+
+// splitLines splits a file into lines without the trailing newlines.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// edDiff returns an ed script (like diff --ed) to change a into b, or false if
+// there are more than maxD changed lines or a line can't be represented.
+func edDiff(a, b []string, maxD int) (string, bool) {
+	type snake struct{ x, y, n int } // common lines a[x:x+n] == b[y:y+n]
+
+	// Myers' O(ND) diff algorithm, keeping v (indexed by k+d) for each d
+	var trace [][]int
+	n, m := len(a), len(b)
+	for d, done := 0, false; !done; d++ {
+		if d > maxD {
+			return "", false
+		}
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if d != 0 {
+				if pv := trace[d-1]; k == -d || (k != d && pv[k-1+d-1] < pv[k+1+d-1]) {
+					x = pv[k+1+d-1] // insertion
+				} else {
+					x = pv[k-1+d-1] + 1 // deletion
+				}
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+d] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+		trace = append(trace, v)
+	}
+
+	// walk back from the end to find the common lines
+	var snakes []snake
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		k, pv := x-y, trace[d-1]
+		var px, sx, sy int
+		if k == -d || (k != d && pv[k-1+d-1] < pv[k+1+d-1]) {
+			px = pv[k+1+d-1]
+			sx, sy = px, px-(k+1)+1
+			y = px - (k + 1)
+		} else {
+			px = pv[k-1+d-1]
+			sx, sy = px+1, px-(k-1)
+			y = px - (k - 1)
+		}
+		if x > sx {
+			snakes = append(snakes, snake{sx, sy, x - sx})
+		}
+		x = px
+	}
+	if x > 0 {
+		snakes = append(snakes, snake{0, 0, x})
+	}
+
+	// the hunks are written from the end, so the line numbers stay valid
+	var buf strings.Builder
+	ex, ey := n, m // end of the next hunk
+	for i := 0; i <= len(snakes); i++ {
+		sx, sy := 0, 0 // start of the next hunk
+		if i < len(snakes) {
+			sx, sy = snakes[i].x+snakes[i].n, snakes[i].y+snakes[i].n
+		}
+		if sx != ex || sy != ey {
+			switch {
+			case sx == ex:
+				fmt.Fprintf(&buf, "%da\n", sx)
+			case sx+1 == ex:
+				fmt.Fprintf(&buf, "%d%c\n", ex, "dc"[min(ey-sy, 1)])
+			default:
+				fmt.Fprintf(&buf, "%d,%d%c\n", sx+1, ex, "dc"[min(ey-sy, 1)])
+			}
+			if sy != ey {
+				for _, line := range b[sy:ey] {
+					if line == "." {
+						return "", false
+					}
+					buf.WriteString(line + "\n")
+				}
+				buf.WriteString(".\n")
+			}
+		}
+		if i < len(snakes) {
+			ex, ey = snakes[i].x, snakes[i].y
+		}
+	}
+	return buf.String(), true
+}
@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/repogen/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func testGunzip(buf []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return "", err
+	}
+	res, err := ioutil.ReadAll(zr)
+	return string(res), err
+}
+
+// testApplyEd applies an ed script in the subset of the format used by apt.
+func testApplyEd(lines []string, script string) ([]string, error) {
+	lines = append([]string{}, lines...)
+	cmds := splitLines(script)
+	for i := 0; i < len(cmds); i++ {
+		m := regexp.MustCompile(`^([0-9]+)(?:,([0-9]+))?([acd])$`).FindStringSubmatch(cmds[i])
+		if m == nil {
+			return nil, fmt.Errorf("invalid command %#v", cmds[i])
+		}
+		start, _ := strconv.Atoi(m[1])
+		end := start
+		if m[2] != "" {
+			end, _ = strconv.Atoi(m[2])
+		}
+		var text []string
+		if m[3] != "d" {
+			for i++; i < len(cmds) && cmds[i] != "."; i++ {
+				text = append(text, cmds[i])
+			}
+		}
+		switch m[3] {
+		case "a":
+			lines = append(lines[:start], append(text, lines[start:]...)...)
+		case "c":
+			lines = append(lines[:start-1], append(text, lines[end:]...)...)
+		case "d":
+			lines = append(lines[:start-1], lines[end:]...)
+		}
+	}
+	return lines, nil
+}
+
+func TestEdDiff(t *testing.T) {
+	patch, ok := edDiff(
+		[]string{"a", "b", "c", "d", "e", "f"},
+		[]string{"x", "a", "c", "d", "y", "z", "f", "g"},
+		100,
+	)
+	assert.True(t, ok)
+	assert.Equal(t, "6a\ng\n.\n5c\ny\nz\n.\n2d\n0a\nx\n.\n", patch, "the patch should be in the same format as diff --ed")
+
+	_, ok = edDiff([]string{"a"}, []string{"."}, 100)
+	assert.False(t, ok, "lines containing only a dot can't be represented")
+
+	_, ok = edDiff([]string{"a", "b", "c"}, []string{"d", "e", "f"}, 5)
+	assert.False(t, ok, "the diff should fail if there are too many changes")
+
+	patch, ok = edDiff(nil, nil, 0)
+	assert.True(t, ok)
+	assert.Empty(t, patch, "identical files should have an empty patch")
+
+	rnd := rand.New(rand.NewSource(1))
+	gen := func() []string {
+		lines := make([]string, rnd.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := gen(), gen()
+		patch, ok := edDiff(a, b, 100)
+		if !assert.True(t, ok) {
+			continue
+		}
+		res, err := testApplyEd(a, patch)
+		if assert.NoError(t, err) {
+			assert.Equal(t, strings.Join(b, "\n"), strings.Join(res, "\n"), "patch should produce the new file (%q -> %q)", a, b)
+		}
+	}
+}
+
+func TestMakePDiffs(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-pdiff")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	ctx := context.Background()
+	s := storage.NewLocal(filepath.Join(td, "out"))
+	r := &Repo{Options: Options{Storage: s, PDiffs: 2}}
+
+	update := func(date int64, packages string) string {
+		r.written = map[string]bool{}
+		r.Date = time.Unix(date, 0)
+		idx, err := r.makePDiffs(ctx, "dists/stable/main/binary-amd64/Packages.diff", []byte(packages))
+		assert.NoError(t, err)
+		assert.NoError(t, r.Put(ctx, "dists/stable/main/binary-amd64/Packages", []byte(packages)))
+		assert.NoError(t, r.Prune(ctx))
+		return string(idx)
+	}
+	sum := func(s string) string {
+		return fmt.Sprintf("%x % 8d", sha256.Sum256([]byte(s)), len(s))
+	}
+
+	v1 := "Package: a\nVersion: 1\n\nPackage: b\nVersion: 1\n\n"
+	v2 := "Package: a\nVersion: 2\n\nPackage: b\nVersion: 1\n\n"
+	v3 := "Package: a\nVersion: 2\n\nPackage: c\nVersion: 1\n\n"
+	v4 := "Package: a\nVersion: 3\n\nPackage: c\nVersion: 1\n\n"
+
+	assert.Empty(t, update(1700000000, v1), "there shouldn't be an index without a previous version")
+	assert.Empty(t, update(1700000000, v1), "there shouldn't be an index without any changes")
+
+	idx := update(1700000001, v2)
+	assert.Contains(t, idx, fmt.Sprintf("SHA256-Current: %x %d\n", sha256.Sum256([]byte(v2)), len(v2)))
+	assert.Contains(t, idx, "SHA256-History: \n "+sum(v1)+" T-2023-11-14-2213.21\n")
+
+	idx = update(1700000002, v3)
+	assert.Contains(t, idx, "SHA256-History: \n "+sum(v1)+" T-2023-11-14-2213.21\n "+sum(v2)+" T-2023-11-14-2213.22\n")
+	assert.Equal(t, idx, update(1700000003, v3), "the index should be kept if there aren't any changes")
+
+	idx = update(1700000004, v4)
+	assert.Contains(t, idx, "SHA256-History: \n "+sum(v2)+" T-2023-11-14-2213.22\n "+sum(v3)+" T-2023-11-14-2213.24\n", "old patches should be removed")
+	_, err = s.Get(ctx, "dists/stable/main/binary-amd64/Packages.diff/T-2023-11-14-2213.21.gz")
+	assert.True(t, os.IsNotExist(err), "old patches should be removed")
+
+	// apply the patches like apt would
+	cur := splitLines(v2)
+	for _, name := range []string{"T-2023-11-14-2213.22", "T-2023-11-14-2213.24"} {
+		buf, err := s.Get(ctx, "dists/stable/main/binary-amd64/Packages.diff/"+name+".gz")
+		if !assert.NoError(t, err) {
+			return
+		}
+		patch, err := testGunzip(buf)
+		if !assert.NoError(t, err) {
+			return
+		}
+		cur, err = testApplyEd(cur, patch)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, v4, strings.Join(cur, "\n")+"\n", "patches should produce the current index")
+
+	idx = update(1700000005, v4[:len(v4)-1]+".\n\n")
+	assert.Empty(t, idx, "the history should be discarded if a patch can't be made")
+}
@@ -0,0 +1,745 @@
+// Package repo generates signed apt repositories from a directory of deb
+// packages.
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/openpgp/armor"
+	"golang.org/x/crypto/openpgp/clearsign"
+	"golang.org/x/crypto/openpgp/packet"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/storage"
+	"github.com/pgaskin/repogen/version"
+	"github.com/ulikunitz/xz"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Options configures a Repo.
+type Options struct {
+	InRoot             string           // the dir containing the packages (in/DIST/COMPONENT/*.deb)
+	OutRoot            string           // the dir to generate the repository in, which must not exist (optional if only scanning or Storage is set)
+	Storage            storage.Storage  // where to write the repository (the default is local storage in OutRoot)
+	SignKey            string           // the ASCII-armored private key to sign the repository with (optional if only scanning)
+	GenerateContents   bool             // generate Contents indexes (this also reads the file lists for the web interface)
+	GenerateChangelogs bool             // extract the changelogs from the packages
+	Symlink            bool             // symlink the packages into the pool instead of copying them
+	Link               storage.LinkMode // how to add the packages to the pool with the default storage (ignored if Symlink is set)
+	PoolLayout         PoolLayout       // how to group the packages in the pool
+	Zstd               bool             // also generate zstd-compressed indexes
+	BaseURL            string           // the public URL of the repository (optional)
+	MaintainerOverride string           // replace the Maintainer field of all packages (optional)
+	Overrides          []*Override      // change the fields of packages (see Override)
+	Warn               func(msg string) // called for warnings (e.g. overrides which contradict a package) (the default prints them to stderr)
+	Date               time.Time        // the time to use for the Date field and signatures (the default is the current time)
+	PDiffs             int              // the number of PDiffs (Packages.diff) to keep for incremental updates (0 to disable)
+	KeyringPackage     bool             // generate a package with the public key (see MakeKeyring)
+	SetupPackage       bool             // also generate a package with the apt sources for each dist (requires BaseURL) (see MakeKeyring)
+	KeyringVersion     string           // the version of the generated packages (the default is the creation date of the signing key)
+	KeyringComponent   string           // the component to add the generated packages to (the default is main if it exists, or the first one)
+	Previous           storage.Storage  // the previously published repository to generate PDiffs against (the default is Storage, for updating in-place)
+	Origin             string
+	Description        string
+}
+
+// PoolLayout is how packages are grouped in the pool.
+type PoolLayout int
+
+const (
+	PoolByPackage PoolLayout = iota // pool/COMPONENT/LETTER/PACKAGE/
+	PoolBySource                    // pool/COMPONENT/LETTER/SOURCE/ (like the Debian archive)
+)
+
+// Repo generates an apt repository.
+type Repo struct {
+	Options
+	Dists map[string]map[string][]*deb.Deb // packages = Dists[dist][component] (sorted by name, version, then architecture)
+
+	signEntity *openpgp.Entity
+	written    map[string]bool // the files written to the storage
+}
+
+// New creates a new Repo. The paths in the options are made absolute.
+func New(opts Options) (*Repo, error) {
+	var err error
+
+	if opts.InRoot, err = filepath.Abs(opts.InRoot); err != nil {
+		return nil, fmt.Errorf("error resolving in path: %v", err)
+	}
+
+	if opts.Storage == nil && opts.OutRoot != "" {
+		if opts.OutRoot, err = filepath.Abs(opts.OutRoot); err != nil {
+			return nil, fmt.Errorf("error resolving out path: %v", err)
+		}
+
+		if _, err := os.Stat(opts.OutRoot); err == nil {
+			return nil, errors.New("out must not exist")
+		}
+
+		opts.Storage = &storage.Local{Root: opts.OutRoot, Mode: opts.Link}
+	}
+
+	r := &Repo{
+		Options: opts,
+		Dists:   map[string]map[string][]*deb.Deb{},
+		written: map[string]bool{},
+	}
+
+	if opts.SignKey != "" {
+		block, err := armor.Decode(strings.NewReader(opts.SignKey))
+		if err != nil {
+			return nil, fmt.Errorf("could not load private key: could not decode armor: %v", err)
+		}
+
+		if block.Type != openpgp.PrivateKeyType {
+			return nil, errors.New("could not load private key: no private key in decoded block")
+		}
+
+		pr := packet.NewReader(block.Body)
+		r.signEntity, err = openpgp.ReadEntity(pr)
+		if err != nil {
+			return nil, fmt.Errorf("could not load private key: could not read entity: %v", err)
+		}
+	}
+
+	return r, nil
+}
+
+// Clean removes the out dir.
+func (r *Repo) Clean() {
+	os.RemoveAll(r.OutRoot)
+}
+
+// Put writes a file to the storage. The name is relative to the root of the
+// repository.
+func (r *Repo) Put(ctx context.Context, name string, data []byte) error {
+	if r.Storage == nil {
+		return errors.New("no out dir")
+	}
+	if err := r.Storage.Put(ctx, name, data); err != nil {
+		return err
+	}
+	r.written[name] = true
+	return nil
+}
+
+// prunePaths are the files and dirs in the root of the repository which are
+// written by repogen (see Prune).
+var prunePaths = []string{"dists", "pool", "changelogs", "packages", ".web", "key.asc"}
+
+// Prune removes the files from the storage which weren't written by this Repo
+// (e.g. removed packages). Only files in prunePaths are removed, so unrelated
+// files sharing the storage (e.g. an S3 bucket) are left as-is. It should be
+// called last.
+func (r *Repo) Prune(ctx context.Context) error {
+	if r.Storage == nil {
+		return errors.New("no out dir")
+	}
+	names, err := r.Storage.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !r.written[name] && inSlice(prunePaths, strings.SplitN(name, "/", 2)[0]) {
+			if err := r.Storage.Delete(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// warn reports a warning.
+func (r *Repo) warn(msg string) {
+	if r.Warn != nil {
+		r.Warn(msg)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+}
+
+// Scan scans the in dir. Layout must be in/DIST/COMPONENT/*.deb. Hidden files
+// (e.g. incomplete uploads) are ignored.
+func (r *Repo) Scan(ctx context.Context) error {
+	return r.ScanChanged(ctx, nil, nil)
+}
+
+// ScanChanged is like Scan, but reuses the packages from prev (the Dists from a
+// previous scan) for the components which aren't in changed (DIST/COMPONENT).
+// If changed is nil, everything is rescanned.
+func (r *Repo) ScanChanged(ctx context.Context, prev map[string]map[string][]*deb.Deb, changed []string) error {
+	if changed == nil {
+		prev = nil
+	}
+
+	dists := map[string]map[string][]*deb.Deb{}
+
+	dfs, err := ioutil.ReadDir(r.InRoot)
+	if err != nil {
+		return fmt.Errorf("could not list in dir: %v", err)
+	}
+	for _, dfi := range dfs {
+		if IsHidden(dfi.Name()) {
+			continue
+		}
+		if !dfi.IsDir() {
+			return fmt.Errorf("could not scan in dir: not a dir: %s", filepath.Join(r.InRoot, dfi.Name()))
+		}
+		distName, distRoot := dfi.Name(), filepath.Join(r.InRoot, dfi.Name())
+		dists[distName] = map[string][]*deb.Deb{}
+
+		if !ValidName(distName) {
+			return fmt.Errorf("invalid dist name '%s': must match [a-z-]", distName)
+		}
+
+		cfs, err := ioutil.ReadDir(distRoot)
+		if err != nil {
+			return fmt.Errorf("could not list in dir subdir: %v", err)
+		}
+		for _, cfi := range cfs {
+			if IsHidden(cfi.Name()) {
+				continue
+			}
+			if !cfi.IsDir() {
+				return fmt.Errorf("could not scan in dir: not a dir: %s", filepath.Join(r.InRoot, dfi.Name(), cfi.Name()))
+			}
+			compName, compRoot := cfi.Name(), filepath.Join(distRoot, cfi.Name())
+			dists[distName][compName] = []*deb.Deb{}
+
+			if !ValidName(compName) {
+				return fmt.Errorf("invalid component name '%s': must match [a-z-]", compName)
+			}
+
+			if debs, ok := prev[distName][compName]; ok && !inSlice(changed, distName+"/"+compName) {
+				for _, d := range debs {
+					if d.Filename != "" { // not generated by MakeKeyring
+						dists[distName][compName] = append(dists[distName][compName], d)
+					}
+				}
+				continue
+			}
+
+			pfs, err := ioutil.ReadDir(compRoot)
+			if err != nil {
+				return fmt.Errorf("could not list in dir subdir: %v", err)
+			}
+			for _, pfi := range pfs {
+				if IsHidden(pfi.Name()) {
+					continue
+				}
+				if pfi.IsDir() || filepath.Ext(pfi.Name()) != ".deb" {
+					return fmt.Errorf("could not scan in dir: not a deb file: %s", filepath.Join(r.InRoot, dfi.Name(), cfi.Name(), pfi.Name()))
+				}
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				pkgFname := filepath.Join(compRoot, pfi.Name())
+
+				d, err := deb.Open(pkgFname, r.GenerateContents, r.GenerateChangelogs)
+				if err != nil {
+					return fmt.Errorf("could not read deb '%s': %v", pkgFname, err)
+				}
+				dists[distName][compName] = append(dists[distName][compName], d)
+			}
+			sortDebs(dists[distName][compName])
+		}
+	}
+
+	r.Dists = dists
+	return nil
+}
+
+// MakePool copies the deb files to the pool. It must be called before MakeDist
+// so the indexes never refer to packages which haven't been written yet. If the
+// same deb is in multiple components, it is only stored once if the storage
+// implements storage.Copier.
+func (r *Repo) MakePool(ctx context.Context) error {
+	if r.Storage == nil {
+		return errors.New("no out dir")
+	}
+
+	var lnk storage.Linker
+	if r.Symlink {
+		var ok bool
+		if lnk, ok = r.Storage.(storage.Linker); !ok {
+			return errors.New("storage does not support symlinks")
+		}
+	}
+
+	cp, _ := r.Storage.(storage.Copier)
+	stored := map[string]string{} // sha256 -> pool path
+
+	for _, distName := range sortedKeys(r.Dists) {
+		for _, compName := range sortedKeys(r.Dists[distName]) {
+			comp := r.Dists[distName][compName]
+			for _, d := range comp {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				// TODO: check if exists already, if it does, and has a different checksum, give an error, as packages with the same name/version/arch must be identical
+
+				name := r.PoolPath(compName, d)
+				if r.written[name] {
+					continue // same package in multiple dists
+				}
+
+				sum := d.Sums["SHA256"]
+				if lnk != nil {
+					if err := lnk.Symlink(ctx, name, d.Filename); err != nil {
+						return fmt.Errorf("error creating package symlink: %v", err)
+					}
+				} else if src, ok := stored[sum]; ok && cp != nil {
+					if err := cp.Copy(ctx, name, src); err != nil {
+						return fmt.Errorf("error writing package file: %v", err)
+					}
+				} else if err := r.Storage.PutFile(ctx, name, d.Filename); err != nil {
+					return fmt.Errorf("error writing package file: %v", err)
+				} else if sum != "" {
+					stored[sum] = name
+				}
+				r.written[name] = true
+			}
+		}
+	}
+	return nil
+}
+
+// MakeDist generates the indexes. For each dist, the Release files are written
+// after the indexes, and InRelease is written last. If PDiffs is set, patches
+// from the previous Packages indexes are also generated.
+func (r *Repo) MakeDist(ctx context.Context) error {
+	if r.Storage == nil {
+		return errors.New("no out dir")
+	}
+	if r.signEntity == nil {
+		return errors.New("no signing key")
+	}
+
+	date := r.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	config := &packet.Config{
+		Time: func() time.Time {
+			return date
+		},
+	}
+
+	for _, distName := range sortedKeys(r.Dists) {
+		dist := r.Dists[distName]
+		distRoot := path.Join("dists", distName)
+		var compNames, archNames, md5Sums, sha1Sums, sha256Sums, sha512Sums []string
+		addSums := func(name string, data []byte) {
+			md5Sums = append(md5Sums, fmt.Sprintf("%x % 8d %s", md5.Sum(data), len(data), name))
+			sha1Sums = append(sha1Sums, fmt.Sprintf("%x % 8d %s", sha1.Sum(data), len(data), name))
+			sha256Sums = append(sha256Sums, fmt.Sprintf("%x % 8d %s", sha256.Sum256(data), len(data), name))
+			sha512Sums = append(sha512Sums, fmt.Sprintf("%x % 8d %s", sha512.Sum512(data), len(data), name))
+		}
+		for _, compName := range sortedKeys(dist) {
+			comp := dist[compName]
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			compRoot := path.Join(distRoot, compName)
+			archs := map[string][]*deb.Deb{}
+			for _, d := range comp {
+				pkgArch := d.Architecture()
+				if _, ok := archs[pkgArch]; !ok {
+					archs[pkgArch] = []*deb.Deb{}
+				}
+				archs[pkgArch] = append(archs[pkgArch], d)
+			}
+			for _, archName := range sortedKeys(archs) {
+				arch := archs[archName]
+				archRoot := path.Join(compRoot, "binary-"+archName)
+				var packages strings.Builder
+				for _, d := range arch {
+					c, warnings := r.Control(distName, compName, d)
+					for _, w := range warnings {
+						r.warn(w)
+					}
+					c.MoveToOrderStart("Package")
+					c.Set("Size", fmt.Sprint(d.Size))
+					for _, field := range sortedKeys(d.Sums) {
+						c.Set(field, d.Sums[field])
+					}
+					c.Set("Filename", r.PoolPath(compName, d))
+					packages.WriteString(c.String() + "\n")
+				}
+				packagesBytes := []byte(packages.String())
+
+				if r.PDiffs > 0 {
+					// before writing Packages, since the previous one may be overwritten
+					idx, err := r.makePDiffs(ctx, path.Join(archRoot, "Packages.diff"), packagesBytes)
+					if err != nil {
+						return fmt.Errorf("error generating pdiffs: %v", err)
+					}
+					if idx != nil {
+						addSums(fmt.Sprintf("%s/binary-%s/Packages.diff/Index", compName, archName), idx)
+					}
+				}
+
+				addSums(fmt.Sprintf("%s/binary-%s/Packages", compName, archName), packagesBytes)
+				err := r.Put(ctx, path.Join(archRoot, "Packages"), packagesBytes)
+				if err != nil {
+					return fmt.Errorf("error writing packages file: %v", err)
+				}
+
+				gzb, err := gz(packagesBytes)
+				if err != nil {
+					return fmt.Errorf("error compressing packages file: %v", err)
+				}
+				addSums(fmt.Sprintf("%s/binary-%s/Packages.gz", compName, archName), gzb)
+				err = r.Put(ctx, path.Join(archRoot, "Packages.gz"), gzb)
+				if err != nil {
+					return fmt.Errorf("error writing packages.gz file: %v", err)
+				}
+
+				xzb, err := xzip(packagesBytes)
+				if err != nil {
+					return fmt.Errorf("error compressing packages file: %v", err)
+				}
+				addSums(fmt.Sprintf("%s/binary-%s/Packages.xz", compName, archName), xzb)
+				err = r.Put(ctx, path.Join(archRoot, "Packages.xz"), xzb)
+				if err != nil {
+					return fmt.Errorf("error writing packages.xz file: %v", err)
+				}
+
+				if r.Zstd {
+					zstb, err := zstdc(packagesBytes)
+					if err != nil {
+						return fmt.Errorf("error compressing packages file: %v", err)
+					}
+					addSums(fmt.Sprintf("%s/binary-%s/Packages.zst", compName, archName), zstb)
+					err = r.Put(ctx, path.Join(archRoot, "Packages.zst"), zstb)
+					if err != nil {
+						return fmt.Errorf("error writing packages.zst file: %v", err)
+					}
+				}
+
+				added := false
+				for _, an := range archNames {
+					if an == archName {
+						added = true
+						break
+					}
+				}
+				if !added {
+					archNames = append(archNames, archName)
+				}
+			}
+
+			if r.GenerateContents {
+				for _, archName := range sortedKeys(archs) {
+					arch := archs[archName]
+					var b strings.Builder
+					contents := map[string][]string{}
+					for _, d := range arch {
+						// qname is the qualified package name [$SECTION/]$NAME, with the
+						// overrides applied (the warnings were already reported)
+						c, _ := r.Control(distName, compName, d)
+						qname := d.Package()
+						if s, ok := c.Get("Section"); ok {
+							qname = s + "/" + qname
+						}
+						for _, f := range d.Contents {
+							if f.Mode.IsDir() {
+								continue
+							}
+							fn := f.Name
+							if _, ok := contents[fn]; !ok {
+								contents[fn] = []string{}
+							}
+							contents[fn] = append(contents[fn], qname)
+						}
+					}
+
+					fns := []string{}
+					for fn := range contents {
+						fns = append(fns, fn)
+					}
+					sort.Strings(fns)
+
+					for _, fn := range fns {
+						b.WriteString(fmt.Sprintf("%-56s %s\n", fn, strings.Join(contents[fn], ",")))
+					}
+
+					contentsBytes := []byte(b.String())
+					addSums(fmt.Sprintf("%s/Contents-%s", compName, archName), contentsBytes)
+
+					gzb, err := gz(contentsBytes)
+					if err != nil {
+						return fmt.Errorf("error compressing contents file: %v", err)
+					}
+					addSums(fmt.Sprintf("%s/Contents-%s.gz", compName, archName), gzb)
+					err = r.Put(ctx, path.Join(compRoot, "Contents-"+archName+".gz"), gzb)
+					if err != nil {
+						return fmt.Errorf("error writing contents-"+archName+".gz file: %v", err)
+					}
+
+					if r.Zstd {
+						zstb, err := zstdc(contentsBytes)
+						if err != nil {
+							return fmt.Errorf("error compressing contents file: %v", err)
+						}
+						addSums(fmt.Sprintf("%s/Contents-%s.zst", compName, archName), zstb)
+						err = r.Put(ctx, path.Join(compRoot, "Contents-"+archName+".zst"), zstb)
+						if err != nil {
+							return fmt.Errorf("error writing contents-"+archName+".zst file: %v", err)
+						}
+					}
+				}
+			}
+			compNames = append(compNames, compName)
+		}
+		release := control.New()
+		if r.Origin != "" {
+			release.Set("Origin", r.Origin)
+		}
+		release.Set("Suite", distName)
+		release.Set("Codename", distName)
+		release.Set("Date", date.UTC().Format("Mon, 02 Jan 2006 15:04:05 MST"))
+		sort.Strings(archNames)
+		release.Set("Components", strings.Join(compNames, " "))
+		release.Set("Architectures", strings.Join(archNames, " "))
+		release.Set("Description", r.Description)
+		if r.GenerateChangelogs && r.BaseURL != "" {
+			release.Set("Changelogs", strings.TrimRight(r.BaseURL, "/")+"/changelogs/@CHANGEPATH@_changelog")
+		}
+		release.Set("MD5Sum", "\n"+strings.Join(md5Sums, "\n"))
+		release.Set("SHA1", "\n"+strings.Join(sha1Sums, "\n"))
+		release.Set("SHA256", "\n"+strings.Join(sha256Sums, "\n"))
+		release.Set("SHA512", "\n"+strings.Join(sha512Sums, "\n"))
+		err := r.Put(ctx, path.Join(distRoot, "Release"), []byte(release.String()))
+		if err != nil {
+			return fmt.Errorf("error writing release file: %v", err)
+		}
+
+		releasegpg := new(bytes.Buffer)
+		err = openpgp.ArmoredDetachSign(releasegpg, r.signEntity, strings.NewReader(release.String()), config)
+		if err != nil {
+			return fmt.Errorf("error signing release file: %v", err)
+		}
+		err = r.Put(ctx, path.Join(distRoot, "Release.gpg"), releasegpg.Bytes())
+		if err != nil {
+			return fmt.Errorf("error writing release.gpg file: %v", err)
+		}
+
+		inrelease := new(bytes.Buffer)
+		dec, err := clearsign.Encode(inrelease, r.signEntity.PrivateKey, config)
+		if err != nil {
+			return fmt.Errorf("error clearsigning release file: %v", err)
+		}
+		if _, err := io.WriteString(dec, release.String()); err != nil {
+			return fmt.Errorf("error clearsigning release file: %v", err)
+		}
+		dec.Close()
+		err = r.Put(ctx, path.Join(distRoot, "InRelease"), inrelease.Bytes())
+		if err != nil {
+			return fmt.Errorf("error writing inrelease file: %v", err)
+		}
+	}
+	return nil
+}
+
+// MakeChangelogs writes the changelogs in the layout used by apt (i.e.
+// changelogs/COMPONENT/LETTER/SOURCE/SOURCE_VERSION_changelog, where VERSION
+// does not include the epoch).
+func (r *Repo) MakeChangelogs(ctx context.Context) error {
+	if r.Storage == nil {
+		return errors.New("no out dir")
+	}
+
+	for _, distName := range sortedKeys(r.Dists) {
+		for _, compName := range sortedKeys(r.Dists[distName]) {
+			comp := r.Dists[distName][compName]
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			for _, d := range comp {
+				if d.Changelog == "" {
+					continue
+				}
+
+				name := ChangelogPath(compName, d)
+				if r.written[name] {
+					continue // multiple binary packages from the same source
+				}
+
+				if err := r.Put(ctx, name, []byte(d.Changelog)); err != nil {
+					return fmt.Errorf("error writing changelog: %v", err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// PoolPath returns the path of a package in the pool relative to the root of
+// the repository.
+func (r *Repo) PoolPath(compName string, d *deb.Deb) string {
+	pkgName, dirName := d.Package(), d.Package()
+	if r.PoolLayout == PoolBySource {
+		dirName, _ = d.Source()
+	}
+	return fmt.Sprintf("pool/%s/%s/%s/%s_%s_%s.deb", compName, Letter(dirName), dirName, pkgName, d.Version(), d.Architecture())
+}
+
+// ChangelogPath returns the path of the changelog for a package relative to
+// the root of the repository.
+func ChangelogPath(compName string, d *deb.Deb) string {
+	srcName, srcVersion := d.Source()
+	if i := strings.Index(srcVersion, ":"); i >= 0 {
+		srcVersion = srcVersion[i+1:]
+	}
+	return fmt.Sprintf("changelogs/%s/%s/%s/%s_%s_changelog", compName, Letter(srcName), srcName, srcName, srcVersion)
+}
+
+// MakeRoot makes the files in the root of the repo.
+func (r *Repo) MakeRoot(ctx context.Context) error {
+	if r.Storage == nil {
+		return errors.New("no out dir")
+	}
+	if r.signEntity == nil {
+		return errors.New("no signing key")
+	}
+
+	w := new(bytes.Buffer)
+	aw, err := armor.Encode(w, "PGP PUBLIC KEY BLOCK", nil)
+	if err != nil {
+		return fmt.Errorf("error encoding pubkey: %v", err)
+	}
+
+	err = r.signEntity.Serialize(aw)
+	if err != nil {
+		return fmt.Errorf("error encoding pubkey: %v", err)
+	}
+	err = aw.Close()
+	if err != nil {
+		return fmt.Errorf("error encoding pubkey: %v", err)
+	}
+
+	err = r.Put(ctx, "key.asc", w.Bytes())
+	if err != nil {
+		return fmt.Errorf("error writing pubkey file: %v", err)
+	}
+
+	return nil
+}
+
+// Letter returns the dir in the pool for a package name. Like dak, names
+// starting with lib use the first four characters, unless the name is just lib.
+func Letter(pkg string) string {
+	if len(pkg) > 3 && strings.HasPrefix(pkg, "lib") {
+		return pkg[:4]
+	}
+	return pkg[:1]
+}
+
+// sortDebs sorts packages by name, version, then architecture.
+func sortDebs(debs []*deb.Deb) {
+	sort.SliceStable(debs, func(i, j int) bool {
+		a, b := debs[i], debs[j]
+		if a.Package() != b.Package() {
+			return a.Package() < b.Package()
+		}
+		if a.Version() != b.Version() {
+			return version.Newer(b.Version(), a.Version())
+		}
+		return a.Architecture() < b.Architecture()
+	})
+}
+
+// sortedKeys returns the sorted keys of a map.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func gz(data []byte) ([]byte, error) {
+	b := new(bytes.Buffer)
+	w := gzip.NewWriter(b)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func xzip(data []byte) ([]byte, error) {
+	b := new(bytes.Buffer)
+	w, err := xz.NewWriter(b)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func zstdc(data []byte) ([]byte, error) {
+	w, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+	return w.EncodeAll(data, nil), nil
+}
+
+// IsHidden checks if a file in the in dir should be ignored.
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+var nameRe = regexp.MustCompile("^[a-z-]+$")
+
+// ValidName checks if a dist or component name is valid.
+func ValidName(name string) bool {
+	return nameRe.MatchString(name)
+}
+
+func inSlice(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
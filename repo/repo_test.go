@@ -0,0 +1,368 @@
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/storage"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// testDeb builds a minimal deb with the specified control file.
+func testDeb(t *testing.T, control string) []byte {
+	tb := new(bytes.Buffer)
+	tw := tar.NewWriter(tb)
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "./control", Mode: 0644, Size: int64(len(control))}))
+	_, err := tw.Write([]byte(control))
+	assert.NoError(t, err)
+	assert.NoError(t, tw.Close())
+
+	ab := bytes.NewBufferString("!<arch>\n")
+	for _, m := range []struct {
+		name string
+		buf  []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", testGz(t, tb.Bytes())},
+		{"data.tar.gz", testGz(t, nil)},
+	} {
+		fmt.Fprintf(ab, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", m.name, 0, 0, 0, "100644", len(m.buf))
+		ab.Write(m.buf)
+		if len(m.buf)%2 == 1 {
+			ab.WriteByte('\n')
+		}
+	}
+	return ab.Bytes()
+}
+
+func testGz(t *testing.T, data []byte) []byte {
+	buf, err := gz(data)
+	assert.NoError(t, err)
+	return buf
+}
+
+func TestScanChanged(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-scan")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	write := func(fn, pkg string) {
+		fn = filepath.Join(td, filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, testDeb(t, "Package: "+pkg+"\nVersion: 1.0\nArchitecture: amd64\n"), 0644))
+	}
+	write("stable/main/foo_1.0_amd64.deb", "foo")
+	write("stable/contrib/bar_1.0_amd64.deb", "bar")
+
+	r, err := New(Options{InRoot: td})
+	assert.NoError(t, err)
+	assert.NoError(t, r.Scan(context.Background()))
+	prev := r.Dists
+
+	write("stable/main/baz_1.0_amd64.deb", "baz")
+	write("stable/contrib/qux_1.0_amd64.deb", "qux")
+	write("testing/main/foo_1.0_amd64.deb", "foo")
+
+	assert.NoError(t, r.ScanChanged(context.Background(), prev, []string{"stable/main"}))
+	assert.Len(t, r.Dists["stable"]["main"], 2, "changed components should be rescanned")
+	assert.Len(t, r.Dists["stable"]["contrib"], 1, "unchanged components should be reused")
+	assert.True(t, r.Dists["stable"]["contrib"][0] == prev["stable"]["contrib"][0], "unchanged components should be reused")
+	assert.Len(t, r.Dists["testing"]["main"], 1, "new components should be scanned")
+
+	assert.NoError(t, os.RemoveAll(filepath.Join(td, "stable", "contrib")))
+	assert.NoError(t, r.ScanChanged(context.Background(), prev, []string{}))
+	assert.NotContains(t, r.Dists["stable"], "contrib", "removed components should be removed")
+
+	assert.NoError(t, r.ScanChanged(context.Background(), prev, nil))
+	assert.Len(t, r.Dists["stable"]["main"], 2, "everything should be rescanned if changed is nil")
+}
+
+func TestMakePool(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-pool")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	buf := testDeb(t, "Package: foo\nVersion: 1.0\nArchitecture: amd64\n")
+	for _, fn := range []string{"stable/main/foo.deb", "stable/contrib/foo.deb", "testing/main/foo.deb"} {
+		fn = filepath.Join(td, "in", filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, buf, 0644))
+	}
+
+	r, err := New(Options{InRoot: filepath.Join(td, "in"), OutRoot: filepath.Join(td, "out")})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, r.Scan(context.Background()))
+	assert.NoError(t, r.MakePool(context.Background()))
+
+	a, err := os.Stat(filepath.Join(td, "out", "pool", "main", "f", "foo", "foo_1.0_amd64.deb"))
+	assert.NoError(t, err)
+	b, err := os.Stat(filepath.Join(td, "out", "pool", "contrib", "f", "foo", "foo_1.0_amd64.deb"))
+	assert.NoError(t, err)
+	assert.True(t, a != nil && b != nil && os.SameFile(a, b), "identical packages should only be stored once")
+}
+
+func TestPoolPath(t *testing.T) {
+	for _, c := range []struct {
+		layout  PoolLayout
+		control string
+		path    string
+	}{
+		{PoolByPackage, "Package: libfoo1\nSource: foo (1.2)\nVersion: 1.2-1\nArchitecture: amd64\n", "pool/main/libf/libfoo1/libfoo1_1.2-1_amd64.deb"},
+		{PoolBySource, "Package: libfoo1\nSource: foo (1.2)\nVersion: 1.2-1\nArchitecture: amd64\n", "pool/main/f/foo/libfoo1_1.2-1_amd64.deb"},
+		{PoolBySource, "Package: foo-utils\nSource: libfoo\nVersion: 1.2-1\nArchitecture: amd64\n", "pool/main/libf/libfoo/foo-utils_1.2-1_amd64.deb"},
+		{PoolBySource, "Package: bar\nVersion: 1.0\nArchitecture: all\n", "pool/main/b/bar/bar_1.0_all.deb"},
+		{PoolByPackage, "Package: lib\nVersion: 1.0\nArchitecture: all\n", "pool/main/l/lib/lib_1.0_all.deb"},
+		{PoolBySource, "Package: lib-utils\nSource: lib\nVersion: 1.0\nArchitecture: all\n", "pool/main/l/lib/lib-utils_1.0_all.deb"},
+		{PoolBySource, "Package: foo\nSource: (1.2)\nVersion: 1.2-1\nArchitecture: all\n", "pool/main/f/foo/foo_1.2-1_all.deb"},
+	} {
+		ctrl, err := control.Parse(c.control)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		r := &Repo{Options: Options{PoolLayout: c.layout}}
+		assert.Equal(t, c.path, r.PoolPath("main", &deb.Deb{Control: ctrl}))
+	}
+}
+
+func TestMakeChangelogs(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-changelogs")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	r, err := New(Options{InRoot: td, OutRoot: filepath.Join(td, "out")})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var debs []*deb.Deb
+	for _, c := range []string{
+		"Package: foo\nVersion: 1:1.0-1\nArchitecture: amd64\n",
+		"Package: foo-utils\nSource: foo\nVersion: 1:1.0-1\nArchitecture: amd64\n",
+		"Package: bar\nSource: (1.2)\nVersion: 1.2-1\nArchitecture: all\n",
+		"Package: libbaz1\nSource: libbaz (2.0)\nVersion: 2.0-1\nArchitecture: all\n",
+	} {
+		ctrl, err := control.Parse(c)
+		if !assert.NoError(t, err) {
+			return
+		}
+		d := &deb.Deb{Control: ctrl}
+		d.Changelog = d.Package() + " changelog"
+		debs = append(debs, d)
+	}
+	r.Dists = map[string]map[string][]*deb.Deb{"stable": {"main": debs}}
+
+	assert.NoError(t, r.MakeChangelogs(context.Background()), "packages without a source name shouldn't cause a panic")
+	for fn, exp := range map[string]string{
+		"changelogs/main/f/foo/foo_1.0-1_changelog":        "foo changelog",
+		"changelogs/main/b/bar/bar_1.2_changelog":          "bar changelog",
+		"changelogs/main/libb/libbaz/libbaz_2.0_changelog": "libbaz1 changelog",
+	} {
+		buf, err := ioutil.ReadFile(filepath.Join(td, "out", filepath.FromSlash(fn)))
+		assert.NoError(t, err, fn)
+		assert.Equal(t, exp, string(buf), "the first package from a source should be used (%s)", fn)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-prune")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	ctx := context.Background()
+	s := storage.NewLocal(filepath.Join(td, "out"))
+	assert.NoError(t, s.Put(ctx, "pool/main/o/old/old.deb", []byte("old")))
+	assert.NoError(t, s.Put(ctx, "key.asc", []byte("old")))
+	assert.NoError(t, s.Put(ctx, "packages/old/index.html", []byte("old")))
+	assert.NoError(t, s.Put(ctx, "index.html", []byte("unrelated")))
+	assert.NoError(t, s.Put(ctx, "backups/key.asc", []byte("unrelated")))
+	assert.NoError(t, s.Put(ctx, "pool.txt", []byte("unrelated")))
+
+	r, err := New(Options{InRoot: td, Storage: s})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, r.Put(ctx, "key.asc", []byte("new")))
+	assert.NoError(t, r.Put(ctx, "dists/stable/InRelease", []byte("new")))
+	assert.NoError(t, r.Prune(ctx))
+
+	names, err := s.List(ctx)
+	assert.NoError(t, err)
+	sort.Strings(names)
+	assert.Equal(t, []string{"backups/key.asc", "dists/stable/InRelease", "index.html", "key.asc", "pool.txt"}, names, "only written files and files not managed by repogen should be kept")
+}
+
+func TestContentsOverrides(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-contents")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	e, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	kb := new(bytes.Buffer)
+	aw, err := armor.Encode(kb, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, e.SerializePrivate(aw, nil))
+	assert.NoError(t, aw.Close())
+
+	ctrl, err := control.Parse("Package: foo\nVersion: 1.0\nArchitecture: amd64\nSection: admin\n")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var warnings []string
+	r, err := New(Options{
+		InRoot:           td,
+		OutRoot:          filepath.Join(td, "out"),
+		SignKey:          kb.String(),
+		GenerateContents: true,
+		Overrides:        []*Override{{Scope: "stable", Package: "foo", Field: "Section", Value: "utils", Source: "override:1"}},
+		Warn: func(msg string) {
+			warnings = append(warnings, msg)
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r.Dists = map[string]map[string][]*deb.Deb{"stable": {"main": {{
+		Control:  ctrl,
+		Contents: []*deb.File{{Name: "usr/bin", Mode: os.ModeDir | 0755}, {Name: "usr/bin/foo", Mode: 0755}},
+	}}}}
+	if !assert.NoError(t, r.MakeDist(context.Background())) {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(filepath.Join(td, "out", "dists", "stable", "main", "binary-amd64", "Packages"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), "Section: utils\n")
+
+	zbuf, err := ioutil.ReadFile(filepath.Join(td, "out", "dists", "stable", "main", "Contents-amd64.gz"))
+	if assert.NoError(t, err) {
+		zr, err := gzip.NewReader(bytes.NewReader(zbuf))
+		if assert.NoError(t, err) {
+			buf, err := ioutil.ReadAll(zr)
+			assert.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("%-56s %s\n", "usr/bin/foo", "utils/foo"), string(buf), "the overridden section should be used")
+		}
+	}
+	assert.Len(t, warnings, 1, "warnings should only be reported once")
+}
+
+func TestReproducible(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-reproducible")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	e, err := openpgp.NewEntity("test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatalf("could not generate key: %v", err)
+	}
+	kb := new(bytes.Buffer)
+	aw, err := armor.Encode(kb, openpgp.PrivateKeyType, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, e.SerializePrivate(aw, nil))
+	assert.NoError(t, aw.Close())
+
+	for _, fn := range []string{
+		"stable/main/foo_1.1_amd64.deb",
+		"stable/main/foo_1.0_amd64.deb",
+		"stable/main/foo_1.0_i386.deb",
+		"stable/main/bar_2.0_all.deb",
+		"stable/main/libbaz_1.0_amd64.deb",
+		"stable/contrib/qux_1.0_amd64.deb",
+		"stable/non-free/quux_1.0_arm64.deb",
+		"testing/main/foo_1.10_amd64.deb",
+		"testing/main/foo_1.9_amd64.deb",
+	} {
+		spl := strings.Split(strings.TrimSuffix(path.Base(fn), ".deb"), "_")
+		fn = filepath.Join(td, "in", filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, testDeb(t, fmt.Sprintf("Package: %s\nVersion: %s\nArchitecture: %s\nSection: misc\n", spl[0], spl[1], spl[2])), 0644))
+	}
+
+	generate := func(out string) map[string]string {
+		ctx := context.Background()
+		r, err := New(Options{
+			InRoot:           filepath.Join(td, "in"),
+			OutRoot:          filepath.Join(td, out),
+			SignKey:          kb.String(),
+			GenerateContents: true,
+			Zstd:             true,
+			Origin:           "test",
+			Date:             time.Unix(1700000000, 0),
+		})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		assert.NoError(t, r.Scan(ctx))
+		assert.NoError(t, r.MakePool(ctx))
+		assert.NoError(t, r.MakeDist(ctx))
+		assert.NoError(t, r.MakeRoot(ctx))
+
+		files := map[string]string{}
+		assert.NoError(t, filepath.Walk(filepath.Join(td, out), func(fn string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			buf, err := ioutil.ReadFile(fn)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(filepath.Join(td, out), fn)
+			files[filepath.ToSlash(rel)] = string(buf)
+			return nil
+		}))
+		return files
+	}
+
+	a := generate("out1")
+	for i := 0; i < 3; i++ {
+		b := generate(fmt.Sprint("out", i+2))
+		assert.Equal(t, len(a), len(b), "same files should be generated")
+		for fn := range a {
+			assert.Equal(t, a[fn], b[fn], "%s should be identical", fn)
+		}
+	}
+
+	assert.Contains(t, a["dists/stable/Release"], "Date: Tue, 14 Nov 2023 22:13:20 UTC\n")
+	assert.Contains(t, a["dists/stable/Release"], "Components: contrib main non-free\n")
+	assert.Contains(t, a["dists/stable/Release"], "Architectures: all amd64 arm64 i386\n")
+
+	var pkgs []string
+	for _, line := range strings.Split(a["dists/testing/main/binary-amd64/Packages"], "\n") {
+		if strings.HasPrefix(line, "Version: ") {
+			pkgs = append(pkgs, strings.TrimPrefix(line, "Version: "))
+		}
+	}
+	assert.Equal(t, []string{"1.9", "1.10"}, pkgs, "packages should be sorted by version")
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// serveContentTypes are the content types for files in the repository which
+// aren't known (or are inconsistent between systems) in the mime package. They
+// are checked by the full file name first, then by the extension.
+var serveContentTypes = map[string]string{
+	"Release":     "text/plain; charset=utf-8",
+	"InRelease":   "text/plain; charset=utf-8",
+	"Packages":    "text/plain; charset=utf-8",
+	"Release.gpg": "application/pgp-signature",
+	".deb":        "application/vnd.debian.binary-package",
+	".asc":        "application/pgp-keys",
+	".gz":         "application/gzip",
+	".xz":         "application/x-xz",
+	".zst":        "application/zstd",
+	".json":       "application/json",
+	".js":         "application/javascript; charset=utf-8",
+	".css":        "text/css; charset=utf-8",
+	".html":       "text/html; charset=utf-8",
+	".woff2":      "font/woff2",
+}
+
+// serveListings are the directories (relative to the root) which have
+// directory listings.
+var serveListings = []string{"pool"}
+
+// Server serves a generated repository. The root can be changed while it is
+// running, and each request is served entirely from the root which was
+// current when it started.
+type Server struct {
+	AccessLog io.Writer     // where to write access logs in the combined log format (optional)
+	API       http.Handler  // handles requests under /api/ (optional)
+	Access    *Access       // restricts access to private dists and components (optional)
+	Status    func() Status // reported as JSON at /status (optional)
+
+	root atomic.Value // *serveRoot
+}
+
+// serveRoot is a generation of the repository being served.
+type serveRoot struct {
+	dir   string
+	once  sync.Once
+	index *accessIndex // built when first needed
+	err   error
+}
+
+// accessIndex returns the accessIndex for the root.
+func (sr *serveRoot) accessIndex() (*accessIndex, error) {
+	sr.once.Do(func() {
+		sr.index, sr.err = newAccessIndex(sr.dir)
+	})
+	return sr.index, sr.err
+}
+
+// NewServer creates a Server for the repository in root.
+func NewServer(root string) *Server {
+	s := &Server{
+		AccessLog: nil,
+		API:       nil,
+		Access:    nil,
+		Status:    nil,
+	}
+	s.SetRoot(root)
+	return s
+}
+
+// Root returns the current root.
+func (s *Server) Root() string {
+	return s.root.Load().(*serveRoot).dir
+}
+
+// SetRoot atomically switches to a new root.
+func (s *Server) SetRoot(root string) {
+	s.root.Store(&serveRoot{dir: root})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lw := &logResponseWriter{ResponseWriter: w, status: http.StatusOK}
+	start := time.Now()
+	if s.API != nil && (r.URL.Path == "/api" || strings.HasPrefix(r.URL.Path, "/api/")) {
+		s.API.ServeHTTP(lw, r)
+	} else if s.Status != nil && r.URL.Path == "/status" {
+		s.serveStatus(lw, r)
+	} else {
+		s.serve(lw, r)
+	}
+	if s.AccessLog != nil {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		user := "-"
+		if lw.user != "" {
+			user = lw.user
+		} else if u, _, ok := r.BasicAuth(); ok && u != "" {
+			user = u
+		}
+		referer, ua := "-", "-"
+		if r.Referer() != "" {
+			referer = r.Referer()
+		}
+		if r.UserAgent() != "" {
+			ua = r.UserAgent()
+		}
+		fmt.Fprintf(s.AccessLog, "%s - %s [%s] %q %d %d %q %q\n", host, user, start.Format("02/Jan/2006:15:04:05 -0700"), r.Method+" "+r.RequestURI+" "+r.Proto, lw.status, lw.size, referer, ua)
+	}
+}
+
+// serveStatus reports the status of the updates to the repository. It always
+// returns 200 OK if the server is running, since the last successful update is
+// still being served if later ones fail. If Access is set, anonymous users only
+// get the ok field, since errors may mention private dists and components.
+func (s *Server) serveStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var v interface{} = s.Status()
+	if s.Access != nil {
+		user, err := s.Access.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="repogen"`)
+			http.Error(w, "401 unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if user == nil {
+			v = map[string]bool{"ok": v.(Status).OK}
+		} else if lw, ok := w.(*logResponseWriter); ok {
+			lw.user = user.Name
+		}
+	}
+	buf, _ := json.MarshalIndent(v, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(append(buf, '\n'))
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sr := s.root.Load().(*serveRoot)
+	name := path.Clean("/" + r.URL.Path)
+	fn := filepath.Join(sr.dir, filepath.FromSlash(name))
+
+	for _, c := range strings.Split(name, "/") {
+		if strings.HasPrefix(c, ".") {
+			http.Error(w, "404 page not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	var (
+		user   *AccessUser
+		scopes []string
+		ix     *accessIndex
+	)
+	if s.Access != nil {
+		var err error
+		if user, err = s.Access.Authenticate(r); err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="repogen"`)
+			http.Error(w, "401 unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		} else if user != nil {
+			if lw, ok := w.(*logResponseWriter); ok {
+				lw.user = user.Name
+			}
+		}
+
+		if ix, err = sr.accessIndex(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not build access index for %s: %v\n", sr.dir, err)
+			http.Error(w, "500 internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if scopes = ix.scopes(strings.TrimPrefix(name, "/")); !s.Access.allowed(user, scopes) {
+			if user == nil {
+				w.Header().Set("WWW-Authenticate", `Basic realm="repogen"`)
+				http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "403 forbidden", http.StatusForbidden)
+			}
+			return
+		}
+
+		if name == "/packages" || strings.HasPrefix(name, "/packages/") {
+			// the web interface differs based on what the user can access
+			all := ix.all()
+			if v := s.Access.visible(user, all); !equalSlices(v, s.Access.visible(nil, all)) {
+				if vr := filepath.Join(sr.dir, ".web", accessViewName(v)); isDir(vr) {
+					fn = filepath.Join(vr, filepath.FromSlash(strings.TrimPrefix(name, "/packages")))
+				}
+			}
+			w.Header().Add("Vary", "Authorization")
+		}
+
+		if len(scopes) != 0 || user != nil {
+			w.Header().Add("Cache-Control", "private")
+		}
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+
+	if fi.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, path.Base(name)+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		if idx, err := os.Open(filepath.Join(fn, "index.html")); err == nil {
+			defer idx.Close()
+			if ifi, err := idx.Stat(); err == nil && ifi.Mode().IsRegular() {
+				serveFile(w, r, "index.html", ifi, idx)
+				return
+			}
+		}
+
+		for _, l := range serveListings {
+			if name == "/"+l || strings.HasPrefix(name, "/"+l+"/") {
+				serveListing(w, r, name, f, func(child string) bool {
+					return ix == nil || s.Access.allowed(user, ix.scopes(strings.TrimPrefix(name+"/"+child, "/")))
+				})
+				return
+			}
+		}
+
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+
+	if !fi.Mode().IsRegular() {
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, "../"+path.Base(name), http.StatusMovedPermanently)
+		return
+	}
+
+	serveFile(w, r, fi.Name(), fi, f)
+}
+
+// serveFile serves a file, handling Range, If-Modified-Since, and
+// If-None-Match. The ETag is based on the size and modification time, which
+// change whenever a file is regenerated.
+func serveFile(w http.ResponseWriter, r *http.Request, name string, fi os.FileInfo, f io.ReadSeeker) {
+	w.Header().Set("Content-Type", serveContentType(name))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()))
+	if name == "InRelease" || name == "Release" || name == "Release.gpg" || strings.HasPrefix(name, "Packages") || strings.HasPrefix(name, "Contents-") {
+		w.Header().Add("Cache-Control", "no-cache")
+	}
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+}
+
+// serveContentType returns the content type for a file name.
+func serveContentType(name string) string {
+	if ct, ok := serveContentTypes[name]; ok {
+		return ct
+	}
+	if strings.HasSuffix(name, "_changelog") {
+		return "text/plain; charset=utf-8"
+	}
+	ext := path.Ext(name)
+	if ct, ok := serveContentTypes[ext]; ok {
+		return ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+var serveListingTmpl = template.Must(template.New("").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8" />
+<title>Index of {{.Name}}</title>
+<style>body{font-family:monospace}td{padding:0 1em 0 0}.r{text-align:right}</style>
+</head>
+<body>
+<h1>Index of {{.Name}}</h1>
+<table>
+<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{range .Files}}<tr><td><a href="./{{.Name}}{{if .IsDir}}/{{end}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{.ModTime.UTC.Format "2006-01-02 15:04"}}</td><td class="r">{{if .IsDir}}-{{else}}{{.Size}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// serveListing serves a directory listing containing the entries which are
+// allowed by the filter.
+func serveListing(w http.ResponseWriter, r *http.Request, name string, f *os.File, filter func(string) bool) {
+	afis, err := f.Readdir(-1)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	fis := afis[:0]
+	for _, fi := range afis {
+		if strings.HasPrefix(fi.Name(), ".") || !filter(fi.Name()) {
+			continue
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if sfi, err := os.Stat(filepath.Join(f.Name(), fi.Name())); err == nil {
+				fi = sfi // for --symlink
+			}
+		}
+		fis = append(fis, fi)
+	}
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].Name() < fis[j].Name()
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := serveListingTmpl.Execute(w, map[string]interface{}{
+		"Name":  strings.TrimSuffix(name, "/") + "/",
+		"Files": fis,
+	}); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not render listing for %s: %v\n", name, err)
+	}
+}
+
+// serveError responds with an error for a failed file operation.
+func serveError(w http.ResponseWriter, err error) {
+	switch {
+	case os.IsNotExist(err):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case os.IsPermission(err):
+		http.Error(w, "403 forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 internal server error", http.StatusInternalServerError)
+	}
+}
+
+// logResponseWriter records the status and size of a response.
+type logResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+	user   string // the authenticated user, if any
+}
+
+func (w *logResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *logResponseWriter) Write(buf []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(buf)
+	w.size += int64(n)
+	return n, err
+}
+
+// switchGeneration atomically points the symlink at out to the generation dir
+// gen, which must be in the same directory. It returns the previous target, if
+// any.
+func switchGeneration(out, gen string) (string, error) {
+	prev, err := os.Readlink(out)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("error reading current generation: %v", err)
+	}
+	if prev != "" && !filepath.IsAbs(prev) {
+		prev = filepath.Join(filepath.Dir(out), prev)
+	}
+
+	tmp := out + ".gen-link"
+	if err := os.Remove(tmp); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("error removing temporary link: %v", err)
+	}
+	if err := os.Symlink(filepath.Base(gen), tmp); err != nil {
+		return "", fmt.Errorf("error creating link to new generation: %v", err)
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		os.Remove(tmp)
+		return "", fmt.Errorf("error switching to new generation: %v", err)
+	}
+	return prev, nil
+}
+
+// cleanGenerations removes the generation dirs for out other than the ones in
+// keep.
+func cleanGenerations(out string, keep ...string) error {
+	gens, err := filepath.Glob(out + ".gen-[0-9]*")
+	if err != nil {
+		return err
+	}
+	for _, gen := range gens {
+		if inSlice(keep, gen) {
+			continue
+		}
+		if err := os.RemoveAll(gen); err != nil {
+			return fmt.Errorf("error removing old generation %s: %v", gen, err)
+		}
+	}
+	return nil
+}
+
+func isDir(fn string) bool {
+	fi, err := os.Stat(fn)
+	return err == nil && fi.IsDir()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServer(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-serve")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	write := func(root, fn, contents string) {
+		fn = filepath.Join(root, filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, []byte(contents), 0644))
+		assert.NoError(t, os.Chtimes(fn, mtime, mtime))
+	}
+
+	gen1, gen2 := filepath.Join(td, "out.gen-1"), filepath.Join(td, "out.gen-2")
+	write(gen1, "dists/stable/InRelease", "gen1")
+	write(gen1, "pool/main/f/foo/foo_1:1.0_amd64.deb", "0123456789")
+	write(gen1, "packages/index.html", "<html></html>")
+	write(gen2, "dists/stable/InRelease", "gen2")
+
+	var log bytes.Buffer
+	s := NewServer(gen1)
+	s.AccessLog = &log
+
+	get := func(method, url string, hdr ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, url, nil)
+		for i := 0; i+1 < len(hdr); i += 2 {
+			r.Header.Set(hdr[i], hdr[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("GET", "/dists/stable/InRelease")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gen1", w.Body.String())
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, mtime.Format(http.TimeFormat), w.Header().Get("Last-Modified"))
+	assert.Contains(t, log.String(), `"GET /dists/stable/InRelease HTTP/1.1" 200 4 "-" "-"`, "request should be logged")
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = get("GET", "/dists/stable/InRelease", "If-None-Match", etag)
+	assert.Equal(t, http.StatusNotModified, w.Code, "etag should match")
+
+	w = get("GET", "/dists/stable/InRelease", "If-Modified-Since", mtime.Format(http.TimeFormat))
+	assert.Equal(t, http.StatusNotModified, w.Code, "should not be modified")
+
+	w = get("GET", "/dists/stable/InRelease", "If-Modified-Since", mtime.Add(-time.Hour).Format(http.TimeFormat))
+	assert.Equal(t, http.StatusOK, w.Code, "should be modified")
+
+	w = get("GET", "/pool/main/f/foo/foo_1:1.0_amd64.deb", "Range", "bytes=2-4")
+	assert.Equal(t, http.StatusPartialContent, w.Code)
+	assert.Equal(t, "234", w.Body.String())
+	assert.Equal(t, "application/vnd.debian.binary-package", w.Header().Get("Content-Type"))
+
+	w = get("HEAD", "/pool/main/f/foo/foo_1:1.0_amd64.deb")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Content-Length"))
+	assert.Empty(t, w.Body.String())
+
+	w = get("GET", "/pool/main/f/foo/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<a href="./foo_1:1.0_amd64.deb">`, "pool should have listings")
+
+	w = get("GET", "/pool/main")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/pool/main/", w.Header().Get("Location"))
+
+	w = get("GET", "/packages/")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<html></html>", w.Body.String(), "index.html should be served for dirs")
+
+	w = get("GET", "/dists/")
+	assert.Equal(t, http.StatusForbidden, w.Code, "only pool should have listings")
+
+	w = get("GET", "/dists/stable/InRelease/")
+	assert.Equal(t, http.StatusMovedPermanently, w.Code)
+
+	w = get("GET", "/../out.gen-2/dists/stable/InRelease")
+	assert.Equal(t, http.StatusNotFound, w.Code, "should not be able to escape the root")
+
+	w = get("GET", "/nonexistent")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = get("PUT", "/dists/stable/InRelease")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+
+	w = get("GET", "/status")
+	assert.Equal(t, http.StatusNotFound, w.Code, "status should only be served if enabled")
+
+	s.Status = func() Status {
+		return Status{OK: false, Generation: "out.gen-1", LastError: "test", Failures: 1}
+	}
+	w = get("GET", "/status")
+	assert.Equal(t, http.StatusOK, w.Code, "status should be OK even if the last update failed")
+	assert.JSONEq(t, `{"ok": false, "generation": "out.gen-1", "last_error": "test", "failures": 1}`, w.Body.String())
+
+	s.SetRoot(gen2)
+	w = get("GET", "/dists/stable/InRelease")
+	assert.Equal(t, "gen2", w.Body.String(), "should use the new root")
+}
+
+func TestSwitchGeneration(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-serve")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	out := filepath.Join(td, "out")
+	var gens []string
+	for _, n := range []string{"1", "2", "3"} {
+		gen := out + ".gen-" + n
+		assert.NoError(t, os.Mkdir(gen, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(gen, "gen"), []byte(n), 0644))
+		gens = append(gens, gen)
+	}
+
+	for i, gen := range gens {
+		prev, err := switchGeneration(out, gen)
+		assert.NoError(t, err)
+		if i == 0 {
+			assert.Empty(t, prev)
+		} else {
+			assert.Equal(t, gens[i-1], prev)
+		}
+		buf, err := ioutil.ReadFile(filepath.Join(out, "gen"))
+		assert.NoError(t, err)
+		assert.Equal(t, strings.TrimPrefix(gen, out+".gen-"), string(buf))
+	}
+
+	assert.NoError(t, cleanGenerations(out, gens[2], gens[1]))
+	_, err = os.Stat(gens[0])
+	assert.True(t, os.IsNotExist(err), "old generation should be removed")
+	for _, gen := range gens[1:] {
+		_, err = os.Stat(gen)
+		assert.NoError(t, err, "kept generation should not be removed")
+	}
+
+	fis, err := ioutil.ReadDir(td)
+	assert.NoError(t, err)
+	assert.Len(t, fis, 3, "there should be no temporary files left")
+}
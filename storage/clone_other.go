@@ -0,0 +1,13 @@
+//go:build !linux
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// clone makes dst a copy-on-write clone of src.
+func clone(dst, src *os.File) error {
+	return errors.New("not supported on this platform")
+}
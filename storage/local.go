@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Local stores files in a dir on the local filesystem. Copies of existing
+// files are hardlinked if possible.
+type Local struct {
+	Root string
+	Mode LinkMode // how PutFile adds files
+}
+
+// NewLocal returns a Local storage for root, which is created if it doesn't
+// exist when the first file is written.
+func NewLocal(root string) *Local {
+	return &Local{Root: root}
+}
+
+// path returns the local path for a file.
+func (l *Local) path(name string) (string, error) {
+	name, ok := cleanName(name)
+	if !ok {
+		return "", fmt.Errorf("invalid file name %#v", name)
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(name)), nil
+}
+
+// Put implements Storage.
+func (l *Local) Put(ctx context.Context, name string, data []byte) error {
+	fn, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(fn); err == nil && fi.Mode().IsRegular() && fi.Size() == int64(len(data)) {
+		if buf, err := ioutil.ReadFile(fn); err == nil && bytes.Equal(buf, data) {
+			return nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return fmt.Errorf("error making dir for %s: %v", name, err)
+	}
+	os.Remove(fn) // in case it's a symlink
+	if err := ioutil.WriteFile(fn, data, 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+	return nil
+}
+
+// PutFile implements Storage.
+func (l *Local) PutFile(ctx context.Context, name, src string) error {
+	fn, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if same, err := sameFile(fn, src); err != nil {
+		return fmt.Errorf("error comparing %s: %v", name, err)
+	} else if same {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return fmt.Errorf("error making dir for %s: %v", name, err)
+	}
+	os.Remove(fn)
+
+	if l.Mode == LinkHardlink {
+		if err := os.Link(src, fn); err == nil {
+			return nil
+		}
+	}
+	if err := copyFile(fn, src, l.Mode == LinkReflink); err != nil {
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+	return nil
+}
+
+// Copy implements Copier. The file is hardlinked if possible.
+func (l *Local) Copy(ctx context.Context, name, src string) error {
+	fn, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	sfn, err := l.path(src)
+	if err != nil {
+		return err
+	}
+	if same, err := sameFile(fn, sfn); err != nil {
+		return fmt.Errorf("error comparing %s: %v", name, err)
+	} else if same {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return fmt.Errorf("error making dir for %s: %v", name, err)
+	}
+	os.Remove(fn)
+
+	if err := os.Link(sfn, fn); err == nil {
+		return nil
+	}
+	if err := copyFile(fn, sfn, true); err != nil {
+		return fmt.Errorf("error writing %s: %v", name, err)
+	}
+	return nil
+}
+
+// Get implements Storage.
+func (l *Local) Get(ctx context.Context, name string) ([]byte, error) {
+	fn, err := l.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(fn)
+}
+
+// Symlink implements Linker. The symlink is relative if possible.
+func (l *Local) Symlink(ctx context.Context, name, src string) error {
+	fn, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+		return fmt.Errorf("error making dir for %s: %v", name, err)
+	}
+	rp, err := filepath.Rel(filepath.Dir(fn), src)
+	if err != nil {
+		rp = src
+	}
+	if cur, err := os.Readlink(fn); err == nil && cur == rp {
+		return nil
+	}
+	os.Remove(fn)
+	if err := os.Symlink(rp, fn); err != nil {
+		return fmt.Errorf("error creating symlink for %s: %v", name, err)
+	}
+	return nil
+}
+
+// List implements Storage.
+func (l *Local) List(ctx context.Context) ([]string, error) {
+	var names []string
+	err := filepath.Walk(l.Root, func(fn string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if fn == l.Root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.Root, fn)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing files: %v", err)
+	}
+	return names, nil
+}
+
+// Delete implements Storage.
+func (l *Local) Delete(ctx context.Context, name string) error {
+	fn, err := l.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing %s: %v", name, err)
+	}
+	return nil
+}
+
+// copyFile copies src to fn, which must not exist. If reflink is true, it
+// tries to make a copy-on-write clone first.
+func copyFile(fn, src string, reflink bool) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening '%s' for copying: %v", src, err)
+	}
+	defer f.Close()
+
+	of, err := os.Create(fn)
+	if err != nil {
+		return fmt.Errorf("error opening '%s' for copying: %v", fn, err)
+	}
+
+	if reflink && clone(of, f) == nil {
+		return of.Close()
+	}
+
+	if _, err := io.Copy(of, f); err != nil {
+		of.Close()
+		return err
+	}
+	return of.Close()
+}
+
+// sameFile checks if fn is a regular file with the same contents as src.
+func sameFile(fn, src string) (bool, error) {
+	fi, err := os.Lstat(fn)
+	if os.IsNotExist(err) || (err == nil && !fi.Mode().IsRegular()) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	si, err := os.Stat(src)
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() != si.Size() {
+		return false, nil
+	}
+	if os.SameFile(fi, si) {
+		return true, nil
+	}
+	a, err := sha256File(fn)
+	if err != nil {
+		return false, err
+	}
+	b, err := sha256File(src)
+	if err != nil {
+		return false, err
+	}
+	return a == b, nil
+}
+
+// sha256File returns the hex SHA-256 checksum of a file.
+func sha256File(fn string) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
@@ -0,0 +1,483 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3 stores files in an S3-compatible bucket (e.g. AWS S3 or MinIO). Objects
+// are only uploaded if their MD5 checksum differs from the ETag of the
+// existing object.
+type S3 struct {
+	Endpoint     string // the base URL of the service (default https://s3.REGION.amazonaws.com)
+	Region       string // default us-east-1
+	Bucket       string
+	Prefix       string // the prefix for all object names (optional)
+	PathStyle    bool   // use ENDPOINT/BUCKET/NAME URLs instead of BUCKET.ENDPOINT/NAME (usually needed for MinIO)
+	AccessKey    string
+	SecretKey    string
+	SessionToken string       // optional
+	Client       *http.Client // optional
+
+	mu    sync.Mutex
+	etags map[string]string // name -> ETag, loaded on first use
+}
+
+// NewS3 parses a URL in the format s3://BUCKET[/PREFIX]. The credentials and
+// region are read from the standard AWS environment variables.
+func NewS3(u string) (*S3, error) {
+	p, err := url.Parse(u)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 URL: %v", err)
+	}
+	if p.Scheme != "s3" || p.Host == "" {
+		return nil, fmt.Errorf("invalid S3 URL %#v: must be in the format s3://BUCKET[/PREFIX]", u)
+	}
+	s := &S3{
+		Region:       os.Getenv("AWS_REGION"),
+		Bucket:       p.Host,
+		Prefix:       strings.Trim(p.Path, "/"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if s.Region == "" {
+		s.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return s, nil
+}
+
+// Put implements Storage.
+func (s *S3) Put(ctx context.Context, name string, data []byte) error {
+	sum := md5.Sum(data)
+	return s.put(ctx, name, bytes.NewReader(data), int64(len(data)), sum[:])
+}
+
+// PutFile implements Storage.
+func (s *S3) PutFile(ctx context.Context, name, fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return fmt.Errorf("error opening '%s' for uploading: %v", fn, err)
+	}
+	defer f.Close()
+
+	h := md5.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("error reading '%s': %v", fn, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error reading '%s': %v", fn, err)
+	}
+	return s.put(ctx, name, f, n, h.Sum(nil))
+}
+
+// Copy implements Copier using a server-side copy.
+func (s *S3) Copy(ctx context.Context, name, src string) error {
+	name, ok := cleanName(name)
+	if !ok {
+		return fmt.Errorf("invalid file name %#v", name)
+	}
+	src, ok = cleanName(src)
+	if !ok {
+		return fmt.Errorf("invalid file name %#v", src)
+	}
+
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+	etag, _ := s.etag(src)
+	cur, _ := s.etag(name)
+	if etag != "" && etag == cur {
+		return nil
+	}
+
+	hdr := http.Header{}
+	hdr.Set("X-Amz-Copy-Source", s3EscapePath("/"+s.Bucket+"/"+s.key(src)))
+
+	resp, err := s.do(ctx, http.MethodPut, s.key(name), nil, hdr, nil, 0)
+	if err != nil {
+		return fmt.Errorf("error copying %s to %s: %v", src, name, err)
+	}
+	defer resp.Body.Close()
+
+	// errors can also be returned with a 200 status after the copy starts
+	var res struct {
+		XMLName xml.Name
+		ETag    string
+		Code    string
+		Message string
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return fmt.Errorf("error copying %s to %s: %v", src, name, err)
+	} else if res.XMLName.Local == "Error" {
+		return fmt.Errorf("error copying %s to %s: %s: %s", src, name, res.Code, res.Message)
+	}
+
+	s.mu.Lock()
+	s.etags[name] = strings.Trim(res.ETag, `"`)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *S3) put(ctx context.Context, name string, r io.ReadSeeker, size int64, sum []byte) error {
+	name, ok := cleanName(name)
+	if !ok {
+		return fmt.Errorf("invalid file name %#v", name)
+	}
+
+	if err := s.load(ctx); err != nil {
+		return err
+	}
+	etag := hex.EncodeToString(sum)
+	if cur, _ := s.etag(name); cur == etag {
+		return nil
+	}
+
+	hdr := http.Header{}
+	hdr.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum))
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		hdr.Set("Content-Type", ct)
+	} else {
+		hdr.Set("Content-Type", "application/octet-stream")
+	}
+
+	resp, err := s.do(ctx, http.MethodPut, s.key(name), nil, hdr, r, size)
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %v", name, err)
+	}
+	resp.Body.Close()
+
+	s.mu.Lock()
+	s.etags[name] = etag
+	s.mu.Unlock()
+	return nil
+}
+
+// Get implements Storage.
+func (s *S3) Get(ctx context.Context, name string) ([]byte, error) {
+	name, ok := cleanName(name)
+	if !ok {
+		return nil, fmt.Errorf("invalid file name %#v", name)
+	}
+
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+	if _, exists := s.etag(name); !exists {
+		return nil, &os.PathError{Op: "get", Path: name, Err: os.ErrNotExist}
+	}
+
+	resp, err := s.do(ctx, http.MethodGet, s.key(name), nil, nil, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %v", name, err)
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading %s: %v", name, err)
+	}
+	return buf, nil
+}
+
+// List implements Storage.
+func (s *S3) List(ctx context.Context) ([]string, error) {
+	if err := s.load(ctx); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	names := make([]string, 0, len(s.etags))
+	for name := range s.etags {
+		names = append(names, name)
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete implements Storage.
+func (s *S3) Delete(ctx context.Context, name string) error {
+	name, ok := cleanName(name)
+	if !ok {
+		return fmt.Errorf("invalid file name %#v", name)
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.key(name), nil, nil, nil, 0)
+	if err != nil {
+		return fmt.Errorf("error deleting %s: %v", name, err)
+	}
+	resp.Body.Close()
+
+	s.mu.Lock()
+	delete(s.etags, name)
+	s.mu.Unlock()
+	return nil
+}
+
+// load lists the existing objects if they haven't been listed already. The
+// ETags must only be accessed with mu held.
+func (s *S3) load(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.etags != nil {
+		return nil
+	}
+
+	var prefix string
+	if s.Prefix != "" {
+		prefix = s.Prefix + "/"
+	}
+
+	etags := map[string]string{}
+	var token string
+	for {
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", prefix)
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, "", q, nil, nil, 0)
+		if err != nil {
+			return fmt.Errorf("error listing objects: %v", err)
+		}
+
+		var res struct {
+			Contents []struct {
+				Key  string
+				ETag string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("error listing objects: %v", err)
+		}
+
+		for _, c := range res.Contents {
+			if strings.HasPrefix(c.Key, prefix) {
+				etags[strings.TrimPrefix(c.Key, prefix)] = strings.Trim(c.ETag, `"`)
+			}
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+
+	s.etags = etags
+	return nil
+}
+
+// etag returns the ETag of an existing object.
+func (s *S3) etag(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	etag, ok := s.etags[name]
+	return etag, ok
+}
+
+// key returns the object key for a file.
+func (s *S3) key(name string) string {
+	if s.Prefix == "" {
+		return name
+	}
+	return s.Prefix + "/" + name
+}
+
+// do makes a signed request for an object key (or the bucket if empty). An
+// error is returned if the response status isn't 2xx (or 404 for DELETE).
+func (s *S3) do(ctx context.Context, method, key string, query url.Values, hdr http.Header, body io.ReadSeeker, size int64) (*http.Response, error) {
+	region := s.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %v", err)
+	}
+	if s.PathStyle {
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = strings.TrimRight(u.Path, "/") + "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	payload := sha256.New()
+	if body != nil {
+		if _, err := io.Copy(payload, body); err != nil {
+			return nil, err
+		}
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Body = ioutil.NopCloser(body)
+		req.ContentLength = size
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload.Sum(nil)))
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+	s3Sign(req, s.AccessKey, s.SecretKey, region, time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 && !(method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		defer resp.Body.Close()
+		var e struct {
+			Code    string
+			Message string
+		}
+		if buf, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024)); xml.Unmarshal(buf, &e) == nil && e.Code != "" {
+			return nil, fmt.Errorf("response status %s: %s: %s", resp.Status, e.Code, e.Message)
+		}
+		return nil, fmt.Errorf("response status %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// s3Sign signs a request using AWS Signature Version 4. The X-Amz-Content-Sha256
+// header must already be set. All headers set on the request are signed.
+func s3Sign(req *http.Request, accessKey, secretKey, region string, t time.Time) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + region + "/s3/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	host := req.URL.Host
+	if req.Host != "" {
+		host = req.Host
+	}
+
+	hdrs := map[string]string{"host": host}
+	for k, v := range req.Header {
+		hdrs[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	var names []string
+	for k := range hdrs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonHdrs strings.Builder
+	for _, k := range names {
+		canonHdrs.WriteString(k + ":" + hdrs[k] + "\n")
+	}
+	signedHdrs := strings.Join(names, ";")
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonHdrs.String(),
+		signedHdrs,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	canonReqSum := sha256.Sum256([]byte(canonReq))
+
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonReqSum[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, v := range []string{amzDate[:8], region, "s3", "aws4_request"} {
+		key = s3HMAC(key, v)
+	}
+	sig := hex.EncodeToString(s3HMAC(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+", SignedHeaders="+signedHdrs+", Signature="+sig)
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3Escape escapes a string as required for signing (everything except the
+// unreserved characters).
+func s3Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3EscapePath escapes each segment of a path.
+func s3EscapePath(p string) string {
+	spl := strings.Split(p, "/")
+	for i := range spl {
+		spl[i] = s3Escape(spl[i])
+	}
+	return strings.Join(spl, "/")
+}
+
+// s3CanonicalQuery encodes a query string with sorted keys.
+func s3CanonicalQuery(q url.Values) string {
+	var keys []string
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ps []string
+	for _, k := range keys {
+		vs := append([]string{}, q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			ps = append(ps, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(ps, "&")
+}
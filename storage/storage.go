@@ -0,0 +1,62 @@
+// Package storage writes generated repositories to a local directory or
+// S3-compatible object storage.
+package storage
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// Storage stores the files of a generated repository. Names are slash-separated
+// paths relative to the root of the repository.
+type Storage interface {
+	// Put writes a file, replacing it if it exists. If the existing file has
+	// the same contents, it is left as-is.
+	Put(ctx context.Context, name string, data []byte) error
+
+	// PutFile is like Put, but copies a file from the local filesystem.
+	PutFile(ctx context.Context, name, fn string) error
+
+	// Get reads a file. If it doesn't exist, the error satisfies
+	// os.IsNotExist.
+	Get(ctx context.Context, name string) ([]byte, error)
+
+	// List returns the names of all files.
+	List(ctx context.Context) ([]string, error)
+
+	// Delete removes a file. It is not an error if it doesn't exist.
+	Delete(ctx context.Context, name string) error
+}
+
+// Linker is implemented by storage which can symlink to files on the local
+// filesystem.
+type Linker interface {
+	// Symlink replaces a file with a symlink to fn.
+	Symlink(ctx context.Context, name, fn string) error
+}
+
+// Copier is implemented by storage which can copy an existing file without
+// uploading it again (e.g. to store identical files once).
+type Copier interface {
+	// Copy replaces a file with a copy of the existing file src.
+	Copy(ctx context.Context, name, src string) error
+}
+
+// LinkMode is how Local adds files from the local filesystem.
+type LinkMode int
+
+const (
+	LinkCopy     LinkMode = iota // copy the file
+	LinkHardlink                 // hardlink the file, or copy it if it's on a different filesystem
+	LinkReflink                  // make a copy-on-write clone of the file, or copy it if the filesystem doesn't support it
+)
+
+// cleanName checks and cleans a file name.
+func cleanName(name string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "/"))
+	if name == "." || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status is the status of the updates to the repository.
+type Status struct {
+	OK          bool       `json:"ok"`                     // whether the last update succeeded
+	Generation  string     `json:"generation,omitempty"`   // the name of the dir currently being published
+	LastSuccess *time.Time `json:"last_success,omitempty"` // when the current generation was published
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	Failures    int        `json:"failures"`             // the number of consecutive failed updates
+	NextRetry   *time.Time `json:"next_retry,omitempty"` // when the next retry is scheduled after a failed update
+}
+
+// updater runs and retries updates to the repository, keeping track of the
+// status. Updates never overlap.
+type updater struct {
+	// Generate publishes a new generation of the repository, rescanning the
+	// DIST/COMPONENTs in changed (or everything if nil), and returns its path.
+	// If it fails, the previous generation must be left intact.
+	Generate func(changed []string) (string, error)
+
+	StatusFile string        // where to write the status as JSON after each update (optional)
+	MinBackoff time.Duration // how long to wait before retrying a failed update
+	MaxBackoff time.Duration // the maximum time to wait before retrying as the number of failures increases
+
+	mu      sync.Mutex
+	status  Status
+	pending []string // the changes which still need to be rescanned after a failed update
+}
+
+func newUpdater(generate func(changed []string) (string, error), statusFile string) *updater {
+	return &updater{
+		Generate:   generate,
+		StatusFile: statusFile,
+		MinBackoff: time.Second * 5,
+		MaxBackoff: time.Minute * 5,
+	}
+}
+
+// Status returns the current status.
+func (u *updater) Status() Status {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.status
+}
+
+// Update runs an update, rescanning the DIST/COMPONENTs in changed (or
+// everything if nil) along with the ones from previous failed updates.
+func (u *updater) Update(changed []string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.status.Failures != 0 {
+		changed = mergeChanged(u.pending, changed)
+	}
+
+	if changed == nil {
+		fmt.Println("Info: updating repo")
+	} else {
+		fmt.Printf("Info: updating repo (changed: %s)\n", strings.Join(changed, ", "))
+	}
+
+	gen, err := u.Generate(changed)
+	now := time.Now()
+	if err != nil {
+		u.pending = changed
+		u.status.OK = false
+		u.status.LastError = err.Error()
+		u.status.LastErrorAt = &now
+		u.status.Failures++
+	} else {
+		u.pending = nil
+		u.status.OK = true
+		u.status.Generation = filepath.Base(gen)
+		u.status.LastSuccess = &now
+		u.status.Failures = 0
+	}
+	u.status.NextRetry = nil
+	u.writeStatus()
+	return err
+}
+
+// Run updates the repository whenever the watcher reports changes, retrying
+// failed updates (including a failed update before Run was called) with
+// exponential backoff. It does not return.
+func (u *updater) Run(w watcher) {
+	changes := make(chan []string)
+	go func() {
+		for {
+			changes <- w.Wait()
+		}
+	}()
+
+	var retry <-chan time.Time
+	if u.Status().Failures != 0 {
+		retry = u.retry()
+	}
+	for {
+		if retry == nil {
+			fmt.Println("Info: waiting for changes")
+		}
+
+		var changed []string
+		select {
+		case changed = <-changes:
+		case <-retry:
+			changed = []string{}
+		}
+
+		if err := u.Update(changed); err != nil {
+			retry = u.retry()
+		} else {
+			retry = nil
+		}
+	}
+}
+
+// retry schedules a retry after a failed update.
+func (u *updater) retry() <-chan time.Time {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	backoff := u.backoff()
+	next := time.Now().Add(backoff)
+	u.status.NextRetry = &next
+	u.writeStatus()
+
+	fmt.Fprintf(os.Stderr, "Error: %s (keeping the previous repository, will retry in %s or when there are changes)\n", u.status.LastError, backoff)
+	return time.After(backoff)
+}
+
+// backoff returns how long to wait before retrying after the current number of
+// consecutive failures.
+func (u *updater) backoff() time.Duration {
+	d := u.MinBackoff
+	for i := 1; i < u.status.Failures && d < u.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > u.MaxBackoff {
+		d = u.MaxBackoff
+	}
+	return d
+}
+
+// writeStatus atomically writes the status to StatusFile, if set.
+func (u *updater) writeStatus() {
+	if u.StatusFile == "" {
+		return
+	}
+	buf, _ := json.MarshalIndent(u.status, "", "  ")
+	tmp := filepath.Join(filepath.Dir(u.StatusFile), "."+filepath.Base(u.StatusFile)+".tmp")
+	if err := ioutil.WriteFile(tmp, append(buf, '\n'), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not write status file: %v\n", err)
+		return
+	}
+	if err := os.Rename(tmp, u.StatusFile); err != nil {
+		os.Remove(tmp)
+		fmt.Fprintf(os.Stderr, "Warning: could not write status file: %v\n", err)
+	}
+}
+
+// mergeChanged merges two lists of DIST/COMPONENTs to rescan, where nil means
+// everything.
+func mergeChanged(a, b []string) []string {
+	if a == nil || b == nil {
+		return nil
+	}
+	m := []string{}
+	for _, dc := range append(append([]string{}, a...), b...) {
+		if !inSlice(m, dc) {
+			m = append(m, dc)
+		}
+	}
+	sort.Strings(m)
+	return m
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testWatcher is a watcher which returns the changes sent to it.
+type testWatcher chan []string
+
+func (w testWatcher) Wait() []string {
+	return <-w
+}
+
+func (w testWatcher) Close() error {
+	return nil
+}
+
+func TestUpdater(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-update")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	var mu sync.Mutex
+	var fail bool
+	setFail := func(v bool) {
+		mu.Lock()
+		fail = v
+		mu.Unlock()
+	}
+
+	// Generate is called with u.mu held, so once a call has been received,
+	// u.Status blocks until the update has finished
+	calls := make(chan []string, 10)
+	u := newUpdater(func(changed []string) (string, error) {
+		calls <- changed
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return "", fmt.Errorf("test")
+		}
+		return filepath.Join(td, "out.gen-1"), nil
+	}, filepath.Join(td, "status.json"))
+	u.MinBackoff = time.Millisecond * 50
+	u.MaxBackoff = time.Millisecond * 150
+
+	readStatus := func() Status {
+		var s Status
+		buf, err := ioutil.ReadFile(filepath.Join(td, "status.json"))
+		assert.NoError(t, err)
+		assert.NoError(t, json.Unmarshal(buf, &s))
+		return s
+	}
+
+	// eventually polls fn until it returns true or times out
+	eventually := func(fn func() bool) bool {
+		for deadline := time.Now().Add(time.Second * 5); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			if fn() {
+				return true
+			}
+		}
+		return false
+	}
+
+	assert.NoError(t, u.Update(nil))
+	assert.Nil(t, <-calls)
+	s := readStatus()
+	assert.True(t, s.OK)
+	assert.Equal(t, "out.gen-1", s.Generation)
+	assert.NotNil(t, s.LastSuccess)
+	assert.Empty(t, s.LastError)
+
+	setFail(true)
+	assert.Error(t, u.Update([]string{"stable/main"}))
+	assert.Equal(t, []string{"stable/main"}, <-calls)
+	s = readStatus()
+	assert.False(t, s.OK)
+	assert.Equal(t, "out.gen-1", s.Generation, "the previous generation should still be reported")
+	assert.Equal(t, "test", s.LastError)
+	assert.Equal(t, 1, s.Failures)
+
+	assert.Error(t, u.Update([]string{"testing/main"}))
+	assert.Equal(t, []string{"stable/main", "testing/main"}, <-calls, "changes from failed updates should be retried")
+	assert.Equal(t, 2, u.Status().Failures)
+
+	u.mu.Lock()
+	assert.Equal(t, time.Millisecond*100, u.backoff())
+	u.status.Failures = 10
+	assert.Equal(t, time.Millisecond*150, u.backoff(), "backoff should be limited")
+	u.status.Failures = 2
+	u.mu.Unlock()
+
+	w := make(testWatcher)
+	go u.Run(w)
+
+	assert.Equal(t, []string{"stable/main", "testing/main"}, <-calls, "failed updates should be retried")
+	assert.Equal(t, []string{"stable/main", "testing/main"}, <-calls, "failed updates should be retried again")
+	assert.True(t, eventually(func() bool { return u.Status().NextRetry != nil }), "the next retry should be scheduled")
+	assert.NotNil(t, readStatus().NextRetry, "the next retry should be reported")
+
+	setFail(false)
+	w <- []string{"stable/contrib"}
+	assert.Equal(t, []string{"stable/contrib", "stable/main", "testing/main"}, <-calls, "changes should trigger a retry")
+	s = u.Status()
+	assert.True(t, s.OK)
+	assert.Zero(t, s.Failures)
+	assert.Nil(t, s.NextRetry)
+
+	w <- []string{"stable/main"}
+	assert.Equal(t, []string{"stable/main"}, <-calls)
+
+	select {
+	case c := <-calls:
+		t.Errorf("should not retry after success (got %v)", c)
+	case <-time.After(time.Millisecond * 300):
+	}
+}
@@ -1,4 +1,5 @@
-package main
+// Package version parses and compares Debian package versions.
+package version
 
 // This file is from https://github.com/knqyf263/go-deb-version
 /* MIT License
@@ -183,6 +184,22 @@ func (v1 Version) Compare(v2 Version) int {
 	return compare(v1.debianRevision, v2.debianRevision)
 }
 
+// Newer checks if version a is newer than b. Invalid versions are considered
+// older than valid ones.
+func Newer(a, b string) bool {
+	va, err := NewVersion(a)
+	if err != nil {
+		return false
+	}
+
+	vb, err := NewVersion(b)
+	if err != nil {
+		return true
+	}
+
+	return va.GreaterThan(vb)
+}
+
 // String returns the full version string
 func (v1 Version) String() string {
 	version := ""
@@ -215,7 +232,8 @@ func compare(v1, v2 string) int {
 		strings2 = append([]string{""}, strings2...)
 	}
 
-	for i := 0; ; i++ {
+	// Stop once both are exhausted, since versions like 1.0 and 1.00 are equal
+	for i := 0; i < len(strings1) || i < len(strings2) || i < len(numbers1) || i < len(numbers2); i++ {
 		// Compare non-digit strings
 		diff := compareString(strings1.get(i), strings2.get(i))
 		if diff != 0 {
@@ -228,6 +246,7 @@ func compare(v1, v2 string) int {
 			return diff
 		}
 	}
+	return 0
 }
 
 func compareString(s1, s2 string) int {
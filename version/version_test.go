@@ -0,0 +1,92 @@
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewVersion(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+		err     bool
+	}{
+		{"1.0", "1.0", false},
+		{" 1.0-1 ", "1.0-1", false},
+		{"1:2.3.4-5ubuntu1", "1:2.3.4-5ubuntu1", false},
+		{"0:1.0", "1.0", false},
+		{"1.0-beta-2", "1.0-beta-2", false},
+		{"2.0~rc1+dfsg", "2.0~rc1+dfsg", false},
+		{"", "", true},
+		{"a1.0", "", true},
+		{"x:1.0", "", true},
+		{"-1:1.0", "", true},
+	} {
+		v, err := NewVersion(c.in)
+		if c.err {
+			assert.Error(t, err, "%#v should be invalid", c.in)
+			continue
+		}
+		if assert.NoError(t, err, c.in) {
+			assert.Equal(t, c.out, v.String(), c.in)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+	for _, c := range []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "0:1.0", 0},
+		{"1.0", "1.0-0", 0},
+		{"1.0", "1.00", 0},
+		{"1.01-1", "1.1-01", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1:0.1", "2.0", 1},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0", "1.0a", -1},
+		{"1.0a", "1.0+", -1},
+		{"1.0+dfsg", "1.0", 1},
+		{"1.0.0", "1.0", 1},
+	} {
+		va, err := NewVersion(c.a)
+		if !assert.NoError(t, err, c.a) {
+			continue
+		}
+		vb, err := NewVersion(c.b)
+		if !assert.NoError(t, err, c.b) {
+			continue
+		}
+		assert.Equal(t, c.cmp, sign(va.Compare(vb)), "%s vs %s", c.a, c.b)
+		assert.Equal(t, -c.cmp, sign(vb.Compare(va)), "%s vs %s", c.b, c.a)
+		assert.Equal(t, c.cmp == 0, va.Equal(vb), "%s == %s", c.a, c.b)
+		assert.Equal(t, c.cmp > 0, va.GreaterThan(vb), "%s > %s", c.a, c.b)
+		assert.Equal(t, c.cmp < 0, va.LessThan(vb), "%s < %s", c.a, c.b)
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func TestNewer(t *testing.T) {
+	assert.True(t, Newer("1.1", "1.0"))
+	assert.False(t, Newer("1.0", "1.1"))
+	assert.False(t, Newer("1.0", "1.0"), "equal versions shouldn't be newer")
+	assert.False(t, Newer("1.0", "1.00"), "equal versions shouldn't be newer")
+	assert.True(t, Newer("1.0", "invalid"), "invalid versions should be older than valid ones")
+	assert.False(t, Newer("invalid", "1.0"), "invalid versions should be older than valid ones")
+}
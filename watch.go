@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-zglob"
+	"github.com/pgaskin/repogen/repo"
+)
+
+// watcher waits for changes to the packages in the input dir.
+type watcher interface {
+	// Wait blocks until there are changes, and returns the DIST/COMPONENTs
+	// which need to be rescanned, or nil if everything should be rescanned.
+	// New and removed components are always picked up by Repo.ScanChanged, so
+	// it may be empty if only the layout changed.
+	Wait() []string
+	Close() error
+}
+
+// newWatcher watches the input dir for changes using filesystem
+// notifications, falling back to polling it every interval if they aren't
+// available or poll is true. For notifications, interval is how long to wait
+// for more changes before returning.
+func newWatcher(inRoot string, interval time.Duration, poll bool) watcher {
+	if !poll {
+		w, err := newNotifyWatcher(inRoot, interval)
+		if err == nil {
+			return w
+		}
+		fmt.Fprintf(os.Stderr, "Warning: could not use filesystem notifications to watch the input directory, falling back to polling: %v\n", err)
+	}
+	return newPollWatcher(inRoot, interval)
+}
+
+// pollWatcher watches the input dir by checking the file names and sizes
+// every interval.
+type pollWatcher struct {
+	inRoot   string
+	interval time.Duration
+	state    map[string]string // DIST/COMPONENT -> checksum of the file list
+}
+
+func newPollWatcher(inRoot string, interval time.Duration) *pollWatcher {
+	w := &pollWatcher{
+		inRoot:   inRoot,
+		interval: interval,
+	}
+	for w.state == nil {
+		w.state = w.check()
+	}
+	return w
+}
+
+func (w *pollWatcher) Wait() []string {
+	for {
+		time.Sleep(w.interval)
+
+		state := w.check()
+		if state == nil {
+			continue
+		}
+
+		changed := []string{}
+		for dc, s := range state {
+			if ps, ok := w.state[dc]; !ok || ps != s {
+				changed = append(changed, dc)
+			}
+		}
+		for dc := range w.state {
+			if _, ok := state[dc]; !ok {
+				changed = append(changed, dc)
+			}
+		}
+		w.state = state
+
+		if len(changed) != 0 {
+			sort.Strings(changed)
+			return changed
+		}
+	}
+}
+
+func (w *pollWatcher) Close() error {
+	return nil
+}
+
+// check returns the current state of the input dir, or nil if it could not be
+// checked or files are still being written.
+func (w *pollWatcher) check() map[string]string {
+	fs, err := zglob.Glob(filepath.Join(w.inRoot, "**", "*.deb"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: could not search for files in input directory '%s': %v\n", w.inRoot, err)
+		time.Sleep(w.interval)
+		return nil
+	}
+
+	for i := 0; i < len(fs); i++ {
+		if watchIgnored(filepath.Base(fs[i])) {
+			fs = append(fs[:i], fs[i+1:]...)
+			i--
+		}
+	}
+
+	var e bool
+	var s1, s2 int64
+	for _, fn := range fs {
+		if fi, err := os.Stat(fn); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not search for files in input directory '%s': %v\n", w.inRoot, err)
+			e = true
+			break
+		} else {
+			s1 += fi.Size()
+		}
+	}
+	if e {
+		time.Sleep(w.interval)
+		return nil
+	}
+	time.Sleep(time.Second)
+	for _, fn := range fs {
+		if fi, err := os.Stat(fn); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not search for files in input directory '%s': %v\n", w.inRoot, err)
+			e = true
+			break
+		} else {
+			s2 += fi.Size()
+		}
+	}
+	if e {
+		time.Sleep(w.interval)
+		return nil
+	}
+
+	if s1 != s2 {
+		fmt.Fprintf(os.Stderr, "Warning: file probably still being written (will check again in 2s): total size of input directory changed: %d -> %d\n", s1, s2)
+		time.Sleep(time.Second * 2)
+		return nil
+	}
+
+	comps := map[string][]string{}
+	for _, fn := range fs {
+		if rel, err := filepath.Rel(w.inRoot, fn); err == nil {
+			if spl := strings.Split(filepath.ToSlash(rel), "/"); len(spl) == 3 {
+				dc := spl[0] + "/" + spl[1]
+				fi, _ := os.Stat(fn)
+				comps[dc] = append(comps[dc], fmt.Sprintf("%s:%d:%d", spl[2], fi.Size(), fi.ModTime().UnixNano()))
+			}
+		}
+	}
+
+	state := map[string]string{}
+	for dc, fs := range comps {
+		sort.Strings(fs)
+		state[dc] = fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(fs, ";"))))
+	}
+	return state
+}
+
+// watchIgnored checks if a file in a component dir should be ignored by the
+// watcher (e.g. temporary files from uploads).
+func watchIgnored(name string) bool {
+	return repo.IsHidden(name) || filepath.Ext(name) != ".deb"
+}
@@ -0,0 +1,264 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/pgaskin/repogen/repo"
+	"golang.org/x/sys/unix"
+)
+
+// watchPendingTimeout is the maximum time to wait for a file which is still
+// open for writing before rescanning anyways.
+const watchPendingTimeout = time.Second * 30
+
+const (
+	notifyDirMask  = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_ONLYDIR
+	notifyCompMask = notifyDirMask | unix.IN_MODIFY | unix.IN_CLOSE_WRITE
+)
+
+// notifyWatcher watches the input dir using inotify. Events are debounced by
+// the interval, and files which are still being written are waited for. If
+// the notifications can't be read, it falls back to polling.
+type notifyWatcher struct {
+	inRoot   string
+	interval time.Duration
+	fd       int
+	f        *os.File
+	watches  map[int32]string     // wd -> dir relative to inRoot ("" for the root, DIST, or DIST/COMPONENT)
+	pending  map[string]time.Time // file relative to inRoot -> when it was opened for writing
+	buf      []byte
+	poll     *pollWatcher // set if reading the notifications failed
+}
+
+func newNotifyWatcher(inRoot string, interval time.Duration) (watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_NONBLOCK | unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize inotify: %v", err)
+	}
+
+	w := &notifyWatcher{
+		inRoot:   inRoot,
+		interval: interval,
+		fd:       fd,
+		f:        os.NewFile(uintptr(fd), "inotify"),
+		watches:  map[int32]string{},
+		pending:  map[string]time.Time{},
+		buf:      make([]byte, 64*1024),
+	}
+
+	// the fd is non-blocking, so this will only fail if it can't be used with
+	// the runtime poller (which is needed for Close and the debounce timeout)
+	if err := w.f.SetReadDeadline(time.Time{}); err != nil {
+		w.f.Close()
+		return nil, fmt.Errorf("could not initialize inotify: %v", err)
+	}
+
+	if err := w.watch(""); err != nil {
+		w.f.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// watch adds watches for a dir (relative to inRoot) and its subdirs up to
+// the component level.
+func (w *notifyWatcher) watch(rel string) error {
+	depth, mask := 0, uint32(notifyDirMask)
+	if rel != "" {
+		depth = strings.Count(rel, "/") + 1
+	}
+	if depth == 2 {
+		mask = notifyCompMask
+	}
+
+	wd, err := unix.InotifyAddWatch(w.fd, filepath.Join(w.inRoot, filepath.FromSlash(rel)), mask)
+	if err != nil {
+		return fmt.Errorf("could not watch '%s': %v", filepath.Join(w.inRoot, filepath.FromSlash(rel)), err)
+	}
+	w.watches[int32(wd)] = rel
+
+	if depth < 2 {
+		fis, err := ioutil.ReadDir(filepath.Join(w.inRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			return fmt.Errorf("could not list '%s': %v", filepath.Join(w.inRoot, filepath.FromSlash(rel)), err)
+		}
+		for _, fi := range fis {
+			if fi.IsDir() && !repo.IsHidden(fi.Name()) {
+				if err := w.watch(watchPath(rel, fi.Name())); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// unwatch removes the watches for a dir (relative to inRoot) and its subdirs.
+func (w *notifyWatcher) unwatch(rel string) {
+	for wd, dir := range w.watches {
+		if dir == rel || strings.HasPrefix(dir, rel+"/") {
+			unix.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.watches, wd)
+		}
+	}
+	for fn := range w.pending {
+		if strings.HasPrefix(fn, rel+"/") {
+			delete(w.pending, fn)
+		}
+	}
+}
+
+func (w *notifyWatcher) Wait() []string {
+	if w.poll != nil {
+		return w.poll.Wait()
+	}
+
+	changed := map[string]bool{}
+	var all bool
+	var deadline time.Time
+
+	for {
+		if !deadline.IsZero() {
+			w.f.SetReadDeadline(deadline)
+		}
+
+		n, err := w.f.Read(w.buf)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			var oldest time.Time
+			for _, t := range w.pending {
+				if oldest.IsZero() || t.Before(oldest) {
+					oldest = t
+				}
+			}
+			if !oldest.IsZero() && time.Since(oldest) < watchPendingTimeout {
+				deadline = time.Now().Add(w.interval)
+				continue
+			}
+			if !oldest.IsZero() {
+				fmt.Fprintf(os.Stderr, "Warning: files still being written after %s, updating anyways\n", watchPendingTimeout)
+				w.pending = map[string]time.Time{}
+			}
+			break
+		} else if err != nil {
+			// changes may have been missed, so everything is rescanned
+			fmt.Fprintf(os.Stderr, "Warning: could not read filesystem notifications, falling back to polling: %v\n", err)
+			w.f.Close()
+			w.poll = newPollWatcher(w.inRoot, w.interval)
+			return nil
+		}
+
+		var relevant bool
+		for off := 0; off+unix.SizeofInotifyEvent <= n; {
+			ev := (*unix.InotifyEvent)(unsafe.Pointer(&w.buf[off]))
+			name := strings.TrimRight(string(w.buf[off+unix.SizeofInotifyEvent:off+unix.SizeofInotifyEvent+int(ev.Len)]), "\x00")
+			off += unix.SizeofInotifyEvent + int(ev.Len)
+
+			if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+				fmt.Fprintf(os.Stderr, "Warning: filesystem notification queue overflowed (will rescan everything)\n")
+				all, relevant = true, true
+				if err := w.watch(""); err != nil {
+					fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+				}
+				continue
+			}
+
+			if ev.Mask&unix.IN_IGNORED != 0 {
+				delete(w.watches, ev.Wd)
+				continue
+			}
+
+			dir, ok := w.watches[ev.Wd]
+			if !ok || name == "" || repo.IsHidden(name) {
+				continue
+			}
+			rel := watchPath(dir, name)
+
+			if ev.Mask&unix.IN_ISDIR != 0 {
+				if strings.Contains(dir, "/") {
+					continue // not part of the layout, so Scan will complain about it
+				}
+				switch {
+				case ev.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0:
+					if err := w.watch(rel); err != nil {
+						fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+					}
+				case ev.Mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+					w.unwatch(rel)
+				}
+				relevant = true
+				continue
+			}
+
+			if !strings.Contains(dir, "/") {
+				relevant = true // files outside a component dir (Scan will complain about them)
+				continue
+			}
+
+			if watchIgnored(name) {
+				continue
+			}
+
+			switch {
+			case ev.Mask&unix.IN_CREATE != 0 && watchComplete(filepath.Join(w.inRoot, filepath.FromSlash(rel))):
+				// files created with their contents (e.g. hard links) don't
+				// get a CLOSE_WRITE, and files which are still being written
+				// will get a MODIFY afterwards
+				delete(w.pending, rel)
+			case ev.Mask&(unix.IN_CREATE|unix.IN_MODIFY) != 0:
+				if _, ok := w.pending[rel]; !ok {
+					w.pending[rel] = time.Now()
+				}
+			case ev.Mask&(unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO|unix.IN_MOVED_FROM|unix.IN_DELETE) != 0:
+				delete(w.pending, rel)
+			}
+			changed[dir], relevant = true, true
+		}
+
+		if relevant {
+			deadline = time.Now().Add(w.interval)
+		}
+	}
+	w.f.SetReadDeadline(time.Time{})
+
+	if all {
+		return nil
+	}
+	dcs := []string{}
+	for dc := range changed {
+		dcs = append(dcs, dc)
+	}
+	sort.Strings(dcs)
+	return dcs
+}
+
+func (w *notifyWatcher) Close() error {
+	if w.poll != nil {
+		return nil
+	}
+	return w.f.Close()
+}
+
+// watchComplete checks if a newly created file already has contents (or isn't a
+// regular file), so it won't necessarily be written to and closed afterwards.
+func watchComplete(fn string) bool {
+	fi, err := os.Lstat(fn)
+	return err == nil && (!fi.Mode().IsRegular() || fi.Size() != 0)
+}
+
+// watchPath joins a dir relative to the input dir and a name.
+func watchPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifyWatcher(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-watch")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(td, "stable", "main"), 0755))
+
+	w, err := newNotifyWatcher(td, time.Millisecond*100)
+	if err != nil {
+		t.Fatalf("could not create watcher: %v", err)
+	}
+	defer w.Close()
+
+	wait := func() chan []string {
+		ch := make(chan []string, 1)
+		go func() { ch <- w.Wait() }()
+		return ch
+	}
+
+	ch := wait()
+	f, err := os.Create(filepath.Join(td, "stable", "main", "foo.deb"))
+	assert.NoError(t, err)
+	f.Write([]byte("foo"))
+	time.Sleep(time.Millisecond * 300)
+	select {
+	case <-ch:
+		t.Errorf("should wait for files to be closed")
+	default:
+	}
+	f.Close()
+	assert.Equal(t, []string{"stable/main"}, <-ch)
+
+	ch = wait()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(td, "stable", "main", ".upload-1.tmp"), []byte("tmp"), 0644))
+	assert.NoError(t, os.Rename(filepath.Join(td, "stable", "main", ".upload-1.tmp"), filepath.Join(td, "stable", "main", "bar.deb")))
+	assert.Equal(t, []string{"stable/main"}, <-ch, "temp files should be ignored, but renames should be detected")
+
+	ch = wait()
+	assert.NoError(t, os.MkdirAll(filepath.Join(td, "testing", "contrib"), 0755))
+	time.Sleep(time.Millisecond * 50)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(td, "testing", "contrib", "foo.deb"), []byte("foo"), 0644))
+	assert.NoError(t, os.Remove(filepath.Join(td, "stable", "main", "foo.deb")))
+	assert.Equal(t, []string{"stable/main", "testing/contrib"}, <-ch, "new dirs should be watched")
+
+	ch = wait()
+	assert.NoError(t, os.Link(filepath.Join(td, "testing", "contrib", "foo.deb"), filepath.Join(td, "stable", "main", "foo.deb")))
+	select {
+	case c := <-ch:
+		assert.Equal(t, []string{"stable/main"}, c)
+	case <-time.After(time.Second * 5):
+		t.Errorf("should not wait for hard links to be closed")
+		<-ch
+	}
+
+	// simulate the notifications failing
+	w.(*notifyWatcher).f.Close()
+	assert.Nil(t, w.Wait(), "everything should be rescanned if reading the notifications fails")
+	assert.NotNil(t, w.(*notifyWatcher).poll, "it should fall back to polling")
+
+	ch = wait()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(td, "testing", "contrib", "bar.deb"), []byte("bar"), 0644))
+	assert.Equal(t, []string{"testing/contrib"}, <-ch, "changes should be detected by polling")
+}
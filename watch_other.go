@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+func newNotifyWatcher(inRoot string, interval time.Duration) (watcher, error) {
+	return nil, errors.New("not supported on this platform")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollWatcher(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-watch")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(td, "stable", "main"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(td, "stable", "contrib"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(td, "stable", "main", "foo.deb"), []byte("foo"), 0644))
+
+	w := newPollWatcher(td, time.Millisecond*10)
+	defer w.Close()
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(td, "stable", "contrib", ".upload-1.tmp"), []byte("tmp"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(td, "stable", "contrib", "bar.deb"), []byte("bar"), 0644))
+	assert.Equal(t, []string{"stable/contrib"}, w.Wait())
+
+	assert.NoError(t, os.Remove(filepath.Join(td, "stable", "main", "foo.deb")))
+	assert.Equal(t, []string{"stable/main"}, w.Wait())
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/pgaskin/repogen/repo"
+)
+
+// webAssets contains the stylesheets, icons and fonts for the web interface,
+// which are written to packages/assets/ so the pages don't depend on any
+// third-party hosts.
+//
+//go:embed assets
+var webAssets embed.FS
+
+// webAssetsFS is webAssets without the assets/ prefix.
+var webAssetsFS, _ = fs.Sub(webAssets, "assets")
+
+// webStylesheets are the stylesheets from the assets which are linked from
+// every page, in order.
+var webStylesheets = []string{
+	"fonts/fonts.css",
+	"font-awesome/css/font-awesome.min.css",
+}
+
+// Stylesheet is a stylesheet linked from the web interface.
+type Stylesheet struct {
+	URL       string
+	Integrity string // the subresource integrity hash, if loaded from a CDN (it must also match the embedded copy)
+}
+
+// webCDNAssets are the assets which are loaded from cdnjs if Options.CDN is
+// set. The fonts are always served locally since Google Fonts doesn't support
+// subresource integrity.
+var webCDNAssets = map[string]Stylesheet{
+	"font-awesome/css/font-awesome.min.css": {
+		URL:       "https://cdnjs.cloudflare.com/ajax/libs/font-awesome/4.7.0/css/font-awesome.min.css",
+		Integrity: "sha512-SfTiTlX6kk+qitfevl/7LibUOeJWlt9rbyDn92a1DqWOw9vWG2MFoays0sgObmWazO5BQPiFucnnEAjpAB+/Sw==",
+	},
+}
+
+// webStylesheetLinks returns the stylesheets to link from the pages.
+func webStylesheetLinks(cdn bool) []Stylesheet {
+	var links []Stylesheet
+	for _, fn := range webStylesheets {
+		if a, ok := webCDNAssets[fn]; ok && cdn {
+			links = append(links, a)
+			continue
+		}
+		links = append(links, Stylesheet{URL: "assets/" + fn})
+	}
+	return links
+}
+
+// writeWebAssets writes the assets in fsys to dir (relative to the root of the
+// repository), replacing existing files.
+func writeWebAssets(ctx context.Context, r *repo.Repo, fsys fs.FS, dir string) error {
+	return fs.WalkDir(fsys, ".", func(fn string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if de.IsDir() {
+			return nil
+		}
+		buf, err := fs.ReadFile(fsys, fn)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", fn, err)
+		}
+		if err := r.Put(ctx, path.Join(dir, fn), buf); err != nil {
+			return fmt.Errorf("error writing %s: %v", fn, err)
+		}
+		return nil
+	})
+}
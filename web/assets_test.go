@@ -0,0 +1,37 @@
+package web
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebCDNAssets(t *testing.T) {
+	for fn, a := range webCDNAssets {
+		buf, err := webAssets.ReadFile("assets/" + fn)
+		if !assert.NoError(t, err, fn) {
+			continue
+		}
+		sum := sha512.Sum512(buf)
+		assert.Equal(t, a.Integrity, "sha512-"+base64.StdEncoding.EncodeToString(sum[:]), "embedded %s must match the CDN copy", fn)
+		assert.True(t, strings.HasPrefix(a.URL, "https://"), fn)
+	}
+}
+
+func TestWebStylesheetLinks(t *testing.T) {
+	for _, cdn := range []bool{false, true} {
+		for _, l := range webStylesheetLinks(cdn) {
+			if strings.HasPrefix(l.URL, "assets/") {
+				_, err := webAssets.ReadFile(l.URL)
+				assert.NoError(t, err, l.URL)
+				assert.Empty(t, l.Integrity, l.URL)
+			} else {
+				assert.True(t, cdn, "only local assets should be used without --web-cdn")
+				assert.NotEmpty(t, l.Integrity, l.URL)
+			}
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// searchDoc is the data shown for a search result.
+type searchDoc struct {
+	Package          string   `json:"package"`
+	LatestVersion    string   `json:"latest_version"`
+	ShortDescription string   `json:"short_description"`
+	Versions         []string `json:"versions"`
+}
+
+// searchShard is part of the search data for a dist. The shards are fetched
+// when the search box is first used.
+type searchShard struct {
+	Index *searchIndex          `json:"index"`
+	Docs  map[string]*searchDoc `json:"docs"`
+}
+
+// getSearch generates the search script for a dist and the shards it loads
+// (path relative to the web root -> contents). If shardSize is 0, all packages
+// are put in a single shard. The shards are named by their checksum, so they
+// can be cached indefinitely.
+func getSearch(dist string, pkgs map[string]*pkgInfo, shardSize int) (string, map[string][]byte, error) {
+	refs := make([]string, 0, len(pkgs))
+	for ref := range pkgs {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	refs = jsKeyOrder(refs)
+
+	if shardSize <= 0 {
+		shardSize = len(refs)
+	}
+
+	shards := map[string][]byte{}
+	shardPaths := []string{}
+	for i := 0; i < len(refs); i += shardSize {
+		j := i + shardSize
+		if j > len(refs) {
+			j = len(refs)
+		}
+
+		shard := &searchShard{
+			Index: newSearchIndex(searchIndexFields),
+			Docs:  map[string]*searchDoc{},
+		}
+		for _, ref := range refs[i:j] {
+			pkg := pkgs[ref]
+			versions := make([]string, 0, len(pkg.Availability))
+			for version := range pkg.Availability {
+				versions = append(versions, version)
+			}
+			sort.Strings(versions)
+			versions = jsKeyOrder(versions)
+
+			shard.Index.Add(ref, map[string]string{
+				"package":           pkg.Package,
+				"short_description": pkg.ShortDescription,
+				"section":           pkg.Section,
+				"version":           strings.Join(versions, " "),
+				"description":       pkg.Description,
+			})
+			shard.Docs[ref] = &searchDoc{
+				Package:          pkg.Package,
+				LatestVersion:    pkg.LatestVersion,
+				ShortDescription: pkg.ShortDescription,
+				Versions:         versions,
+			}
+		}
+
+		buf, err := json.Marshal(shard)
+		if err != nil {
+			return "", nil, fmt.Errorf("error generating search shard: %v", err)
+		}
+		fn := path.Join("search", dist, fmt.Sprintf("%x", sha256.Sum256(buf))[:16]+".json")
+		shards[fn] = buf
+		shardPaths = append(shardPaths, fn)
+	}
+
+	buf, err := json.Marshal(shardPaths)
+	if err != nil {
+		return "", nil, fmt.Errorf("error generating search shard list: %v", err)
+	}
+
+	js := "var dist = \"" + dist + "\";"
+	js += "var shards = " + string(buf) + ";"
+	return js + common + browser, shards, nil
+}
+
+// common loads lunr and the shards. The versionPrefix function makes searches
+// for versions match prefixes, and must be registered before loading the
+// indexes since it is part of the search pipeline.
+const common = `var versionPrefix = function (token) {
+	if (token.metadata.fields.indexOf("version") > -1 && token.str.length >= 3 && token.str.indexOf(".") > -1 && /\d/.test(token.str)) token.str += "*";
+	return token;
+};
+var docs = {};
+var indexes = [];
+var loading = false;
+var load = function () {
+	if (loading) return;
+	loading = true;
+	var script = document.createElement("script");
+	script.src = "assets/lunr.min.js";
+	script.onload = function () {
+		lunr.Pipeline.registerFunction(versionPrefix, "versionPrefix");
+		shards.forEach(function (url) {
+			var xhr = new XMLHttpRequest();
+			xhr.open("GET", url);
+			xhr.onload = function () {
+				if (xhr.status != 200) return;
+				var shard = JSON.parse(xhr.responseText);
+				for (var ref in shard.docs) docs[ref] = shard.docs[ref];
+				indexes.push(lunr.Index.load(shard.index));
+				search();
+			};
+			xhr.send();
+		});
+	};
+	document.head.appendChild(script);
+};
+`
+
+const browser = `var searchEl = document.querySelector(".search");
+var inputEl = document.querySelector(".search__query");
+var resultsEl = document.querySelector(".search__results");
+
+var search = function () {
+	var q = inputEl.value;
+	// see https://lunrjs.com/guides/searching.html for advanced options
+	var results = [];
+	if (q.length > 0) {
+		for (var j = 0; j < indexes.length; j++) {
+			results = results.concat(indexes[j].search(q));
+		}
+		results = results.sort(function (a, b) {
+			return b.score - a.score;
+		}).slice(0, 7);
+	}
+	var els = document.createDocumentFragment();
+	for (var i in results) {
+		var result = results[i];
+		var package = docs[result.ref];
+		var resultEl = els.appendChild(document.createElement("a"));
+		resultEl.className = "search__results__result" + (i == 0 ? " search__results__result--focus" : "");
+		resultEl.href = dist + "/" + package.package;
+		var versionEl = resultEl.appendChild(document.createElement("div"));
+		versionEl.className = "search__results__result__version";
+		versionEl.innerText = package.latest_version;
+		if (result.matchData && result.matchData.metadata) {
+			for (var k in result.matchData.metadata) {
+				// k is the token matched
+				if ("version" in result.matchData.metadata[k]) {
+					for (var j = 0; j < package.versions.length; j++) {
+						if (package.versions[j].indexOf(k) > -1) {
+							versionEl.innerText = k;
+						}
+					}
+				}
+			}
+		}
+		var packageEl = resultEl.appendChild(document.createElement("div"));
+		packageEl.className = "search__results__result__package";
+		packageEl.innerText = package.package;
+		var descriptionEl = resultEl.appendChild(document.createElement("div"));
+		descriptionEl.className = "search__results__result__description";
+		descriptionEl.innerText = package.short_description;
+	}
+	resultsEl.innerHTML = "";
+	if (results.length < 1 && q.length > 0) {
+		var noneEl = els.appendChild(document.createElement("div"));
+		noneEl.className = "search__results__none";
+		noneEl.innerText = indexes.length < shards.length ? "Loading..." : "No packages found";
+	}
+	resultsEl.appendChild(els);
+};
+inputEl.addEventListener("input", function() {
+	load();
+	search();
+});
+inputEl.addEventListener("focus", function() {
+	load();
+	searchEl.className = "search search--focus";
+});
+inputEl.addEventListener("blur", function() {
+	searchEl.className = "search";
+});
+inputEl.addEventListener("keydown", function(ev) {
+	var els = resultsEl.querySelectorAll(".search__results__result");
+	if (els.length <= 0) return;
+	var selected = 0;
+	for (var i = 0; i < els.length; i++) {
+		if (els[i].className.indexOf("search__results__result--focus") > -1) {
+			selected = i;
+		}
+	}
+	if (ev.keyCode == 38) {
+		els[selected].className = els[selected].className.replace("search__results__result--focus", "");
+		selected--;
+		if (selected < 0) selected = 0;
+		els[selected].className = els[selected].className + " search__results__result--focus";
+		ev.preventDefault();
+	} else if (ev.keyCode == 40) {
+		els[selected].className = els[selected].className.replace("search__results__result--focus", "");
+		selected++;
+		if (selected >= els.length) selected = els.length - 1;
+		els[selected].className = els[selected].className + " search__results__result--focus";
+		ev.preventDefault();
+	} else if (ev.keyCode == 13) {
+		els[selected].click();
+		ev.preventDefault();
+	} else if (ev.keyCode == 27) {
+		inputEl.blur();
+	}
+});
+if (inputEl.value.length > 0) {
+	load();
+}`
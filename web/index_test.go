@@ -0,0 +1,57 @@
+package web
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSearch(t *testing.T) {
+	pkgs := map[string]*pkgInfo{}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		pkgs[name] = &pkgInfo{
+			Package:          name,
+			LatestVersion:    "1.1",
+			ShortDescription: "package " + name,
+			Description:      "package " + name + "\nThis is a long description which isn't needed for showing results.",
+			Availability:     map[string]map[string]map[string]string{"1.0": nil, "1.1": nil},
+		}
+	}
+
+	for _, c := range []struct {
+		size   int
+		shards int
+	}{{0, 1}, {2, 3}, {5, 1}, {10, 1}} {
+		js, shards, err := getSearch("stable", pkgs, c.size)
+		assert.NoError(t, err)
+		assert.Len(t, shards, c.shards, "size %d: wrong number of shards", c.size)
+		assert.True(t, strings.HasPrefix(js, `var dist = "stable";`), "size %d: search code should set the dist", c.size)
+
+		docs := map[string]*searchDoc{}
+		for fn, buf := range shards {
+			assert.True(t, strings.HasPrefix(fn, "search/stable/") && strings.HasSuffix(fn, ".json"), "size %d: shard %s should be in search/stable", c.size, fn)
+			assert.Contains(t, js, `"`+fn+`"`, "size %d: search code should reference shard %s", c.size, fn)
+
+			var shard struct {
+				Index json.RawMessage       `json:"index"`
+				Docs  map[string]*searchDoc `json:"docs"`
+			}
+			assert.NoError(t, json.Unmarshal(buf, &shard))
+			assert.NotContains(t, string(buf), "long description", "size %d: docs should only contain the fields needed for results", c.size)
+			if c.size > 0 {
+				assert.True(t, len(shard.Docs) <= c.size, "size %d: shard %s has too many packages", c.size, fn)
+			}
+			for ref, doc := range shard.Docs {
+				docs[ref] = doc
+			}
+		}
+		assert.Len(t, docs, len(pkgs), "size %d: all packages should be in a shard", c.size)
+		assert.Equal(t, &searchDoc{"c", "1.1", "package c", []string{"1.0", "1.1"}}, docs["c"])
+	}
+
+	_, a, _ := getSearch("stable", pkgs, 2)
+	_, b, _ := getSearch("stable", pkgs, 2)
+	assert.Equal(t, a, b, "shards should be deterministic")
+}
@@ -0,0 +1,446 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// searchIndexVersion is the version of lunr the index is built for. The
+// serialized index is specific to it.
+const searchIndexVersion = "2.3.5"
+
+// searchIndexPipeline is the search pipeline stored in the index. The
+// functions must be registered in the browser.
+var searchIndexPipeline = []string{"versionPrefix", "stemmer"}
+
+// searchIndexField is a field in the search index.
+type searchIndexField struct {
+	Name  string
+	Boost float64
+}
+
+// searchIndexFields are the fields indexed for each package, in order.
+var searchIndexFields = []searchIndexField{
+	{"package", 20},
+	{"short_description", 15},
+	{"section", 5},
+	{"version", 1},
+	{"description", 1},
+}
+
+// searchIndex builds a serialized lunr index. It mirrors lunr.Builder with the
+// default pipeline (trimmer, stopWordFilter, stemmer) and BM25 parameters.
+type searchIndex struct {
+	fields   []searchIndexField
+	docs     []string                  // in the order they were added
+	tf       map[string]map[string]int // field/ref -> term -> frequency
+	length   map[string]int            // field/ref -> number of terms
+	terms    map[string]*searchPosting
+	numTerms int
+}
+
+// searchPosting is an entry in the inverted index.
+type searchPosting struct {
+	index int
+	docs  map[string][]string // field -> refs containing the term
+}
+
+const (
+	searchIndexK1 = 1.2
+	searchIndexB  = 0.75
+)
+
+func newSearchIndex(fields []searchIndexField) *searchIndex {
+	return &searchIndex{
+		fields: fields,
+		tf:     map[string]map[string]int{},
+		length: map[string]int{},
+		terms:  map[string]*searchPosting{},
+	}
+}
+
+// Add adds a document. Fields which aren't present are treated as empty.
+func (s *searchIndex) Add(ref string, fields map[string]string) {
+	s.docs = append(s.docs, ref)
+	for _, field := range s.fields {
+		fieldRef := field.Name + "/" + ref
+		tf := map[string]int{}
+		s.tf[fieldRef] = tf
+
+		tokens := lunrPipeline(lunrTokenize(fields[field.Name]))
+		s.length[fieldRef] = len(tokens)
+		for _, term := range tokens {
+			tf[term]++
+			p, ok := s.terms[term]
+			if !ok {
+				p = &searchPosting{index: s.numTerms, docs: map[string][]string{}}
+				s.terms[term] = p
+				s.numTerms++
+			}
+			if refs := p.docs[field.Name]; len(refs) == 0 || refs[len(refs)-1] != ref {
+				p.docs[field.Name] = append(refs, ref)
+			}
+		}
+	}
+}
+
+// MarshalJSON serializes the index in the same format as lunr.Index.toJSON.
+func (s *searchIndex) MarshalJSON() ([]byte, error) {
+	avgLength := map[string]float64{}
+	for _, field := range s.fields {
+		var total int
+		for _, ref := range s.docs {
+			total += s.length[field.Name+"/"+ref]
+		}
+		avgLength[field.Name] = float64(total) / float64(len(s.docs))
+	}
+
+	idf := map[string]float64{}
+	for term, p := range s.terms {
+		var n int
+		for _, refs := range p.docs {
+			n += len(refs)
+		}
+		x := (float64(len(s.docs)) - float64(n) + 0.5) / (float64(n) + 0.5)
+		idf[term] = math.Log(1 + math.Abs(x))
+	}
+
+	k1, bm := float64(searchIndexK1), float64(searchIndexB)
+
+	var b bytes.Buffer
+	b.WriteString(`{"version":`)
+	writeJSONString(&b, searchIndexVersion)
+	b.WriteString(`,"fields":[`)
+	for i, field := range s.fields {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		writeJSONString(&b, field.Name)
+	}
+	b.WriteByte(']')
+
+	b.WriteString(`,"fieldVectors":[`)
+	for i, ref := range s.docs {
+		for j, field := range s.fields {
+			fieldRef := field.Name + "/" + ref
+			type element struct {
+				index int
+				score float64
+			}
+			var vec []element
+			for term, tf := range s.tf[fieldRef] {
+				// the conversions prevent fused operations so the result is
+				// identical to the one from JavaScript
+				x := float64(float64(k1+1) * float64(tf))
+				y := float64(k1*float64(float64(1-bm)+float64(bm*float64(float64(s.length[fieldRef])/avgLength[field.Name])))) + float64(tf)
+				score := float64(float64(idf[term]*x)/y) * field.Boost
+				vec = append(vec, element{s.terms[term].index, jsRound(float64(1000*score)) / 1000})
+			}
+			sort.Slice(vec, func(i, j int) bool {
+				return vec[i].index < vec[j].index
+			})
+			if i != 0 || j != 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(`[`)
+			writeJSONString(&b, fieldRef)
+			b.WriteString(`,[`)
+			for k, e := range vec {
+				if k != 0 {
+					b.WriteByte(',')
+				}
+				b.WriteString(strconv.Itoa(e.index) + "," + strconv.FormatFloat(e.score, 'f', -1, 64))
+			}
+			b.WriteString(`]]`)
+		}
+	}
+
+	terms := make([]string, 0, len(s.terms))
+	for term := range s.terms {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		return jsLess(terms[i], terms[j])
+	})
+	b.WriteString(`],"invertedIndex":[`)
+	for i, term := range terms {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`[`)
+		writeJSONString(&b, term)
+		b.WriteString(`,{"_index":`)
+		b.WriteString(strconv.Itoa(s.terms[term].index))
+		for _, field := range s.fields {
+			b.WriteByte(',')
+			writeJSONString(&b, field.Name)
+			b.WriteString(`:{`)
+			for k, ref := range s.terms[term].docs[field.Name] {
+				if k != 0 {
+					b.WriteByte(',')
+				}
+				writeJSONString(&b, ref)
+				b.WriteString(`:{}`)
+			}
+			b.WriteByte('}')
+		}
+		b.WriteString(`}]`)
+	}
+
+	b.WriteString(`],"pipeline":[`)
+	for i, fn := range searchIndexPipeline {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		writeJSONString(&b, fn)
+	}
+	b.WriteString(`]}`)
+	return b.Bytes(), nil
+}
+
+func writeJSONString(b *bytes.Buffer, v string) {
+	buf, _ := json.Marshal(v) // strings can always be encoded
+	b.Write(buf)
+}
+
+// jsKeyOrder sorts object keys in the order JavaScript iterates over them
+// (array indices in numerical order, then the rest in insertion order).
+func jsKeyOrder(keys []string) []string {
+	isIndex := func(k string) (uint64, bool) {
+		n, err := strconv.ParseUint(k, 10, 32)
+		return n, err == nil && n < math.MaxUint32 && strconv.FormatUint(n, 10) == k
+	}
+	res := append([]string{}, keys...)
+	sort.SliceStable(res, func(i, j int) bool {
+		ni, ii := isIndex(res[i])
+		nj, ij := isIndex(res[j])
+		if ii && ij {
+			return ni < nj
+		}
+		return ii && !ij
+	})
+	return res
+}
+
+// jsLess compares strings by UTF-16 code units like Array.prototype.sort.
+func jsLess(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// jsRound rounds like Math.round.
+func jsRound(x float64) float64 {
+	r := math.Floor(x)
+	if x-r >= 0.5 {
+		r++
+	}
+	return r
+}
+
+// jsIsSpace matches the characters in \s in JavaScript regular expressions
+// (and which are removed by String.prototype.trim).
+func jsIsSpace(r rune) bool {
+	switch r {
+	case '\t', '\n', '\v', '\f', '\r', ' ', '\u00a0', '\u1680', '\u2028', '\u2029', '\u202f', '\u205f', '\u3000', '\ufeff':
+		return true
+	}
+	return r >= '\u2000' && r <= '\u200a'
+}
+
+// jsToLower lowercases a string like String.prototype.toLowerCase.
+func jsToLower(s string) string {
+	rs := []rune(s)
+	var b strings.Builder
+	for i, r := range rs {
+		switch {
+		case r == '\u0130':
+			b.WriteString("i\u0307")
+		case r == '\u03a3' && i > 0 && unicode.IsLetter(rs[i-1]) && (i+1 == len(rs) || !unicode.IsLetter(rs[i+1])):
+			b.WriteRune('\u03c2') // final sigma
+		default:
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// lunrTokenize splits a string into tokens like lunr.tokenizer.
+func lunrTokenize(s string) []string {
+	return strings.FieldsFunc(jsToLower(strings.TrimFunc(s, jsIsSpace)), func(r rune) bool {
+		return r == '-' || jsIsSpace(r)
+	})
+}
+
+// lunrPipeline runs the default lunr indexing pipeline on the tokens.
+func lunrPipeline(tokens []string) []string {
+	res := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		t = lunrTrimmer(t)
+		if lunrStopWords[t] {
+			continue
+		}
+		res = append(res, lunrStemmer(t))
+	}
+	return res
+}
+
+// lunrTrimmer removes non-word characters from the start and end of a token.
+// Note that like lunr, this can result in an empty token.
+func lunrTrimmer(t string) string {
+	return strings.TrimFunc(t, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_')
+	})
+}
+
+var lunrStopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a able about across after all almost also am among an and any are as at be because been but by can cannot could dear did do does either else ever every for from get got had has have he her hers him his how however i if in into is it its just least let like likely may me might most must my neither no nor not of off often on only or other our own rather said say says she should since so some than that the their them then there these they this tis to too twas us wants was we were what when where which while who whom why will with would yet you your`) {
+		lunrStopWords[w] = true
+	}
+}
+
+var (
+	lunrStep2List = map[string]string{"ational": "ate", "tional": "tion", "enci": "ence", "anci": "ance", "izer": "ize", "bli": "ble", "alli": "al", "entli": "ent", "eli": "e", "ousli": "ous", "ization": "ize", "ation": "ate", "ator": "ate", "alism": "al", "iveness": "ive", "fulness": "ful", "ousness": "ous", "aliti": "al", "iviti": "ive", "biliti": "ble", "logi": "log"}
+	lunrStep3List = map[string]string{"icate": "ic", "ative": "", "alize": "al", "iciti": "ic", "ical": "ic", "ful": "", "ness": ""}
+
+	lunrMGr0   = regexp.MustCompile(`^([^aeiou][^aeiouy]*)?[aeiouy][aeiou]*[^aeiou][^aeiouy]*`)
+	lunrMEq1   = regexp.MustCompile(`^([^aeiou][^aeiouy]*)?[aeiouy][aeiou]*[^aeiou][^aeiouy]*([aeiouy][aeiou]*)?$`)
+	lunrMGr1   = regexp.MustCompile(`^([^aeiou][^aeiouy]*)?[aeiouy][aeiou]*[^aeiou][^aeiouy]*[aeiouy][aeiou]*[^aeiou][^aeiouy]*`)
+	lunrSV     = regexp.MustCompile(`^([^aeiou][^aeiouy]*)?[aeiouy]`)
+	lunrRe1a   = regexp.MustCompile(`^(.+?)(ss|i)es$`)
+	lunrRe21a  = regexp.MustCompile(`^(.+?)([^s])s$`)
+	lunrRe1b   = regexp.MustCompile(`^(.+?)eed$`)
+	lunrRe21b  = regexp.MustCompile(`^(.+?)(ed|ing)$`)
+	lunrRe31b  = regexp.MustCompile(`(at|bl|iz)$`)
+	lunrRe41b  = regexp.MustCompile(`^[^aeiou][^aeiouy]*[aeiouy][^aeiouwxy]$`)
+	lunrRe1c   = regexp.MustCompile(`^(.+?[^aeiou])y$`)
+	lunrRe2    = regexp.MustCompile(`^(.+?)(ational|tional|enci|anci|izer|bli|alli|entli|eli|ousli|ization|ation|ator|alism|iveness|fulness|ousness|aliti|iviti|biliti|logi)$`)
+	lunrRe3    = regexp.MustCompile(`^(.+?)(icate|ative|alize|iciti|ical|ful|ness)$`)
+	lunrRe4    = regexp.MustCompile(`^(.+?)(al|ance|ence|er|ic|able|ible|ant|ement|ment|ent|ou|ism|ate|iti|ous|ive|ize)$`)
+	lunrRe24   = regexp.MustCompile(`^(.+?)(s|t)(ion)$`)
+	lunrRe5    = regexp.MustCompile(`^(.+?)e$`)
+	lunrRe25   = regexp.MustCompile(`ll$`)
+	lunrReCVC5 = regexp.MustCompile(`^[^aeiou][^aeiouy]*[aeiouy][^aeiouwxy]$`)
+)
+
+// lunrSurrogates is where UTF-16 surrogates are mapped to while stemming.
+const lunrSurrogates = 0xF0000
+
+// lunrStemmer is a port of the Porter stemmer from lunr. Like JavaScript, the
+// regular expressions operate on UTF-16 code units, so surrogates are mapped
+// to private use characters while stemming.
+func lunrStemmer(t string) string {
+	var w []rune
+	for _, c := range utf16.Encode([]rune(t)) {
+		if utf16.IsSurrogate(rune(c)) {
+			w = append(w, lunrSurrogates+rune(c))
+		} else {
+			w = append(w, rune(c))
+		}
+	}
+	var u []uint16
+	for _, c := range lunrStem(string(w)) {
+		if c >= lunrSurrogates+0xD800 && c <= lunrSurrogates+0xDFFF {
+			u = append(u, uint16(c-lunrSurrogates))
+		} else {
+			u = append(u, utf16.Encode([]rune{c})...)
+		}
+	}
+	return string(utf16.Decode(u))
+}
+
+func lunrStem(w string) string {
+	if utf8.RuneCountInString(w) < 3 {
+		return w
+	}
+
+	trimLast := func(s string) string {
+		_, n := utf8.DecodeLastRuneInString(s)
+		return s[:len(s)-n]
+	}
+
+	firstY := strings.HasPrefix(w, "y")
+	if firstY {
+		w = "Y" + w[1:]
+	}
+
+	// Step 1a
+	if m := lunrRe1a.FindStringSubmatch(w); m != nil {
+		w = m[1] + m[2]
+	} else if m := lunrRe21a.FindStringSubmatch(w); m != nil {
+		w = m[1] + m[2]
+	}
+
+	// Step 1b
+	if m := lunrRe1b.FindStringSubmatch(w); m != nil {
+		if lunrMGr0.MatchString(m[1]) {
+			w = trimLast(w)
+		}
+	} else if m := lunrRe21b.FindStringSubmatch(w); m != nil {
+		if stem := m[1]; lunrSV.MatchString(stem) {
+			w = stem
+			if lunrRe31b.MatchString(w) {
+				w += "e"
+			} else if rs := []rune(w); len(rs) >= 2 && rs[len(rs)-1] == rs[len(rs)-2] && !strings.ContainsRune("aeiouylsz", rs[len(rs)-1]) {
+				w = trimLast(w)
+			} else if lunrRe41b.MatchString(w) {
+				w += "e"
+			}
+		}
+	}
+
+	// Step 1c
+	if m := lunrRe1c.FindStringSubmatch(w); m != nil {
+		w = m[1] + "i"
+	}
+
+	// Step 2
+	if m := lunrRe2.FindStringSubmatch(w); m != nil && lunrMGr0.MatchString(m[1]) {
+		w = m[1] + lunrStep2List[m[2]]
+	}
+
+	// Step 3
+	if m := lunrRe3.FindStringSubmatch(w); m != nil && lunrMGr0.MatchString(m[1]) {
+		w = m[1] + lunrStep3List[m[2]]
+	}
+
+	// Step 4
+	if m := lunrRe4.FindStringSubmatch(w); m != nil {
+		if lunrMGr1.MatchString(m[1]) {
+			w = m[1]
+		}
+	} else if m := lunrRe24.FindStringSubmatch(w); m != nil {
+		if stem := m[1] + m[2]; lunrMGr1.MatchString(stem) {
+			w = stem
+		}
+	}
+
+	// Step 5
+	if m := lunrRe5.FindStringSubmatch(w); m != nil {
+		if stem := m[1]; lunrMGr1.MatchString(stem) || (lunrMEq1.MatchString(stem) && !lunrReCVC5.MatchString(stem)) {
+			w = stem
+		}
+	}
+	if lunrRe25.MatchString(w) && lunrMGr1.MatchString(w) {
+		w = trimLast(w)
+	}
+
+	if firstY {
+		w = "y" + w[1:]
+	}
+	return w
+}
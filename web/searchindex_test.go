@@ -0,0 +1,87 @@
+package web
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLunrStemmer(t *testing.T) {
+	// from lunr.stemmer in lunr 2.3.5
+	for word, stem := range map[string]string{
+		"running":         "run",
+		"happily":         "happili",
+		"generalizations": "gener",
+		"hopefulness":     "hope",
+		"agreed":          "agre",
+		"yelling":         "yell",
+		"yes":             "ye",
+		"conditional":     "condit",
+		"formalize":       "formal",
+		"adjustment":      "adjust",
+		"rate":            "rate",
+		"roll":            "roll",
+		"controll":        "control",
+		"caresses":        "caress",
+		"ponies":          "poni",
+		"ties":            "ti",
+		"cats":            "cat",
+		"feed":            "feed",
+		"plastered":       "plaster",
+		"motoring":        "motor",
+		"sing":            "sing",
+		"hopping":         "hop",
+		"tanned":          "tan",
+		"falling":         "fall",
+		"hissing":         "hiss",
+		"fizzed":          "fizz",
+		"failing":         "fail",
+		"filing":          "file",
+		"happy":           "happi",
+		"sky":             "ski",
+		"relational":      "relat",
+		"triplicate":      "triplic",
+		"revival":         "reviv",
+		"allowance":       "allow",
+		"gyroscopic":      "gyroscop",
+		"homologou":       "homolog",
+		"probate":         "probat",
+		"cease":           "ceas",
+		"a":               "a",
+		"is":              "is",
+	} {
+		assert.Equal(t, stem, lunrStemmer(word), "stem of %s", word)
+	}
+}
+
+func TestLunrPipeline(t *testing.T) {
+	assert.Equal(t, []string{"foo", "bar", "1.0", "1", "caf", "", "x86_64"}, lunrPipeline(lunrTokenize("  Foo-bar\t1.0-1 \u00a0 Café ... is (x86_64) ")), "tokens should be split, trimmed, filtered, and stemmed")
+	assert.Empty(t, lunrTokenize(""), "empty fields should not have tokens")
+}
+
+func TestSearchIndex(t *testing.T) {
+	idx := newSearchIndex(searchIndexFields)
+	idx.Add("libfoo", map[string]string{
+		"package":           "libfoo",
+		"short_description": "foo library",
+		"section":           "libs",
+		"version":           "1.0-1 1.1",
+		"description":       "foo library\nThe foo library is used for fooing.",
+	})
+	idx.Add("foo-utils", map[string]string{
+		"package":           "foo-utils",
+		"short_description": "utilities for foo",
+		"section":           "utils",
+		"version":           "1.1",
+		"description":       "utilities for foo\nRunning utilities.",
+	})
+
+	// from lunr 2.3.5 with the same fields and documents
+	buf, err := idx.MarshalJSON()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"version":"2.3.5","fields":["package","short_description","section","version","description"],"fieldVectors":[["package/libfoo",[0,16.052]],["short_description/libfoo",[1,5.62,2,2.735]],["section/libfoo",[3,3.466]],["version/libfoo",[4,0.575,5,0.575,6,0.151]],["description/libfoo",[1,0.565,2,0.237,7,0.641]],["package/foo-utils",[1,6.595,8,5.063]],["short_description/foo-utils",[1,5.62,8,4.315]],["section/foo-utils",[8,1.438]],["version/foo-utils",[6,0.229]],["description/foo-utils",[1,0.408,8,0.419,9,0.755]]],"invertedIndex":[["1",{"_index":5,"package":{},"short_description":{},"section":{},"version":{"libfoo":{}},"description":{}}],["1.0",{"_index":4,"package":{},"short_description":{},"section":{},"version":{"libfoo":{}},"description":{}}],["1.1",{"_index":6,"package":{},"short_description":{},"section":{},"version":{"libfoo":{},"foo-utils":{}},"description":{}}],["foo",{"_index":1,"package":{"foo-utils":{}},"short_description":{"libfoo":{},"foo-utils":{}},"section":{},"version":{},"description":{"libfoo":{},"foo-utils":{}}}],["lib",{"_index":3,"package":{},"short_description":{},"section":{"libfoo":{}},"version":{},"description":{}}],["libfoo",{"_index":0,"package":{"libfoo":{}},"short_description":{},"section":{},"version":{},"description":{}}],["librari",{"_index":2,"package":{},"short_description":{"libfoo":{}},"section":{},"version":{},"description":{"libfoo":{}}}],["run",{"_index":9,"package":{},"short_description":{},"section":{},"version":{},"description":{"foo-utils":{}}}],["us",{"_index":7,"package":{},"short_description":{},"section":{},"version":{},"description":{"libfoo":{}}}],["util",{"_index":8,"package":{"foo-utils":{}},"short_description":{"foo-utils":{}},"section":{"foo-utils":{}},"version":{},"description":{"foo-utils":{}}}]],"pipeline":["versionPrefix","stemmer"]}`, string(buf), "index should match the one from lunr")
+}
+
+func TestJSKeyOrder(t *testing.T) {
+	assert.Equal(t, []string{"2", "10", "b", "a", "01", "1.0"}, jsKeyOrder([]string{"b", "10", "a", "01", "2", "1.0"}), "array indices should be first")
+}
@@ -0,0 +1,171 @@
+package web
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// webTemplateFiles contains the default templates for the web interface. Any
+// of them can be overridden by a file with the same name in
+// Options.TemplateDir.
+//
+//go:embed templates
+var webTemplateFiles embed.FS
+
+// webPageTemplates are the templates which define the "content" template for
+// each type of page. Each one is parsed along with webSharedTemplates.
+var webPageTemplates = []string{"dists.html", "dist.html", "package.html", "virtual.html", "files.html"}
+
+// webSharedTemplates are the templates used by every page. The page is
+// rendered by executing base.html.
+var webSharedTemplates = []string{"base.html", "relations.html"}
+
+// Page is the data passed to base.html. It is part of the interface for
+// custom templates, so existing fields must not be changed or removed.
+type Page struct {
+	Title       string       // the page title
+	Base        string       // the path to the web root relative to the page (used for <base href>)
+	CSS         template.CSS // the contents of base.css
+	Stylesheets []Stylesheet // the stylesheets to link (from packages/assets or a CDN)
+	Origin      string       // the Origin of the repository
+	Description string       // the Description of the repository
+	Dist        string       // the current dist, if any
+	Package     string       // the current package, if any
+	Data        interface{}  // the data for the "content" template (one of the *Data types)
+}
+
+// DistsData is the data for dists.html, which is rendered as index.html.
+type DistsData struct {
+	Dists    []string
+	Packages map[string]map[string]*pkgInfo // dist -> package -> info
+}
+
+// DistData is the data for dist.html, which is rendered as DIST/index.html.
+type DistData struct {
+	Dist       string
+	Packages   map[string]*pkgInfo // package -> info
+	Components []string            // all components in the repository
+}
+
+// PackageData is the data for package.html and virtual.html, which are
+// rendered as DIST/PACKAGE/index.html.
+type PackageData struct {
+	Dist         string
+	Name         string
+	Package      *pkgInfo
+	DistPackages []string // the names of all real and virtual packages in the dist
+}
+
+// FilesData is the data for files.html, which is rendered as
+// DIST/PACKAGE/files/VERSION_ARCH.html.
+type FilesData struct {
+	Dist    string
+	Name    string
+	Package *pkgInfo
+	Version string
+	Arch    string
+	Files   int   // the number of entries in the package
+	Size    int64 // the total size of the files
+	Tree    []*fileNode
+}
+
+// webTemplates is a parsed set of templates.
+type webTemplates struct {
+	css         template.CSS
+	stylesheets []Stylesheet
+	pages       map[string]*template.Template
+}
+
+// loadWebTemplates parses the templates for the web interface. Any other .html
+// files in the template dir are parsed after the default ones, so they can be
+// used to override individual templates (e.g. "footer") without replacing
+// base.html.
+func (o *Options) loadWebTemplates() (*webTemplates, error) {
+	var extra []string
+	if o.TemplateDir != "" {
+		if fi, err := os.Stat(o.TemplateDir); err != nil {
+			return nil, fmt.Errorf("error reading template dir: %v", err)
+		} else if !fi.IsDir() {
+			return nil, fmt.Errorf("template dir '%s' is not a directory", o.TemplateDir)
+		}
+		fns, err := filepath.Glob(filepath.Join(o.TemplateDir, "*.html"))
+		if err != nil {
+			return nil, fmt.Errorf("error listing template dir: %v", err)
+		}
+		for _, fn := range fns {
+			if name := filepath.Base(fn); !inSlice(webPageTemplates, name) && !inSlice(webSharedTemplates, name) {
+				extra = append(extra, name)
+			}
+		}
+		sort.Strings(extra)
+	}
+
+	css, _, err := o.readWebTemplate("base.css")
+	if err != nil {
+		return nil, err
+	}
+
+	w := &webTemplates{
+		css:         template.CSS(css),
+		stylesheets: webStylesheetLinks(o.CDN),
+		pages:       map[string]*template.Template{},
+	}
+	for _, page := range webPageTemplates {
+		t := template.New("").Funcs(tmplFuncs)
+		for _, name := range append(append(append([]string{}, webSharedTemplates...), page), extra...) {
+			text, src, err := o.readWebTemplate(name)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := t.New(name).Parse(text); err != nil {
+				return nil, fmt.Errorf("error parsing template %s: %v", src, err)
+			}
+		}
+		if t.Lookup("content") == nil {
+			return nil, fmt.Errorf("error parsing template %s: no content template defined", page)
+		}
+		w.pages[page] = t
+	}
+	return w, nil
+}
+
+// readWebTemplate reads a template from the template dir, falling back to the
+// embedded one. It also returns a description of where it was read from.
+func (o *Options) readWebTemplate(name string) (string, string, error) {
+	if o.TemplateDir != "" {
+		fn := filepath.Join(o.TemplateDir, name)
+		buf, err := ioutil.ReadFile(fn)
+		if err == nil {
+			return string(buf), fn, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", fn, fmt.Errorf("error reading template %s: %v", fn, err)
+		}
+	}
+	buf, err := webTemplateFiles.ReadFile("templates/" + name)
+	if err != nil {
+		return "", name, fmt.Errorf("error reading default template %s: %v", name, err)
+	}
+	return string(buf), "default " + name, nil
+}
+
+// render renders a page.
+func (w *webTemplates) render(page string, p *Page) ([]byte, error) {
+	t, ok := w.pages[page]
+	if !ok {
+		return nil, fmt.Errorf("unknown page template %s", page)
+	}
+	p.CSS, p.Stylesheets = w.css, w.stylesheets
+
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "base.html", p); err != nil {
+		return nil, fmt.Errorf("error executing template %s: %v", page, err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,65 @@
+package web
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repogen-templates")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	page := &Page{
+		Title:  "test",
+		Origin: "Example",
+		Dist:   "stable",
+		Data:   &DistData{Dist: "stable", Packages: map[string]*pkgInfo{}, Components: []string{"main"}},
+	}
+
+	w, err := (&Options{}).loadWebTemplates()
+	if assert.NoError(t, err, "default templates should load") {
+		buf, err := w.render("dist.html", page)
+		assert.NoError(t, err)
+		assert.Contains(t, string(buf), "Powered by", "default footer should be used")
+		assert.Contains(t, string(buf), "Packages in stable", "content should be rendered")
+	}
+
+	tdir := filepath.Join(dir, "templates")
+	os.Mkdir(tdir, 0755)
+	ioutil.WriteFile(filepath.Join(tdir, "footer.html"), []byte(`{{define "footer"}}Packages for {{.Origin}}{{end}}`), 0644)
+	ioutil.WriteFile(filepath.Join(tdir, "base.css"), []byte(`body{color:red}`), 0644)
+
+	w, err = (&Options{TemplateDir: tdir}).loadWebTemplates()
+	if assert.NoError(t, err, "custom templates should load") {
+		buf, err := w.render("dist.html", page)
+		assert.NoError(t, err)
+		assert.Contains(t, string(buf), "Packages for Example", "footer should be overridden")
+		assert.NotContains(t, string(buf), "Powered by", "footer should be overridden")
+		assert.Contains(t, string(buf), "color:red", "css should be overridden")
+	}
+
+	ioutil.WriteFile(filepath.Join(tdir, "dist.html"), []byte(`{{define "content"}}{{.Nope}}{{end}}`), 0644)
+	w, err = (&Options{TemplateDir: tdir}).loadWebTemplates()
+	if assert.NoError(t, err) {
+		_, err := w.render("dist.html", page)
+		assert.EqualError(t, err, `error executing template dist.html: template: dist.html:1:22: executing "content" at <.Nope>: can't evaluate field Nope in type *web.DistData`, "execution errors should be returned")
+	}
+
+	ioutil.WriteFile(filepath.Join(tdir, "dist.html"), []byte(`{{define "content"}}{{if}}{{end}}`), 0644)
+	_, err = (&Options{TemplateDir: tdir}).loadWebTemplates()
+	assert.EqualError(t, err, "error parsing template "+filepath.Join(tdir, "dist.html")+": template: dist.html:1: missing value for if", "parse errors should be returned")
+
+	ioutil.WriteFile(filepath.Join(tdir, "dist.html"), []byte(`nothing`), 0644)
+	_, err = (&Options{TemplateDir: tdir}).loadWebTemplates()
+	assert.EqualError(t, err, "error parsing template dist.html: no content template defined", "missing content templates should be detected")
+
+	_, err = (&Options{TemplateDir: filepath.Join(dir, "nonexistent")}).loadWebTemplates()
+	assert.Error(t, err, "nonexistent template dir should be an error")
+}
@@ -0,0 +1,672 @@
+// Package web generates a static web interface for browsing the packages in
+// a repository.
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/repo"
+	"github.com/pgaskin/repogen/version"
+	"github.com/tdewolff/minify"
+	"github.com/tdewolff/minify/css"
+)
+
+type pkgInfo struct {
+	Package                 string                                  `json:"package"`
+	LatestVersion           string                                  `json:"latest_version"`
+	ShortDescription        string                                  `json:"short_description"`
+	Description             string                                  `json:"description,omitempty"`
+	License                 string                                  `json:"license,omitempty"`
+	Maintainer              string                                  `json:"maintainer,omitempty"`
+	MaintainerName          string                                  `json:"maintainer_name,omitempty"`
+	MaintainerEmail         string                                  `json:"maintainer_email,omitempty"`
+	Section                 string                                  `json:"section,omitempty"`
+	DownloadSize            int64                                   `json:"download_size,omitempty"`
+	Homepage                string                                  `json:"homepage,omitempty"`
+	Depends                 []string                                `json:"depends,omitempty"`
+	PreDepends              []string                                `json:"pre_depends,omitempty"`
+	Recommends              []string                                `json:"recommends,omitempty"`
+	Suggests                []string                                `json:"suggests,omitempty"`
+	Enhances                []string                                `json:"enhances,omitempty"`
+	Breaks                  []string                                `json:"breaks,omitempty"`
+	Conflicts               []string                                `json:"conflicts,omitempty"`
+	Provides                []string                                `json:"provides,omitempty"`
+	Replaces                []string                                `json:"replaces,omitempty"`
+	MultiArch               string                                  `json:"multi_arch,omitempty"`
+	Virtual                 bool                                    `json:"virtual,omitempty"`
+	ProvidedBy              []pkgRelation                           `json:"provided_by,omitempty"`
+	ReverseDepends          []pkgRelation                           `json:"reverse_depends,omitempty"`
+	Changelog               []*deb.ChangelogEntry                   `json:"-"`
+	ChangelogPath           string                                  `json:"-"`
+	FileLists               map[string]string                       `json:"-"`            // version_arch -> file list page
+	Availability            map[string]map[string]map[string]string `json:"availability"` // version -> arch -> component -> download path
+	AvailabilityTableHeader []string                                `json:"availability_table_header"`
+	AvailabilityTable       [][]map[string]string                   `json:"availability_table"` // [row][col][component] = link
+	Fields                  map[string]string                       `json:"fields"`
+	OtherDists              []string                                `json:"other_dists"`
+}
+
+// maxWebChangelogEntries is the maximum number of changelog entries to show on
+// the package page.
+const maxWebChangelogEntries = 10
+
+// pkgRelation is a relationship from another package.
+type pkgRelation struct {
+	Package string `json:"package"`
+	Type    string `json:"type"` // the lowercase field name (e.g. depends)
+	Spec    string `json:"spec"`
+}
+
+// relationFields are the fields used for reverse dependencies, in the order
+// they are displayed.
+var relationFields = []string{"Pre-Depends", "Depends", "Recommends", "Suggests", "Enhances", "Breaks", "Conflicts"}
+
+// Options configures the web interface.
+type Options struct {
+	TemplateDir     string              // a dir containing templates and assets to override the default ones (optional)
+	CDN             bool                // load some assets from cdnjs rather than packages/assets
+	SearchShardSize int                 // the maximum number of packages in each part of the search index (0 for no limit)
+	Public          []string            // the DIST/COMPONENTs to include in the web interface (nil for all)
+	Views           map[string][]string // additional web interfaces to generate in .web/NAME containing only the specified DIST/COMPONENTs (for serve)
+	Warn            func(msg string)    // called for warnings (e.g. changelogs which can't be parsed) (the default prints them to stderr)
+}
+
+func (o *Options) warn(msg string) {
+	if o.Warn != nil {
+		o.Warn(msg)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Warning: %s\n", msg)
+}
+
+// Generate generates the web interface for a repository in packages/. It must
+// be called after the repository has been scanned and generated.
+func Generate(ctx context.Context, r *repo.Repo, opts Options) error {
+	tmpls, err := opts.loadWebTemplates()
+	if err != nil {
+		return fmt.Errorf("error loading templates: %v", err)
+	}
+
+	if err := generateWeb(ctx, r, &opts, tmpls, "packages", opts.Public); err != nil {
+		return err
+	}
+
+	for name, view := range opts.Views {
+		if err := generateWeb(ctx, r, &opts, tmpls, path.Join(".web", name), view); err != nil {
+			return fmt.Errorf("error generating web view %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// generateWeb generates a web interface in webRoot (relative to the root of the
+// repository) containing the packages from the specified DIST/COMPONENTs (or
+// all of them if nil).
+func generateWeb(ctx context.Context, r *repo.Repo, o *Options, tmpls *webTemplates, webRoot string, include []string) error {
+	writePage := func(name, page string, p *Page) error {
+		buf, err := tmpls.render(page, p)
+		if err != nil {
+			return err
+		}
+		return r.Put(ctx, name, buf)
+	}
+
+	err := writeWebAssets(ctx, r, webAssetsFS, path.Join(webRoot, "assets"))
+	if err != nil {
+		return fmt.Errorf("error writing web assets: %v", err)
+	}
+
+	if o.TemplateDir != "" {
+		if fi, err := os.Stat(filepath.Join(o.TemplateDir, "assets")); err == nil && fi.IsDir() {
+			err = writeWebAssets(ctx, r, os.DirFS(filepath.Join(o.TemplateDir, "assets")), path.Join(webRoot, "assets"))
+			if err != nil {
+				return fmt.Errorf("error writing custom web assets: %v", err)
+			}
+		}
+	}
+
+	packages := map[string]map[string]*pkgInfo{}             // dist -> info from latest package
+	fileLists := map[string]map[string]map[string]*deb.Deb{} // dist -> package -> version_arch -> deb
+	archs, comps, dists := []string{}, []string{}, []string{}
+
+	// iterate in a fixed order, since the first component wins if the same
+	// version is in more than one (the overrides may differ)
+	for _, distName := range sortedKeys(r.Dists) {
+		dist := r.Dists[distName]
+		for _, compName := range sortedKeys(dist) {
+			comp := dist[compName]
+			if include != nil && !inSlice(include, distName+"/"+compName) {
+				continue
+			}
+			if !inSlice(dists, distName) {
+				dists = append(dists, distName)
+			}
+			if !inSlice(comps, compName) {
+				comps = append(comps, compName)
+			}
+			for _, pkg := range comp {
+				pkgName := pkg.Package()
+				pkgVersion := pkg.Version()
+				pkgArch := pkg.Architecture()
+				if !inSlice(archs, pkgArch) {
+					archs = append(archs, pkgArch)
+				}
+
+				if _, ok := packages[distName]; !ok {
+					packages[distName] = map[string]*pkgInfo{}
+				}
+				if _, ok := packages[distName][pkgName]; !ok {
+					packages[distName][pkgName] = &pkgInfo{
+						Availability: map[string]map[string]map[string]string{},
+						Fields:       map[string]string{},
+						OtherDists:   []string{},
+					}
+				}
+
+				wpkg := packages[distName][pkgName]
+
+				if _, ok := wpkg.Availability[pkgVersion]; !ok {
+					packages[distName][pkgName].Availability[pkgVersion] = map[string]map[string]string{}
+				}
+				if _, ok := wpkg.Availability[pkgArch][pkgArch]; !ok {
+					packages[distName][pkgName].Availability[pkgVersion][pkgArch] = map[string]string{}
+				}
+				if _, ok := wpkg.Availability[pkgVersion][pkgArch][compName]; !ok {
+					packages[distName][pkgName].Availability[pkgVersion][pkgArch][compName] = r.PoolPath(compName, pkg)
+				}
+
+				if pkg.Contents != nil {
+					if _, ok := fileLists[distName]; !ok {
+						fileLists[distName] = map[string]map[string]*deb.Deb{}
+					}
+					if _, ok := fileLists[distName][pkgName]; !ok {
+						fileLists[distName][pkgName] = map[string]*deb.Deb{}
+						wpkg.FileLists = map[string]string{}
+					}
+					if _, ok := fileLists[distName][pkgName][pkgVersion+"_"+pkgArch]; !ok {
+						fileLists[distName][pkgName][pkgVersion+"_"+pkgArch] = pkg
+						wpkg.FileLists[pkgVersion+"_"+pkgArch] = fmt.Sprintf("%s/%s/files/%s_%s.html", distName, pkgName, pkgVersion, pkgArch)
+					}
+				}
+
+				if packages[distName][pkgName].Package == "" || version.Newer(pkgVersion, packages[distName][pkgName].LatestVersion) {
+					// fill in fields, as this is the newest version so far
+					ctrl, _ := r.Control(distName, compName, pkg)
+					wpkg.Package = pkgName
+					wpkg.LatestVersion = pkgVersion
+					wpkg.Description = ctrl.MightGet("Description")
+					wpkg.ShortDescription = strings.Split(ctrl.MightGet("Description"), "\n")[0]
+					wpkg.License = ctrl.MightGet("License")
+					wpkg.Maintainer = ctrl.MightGet("Maintainer")
+					if m := regexp.MustCompile(`^(.+) <([^ ]+@[^ ]+)>$`).FindStringSubmatch(ctrl.MightGet("Maintainer")); len(m) == 3 {
+						wpkg.MaintainerName = m[1]
+						wpkg.MaintainerEmail = m[2]
+					} else {
+						wpkg.MaintainerName = ctrl.MightGet("Maintainer")
+					}
+					wpkg.DownloadSize = pkg.Size
+					wpkg.Homepage = ctrl.MightGet("Homepage")
+					wpkg.Depends = splitList(ctrl.MightGet("Depends"))
+					wpkg.PreDepends = splitList(ctrl.MightGet("Pre-Depends"))
+					wpkg.Recommends = splitList(ctrl.MightGet("Recommends"))
+					wpkg.Suggests = splitList(ctrl.MightGet("Suggests"))
+					wpkg.Breaks = splitList(ctrl.MightGet("Breaks"))
+					wpkg.Enhances = splitList(ctrl.MightGet("Enhances"))
+					wpkg.Conflicts = splitList(ctrl.MightGet("Conflicts"))
+					wpkg.Provides = splitList(ctrl.MightGet("Provides"))
+					wpkg.Replaces = splitList(ctrl.MightGet("Replaces"))
+					wpkg.MultiArch = ctrl.MightGet("Multi-Arch")
+					wpkg.Changelog, wpkg.ChangelogPath = nil, ""
+					if pkg.Changelog != "" {
+						if cl, err := deb.ParseChangelog(pkg.Changelog); err != nil {
+							o.warn(fmt.Sprintf("could not parse changelog of %s %s: %v", pkgName, pkgVersion, err))
+						} else {
+							if len(cl) > maxWebChangelogEntries {
+								cl = cl[:maxWebChangelogEntries]
+							}
+							wpkg.Changelog = cl
+						}
+						wpkg.ChangelogPath = repo.ChangelogPath(compName, pkg)
+					}
+					wpkg.Section = ctrl.MightGet("Section")
+					wpkg.Fields = ctrl.Values
+				}
+			}
+		}
+	}
+
+	sort.Strings(archs)
+	sort.Strings(dists)
+	sort.Strings(comps)
+
+	for distName, tmp := range packages {
+		for pkgName := range tmp {
+			for _, checkDist := range dists {
+				if _, ok := packages[checkDist][pkgName]; ok {
+					packages[distName][pkgName].OtherDists = append(packages[distName][pkgName].OtherDists, checkDist)
+				}
+			}
+		}
+	}
+
+	for distName, tmp := range packages {
+		for pkgName := range tmp {
+			packages[distName][pkgName].AvailabilityTableHeader = append([]string{""}, archs...)
+
+			t := [][]map[string]string{}
+			for pversion, parchs := range packages[distName][pkgName].Availability {
+				row := []map[string]string{{"version": pversion}}
+				for _, arch := range archs {
+					col := map[string]string{}
+					for parch, pcomps := range parchs {
+						if parch == arch {
+							for pcomp, link := range pcomps {
+								col[pcomp] = link
+							}
+						}
+					}
+					row = append(row, col)
+				}
+				t = append(t, row)
+			}
+			packages[distName][pkgName].AvailabilityTable = t
+
+			sort.Slice(t, func(i, j int) bool {
+				return !version.Newer(t[i][0]["version"], t[j][0]["version"])
+			})
+		}
+	}
+
+	virtuals := map[string]map[string]*pkgInfo{} // dist -> virtual package name -> info
+	for distName, dist := range packages {
+		virtuals[distName] = map[string]*pkgInfo{}
+		lookup := func(name string) *pkgInfo {
+			if p, ok := dist[name]; ok {
+				return p
+			}
+			return virtuals[distName][name]
+		}
+
+		for pkgName, pkg := range dist {
+			provides, _ := deb.ParseRelations(pkg.Fields["Provides"])
+			for _, dep := range provides {
+				v := lookup(dep[0].Name)
+				if v == nil {
+					v = &pkgInfo{
+						Package:    dep[0].Name,
+						Virtual:    true,
+						Fields:     map[string]string{},
+						OtherDists: []string{},
+					}
+					virtuals[distName][dep[0].Name] = v
+				}
+				v.ProvidedBy = append(v.ProvidedBy, pkgRelation{Package: pkgName, Type: "provides", Spec: dep.String()})
+			}
+		}
+
+		for pkgName, pkg := range dist {
+			for _, field := range relationFields {
+				deps, _ := deb.ParseRelations(pkg.Fields[field])
+				seen := map[string]bool{}
+				for _, dep := range deps {
+					for _, rel := range dep {
+						if p := lookup(rel.Name); p != nil && p != pkg && !seen[rel.Name] {
+							seen[rel.Name] = true
+							p.ReverseDepends = append(p.ReverseDepends, pkgRelation{Package: pkgName, Type: strings.ToLower(field), Spec: dep.String()})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for _, m := range []map[string]map[string]*pkgInfo{packages, virtuals} {
+		for _, dist := range m {
+			for _, pkg := range dist {
+				sortRelations(pkg.ProvidedBy)
+				sortRelations(pkg.ReverseDepends)
+			}
+		}
+	}
+
+	for distName, dist := range virtuals {
+		for pkgName, pkg := range dist {
+			pkg.ShortDescription = fmt.Sprintf("virtual package provided by %d package(s)", len(pkg.ProvidedBy))
+			for _, checkDist := range dists {
+				if _, ok := packages[checkDist][pkgName]; ok {
+					pkg.OtherDists = append(pkg.OtherDists, checkDist)
+				} else if _, ok := virtuals[checkDist][pkgName]; ok || checkDist == distName {
+					pkg.OtherDists = append(pkg.OtherDists, checkDist)
+				}
+			}
+		}
+	}
+
+	repoData := map[string]interface{}{
+		"packages": packages,
+		"archs":    archs,
+		"dists":    dists,
+		"comps":    comps,
+		"origin":   r.Origin,
+	}
+
+	buf, err := json.Marshal(repoData)
+	if err != nil {
+		return fmt.Errorf("error generating repo json: %v", err)
+	}
+	err = r.Put(ctx, path.Join(webRoot, "repo.json"), buf)
+	if err != nil {
+		return fmt.Errorf("error writing repo json: %v", err)
+	}
+
+	for _, dist := range dists {
+		js, shards, err := getSearch(dist, packages[dist], o.SearchShardSize)
+		if err != nil {
+			return fmt.Errorf("error generating search code: %v", err)
+		}
+		err = r.Put(ctx, path.Join(webRoot, "search."+dist+".js"), []byte(js))
+		if err != nil {
+			return fmt.Errorf("error writing repo search code: %v", err)
+		}
+		for fn, buf := range shards {
+			err = r.Put(ctx, path.Join(webRoot, fn), buf)
+			if err != nil {
+				return fmt.Errorf("error writing search data: %v", err)
+			}
+		}
+	}
+
+	err = writePage(path.Join(webRoot, "index.html"), "dists.html", &Page{
+		Title:       "Packages",
+		Base:        "",
+		Origin:      r.Origin,
+		Description: r.Description,
+		Data: &DistsData{
+			Dists:    dists,
+			Packages: packages,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("error generating index.html: %v", err)
+	}
+
+	for distName, dist := range packages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		webRootDist := path.Join(webRoot, distName)
+
+		err = writePage(path.Join(webRootDist, "index.html"), "dist.html", &Page{
+			Title:       distName + " - Packages",
+			Base:        "../",
+			Origin:      r.Origin,
+			Description: r.Description,
+			Dist:        distName,
+			Data: &DistData{
+				Dist:       distName,
+				Packages:   dist,
+				Components: comps,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("error generating dist/index.html: %v", err)
+		}
+
+		distPkgs := []string{}
+		for pkgName := range dist {
+			distPkgs = append(distPkgs, pkgName)
+		}
+		for pkgName := range virtuals[distName] {
+			distPkgs = append(distPkgs, pkgName)
+		}
+
+		for pkgName, pkg := range dist {
+			webRootDistPkg := path.Join(webRootDist, pkgName)
+
+			err := writePage(path.Join(webRootDistPkg, "index.html"), "package.html", &Page{
+				Title:       pkgName + " - Packages",
+				Base:        "../../",
+				Origin:      r.Origin,
+				Description: r.Description,
+				Dist:        distName,
+				Package:     pkgName,
+				Data: &PackageData{
+					Dist:         distName,
+					Name:         pkgName,
+					Package:      pkg,
+					DistPackages: distPkgs,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("error generating dist/pkg/index.html: %v", err)
+			}
+
+			for key, d := range fileLists[distName][pkgName] {
+				var size int64
+				for _, f := range d.Contents {
+					size += f.Size
+				}
+				err = writePage(path.Join(webRootDistPkg, "files", key+".html"), "files.html", &Page{
+					Title:       pkgName + " " + d.Version() + " (" + d.Architecture() + ") - Files - Packages",
+					Base:        "../../../",
+					Origin:      r.Origin,
+					Description: r.Description,
+					Dist:        distName,
+					Package:     pkgName,
+					Data: &FilesData{
+						Dist:    distName,
+						Name:    pkgName,
+						Package: pkg,
+						Version: d.Version(),
+						Arch:    d.Architecture(),
+						Files:   len(d.Contents),
+						Size:    size,
+						Tree:    newFileTree(d.Contents),
+					},
+				})
+				if err != nil {
+					return fmt.Errorf("error generating dist/pkg/files/version_arch.html: %v", err)
+				}
+			}
+		}
+
+		for pkgName, pkg := range virtuals[distName] {
+			webRootDistPkg := path.Join(webRootDist, pkgName)
+
+			err := writePage(path.Join(webRootDistPkg, "index.html"), "virtual.html", &Page{
+				Title:       pkgName + " - Packages",
+				Base:        "../../",
+				Origin:      r.Origin,
+				Description: r.Description,
+				Dist:        distName,
+				Package:     pkgName,
+				Data: &PackageData{
+					Dist:         distName,
+					Name:         pkgName,
+					Package:      pkg,
+					DistPackages: distPkgs,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("error generating dist/virtual/index.html: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileNode is a node in the file tree of a package.
+type fileNode struct {
+	Name     string
+	File     *deb.File // nil if the directory is not in the archive
+	Children []*fileNode
+}
+
+// newFileTree builds a file tree from the contents of a package. Directories
+// come before files, and the children of each node are sorted by name.
+func newFileTree(contents []*deb.File) []*fileNode {
+	root := &fileNode{}
+	nodes := map[string]*fileNode{"": root}
+
+	var get func(name string) *fileNode
+	get = func(name string) *fileNode {
+		if n, ok := nodes[name]; ok {
+			return n
+		}
+		dir, base := path.Split(name)
+		n := &fileNode{Name: base}
+		parent := get(strings.TrimSuffix(dir, "/"))
+		parent.Children = append(parent.Children, n)
+		nodes[name] = n
+		return n
+	}
+
+	for _, f := range contents {
+		get(f.Name).File = f
+	}
+
+	var sortTree func(n *fileNode)
+	sortTree = func(n *fileNode) {
+		sort.Slice(n.Children, func(i, j int) bool {
+			if di, dj := n.Children[i].IsDir(), n.Children[j].IsDir(); di != dj {
+				return di
+			}
+			return n.Children[i].Name < n.Children[j].Name
+		})
+		for _, c := range n.Children {
+			sortTree(c)
+		}
+	}
+	sortTree(root)
+
+	return root.Children
+}
+
+// IsDir returns true if the node is a directory.
+func (n *fileNode) IsDir() bool {
+	return len(n.Children) != 0 || (n.File != nil && n.File.Mode.IsDir())
+}
+
+// ModeString formats the mode like ls.
+func (n *fileNode) ModeString() string {
+	if n.File == nil {
+		return "d?????????"
+	}
+	m := n.File.Mode.String()
+	switch {
+	case n.File.Mode&os.ModeSymlink != 0:
+		m = "l" + m[1:]
+	case n.File.Hardlink:
+		m = "h" + m[1:]
+	}
+	return m
+}
+
+// Owner formats the owner like tar.
+func (n *fileNode) Owner() string {
+	if n.File == nil {
+		return ""
+	}
+	u, g := n.File.Uname, n.File.Gname
+	if u == "" {
+		u = fmt.Sprint(n.File.Uid)
+	}
+	if g == "" {
+		g = fmt.Sprint(n.File.Gid)
+	}
+	return u + "/" + g
+}
+
+// sortRelations sorts relations by type (in the order of relationFields), then
+// by package name.
+func sortRelations(rels []pkgRelation) {
+	typeIndex := func(t string) int {
+		for i, f := range relationFields {
+			if strings.ToLower(f) == t {
+				return i
+			}
+		}
+		return -1
+	}
+	sort.SliceStable(rels, func(i, j int) bool {
+		if ti, tj := typeIndex(rels[i].Type), typeIndex(rels[j].Type); ti != tj {
+			return ti < tj
+		}
+		return rels[i].Package < rels[j].Package
+	})
+}
+
+func splitList(l string) []string {
+	ls := []string{}
+	for _, i := range strings.Split(strings.Replace(l, ", ", ",", -1), ",") {
+		if s := strings.TrimSpace(i); s != "" {
+			ls = append(ls, s)
+		}
+	}
+	return ls
+}
+
+// sortedKeys returns the sorted keys of a map.
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func inSlice(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var tmplFuncs = template.FuncMap{
+	"br": func(s string) template.HTML {
+		return template.HTML(strings.Replace(strings.Replace(template.HTMLEscapeString(s), "\r\n", "\n", -1), "\n", "<br />", -1))
+	},
+	"dependsToPkg": func(pkgSpec string) string {
+		if rel, err := deb.ParseRelation(strings.Split(pkgSpec, "|")[0]); err == nil {
+			return rel.Name
+		}
+		return strings.Split(pkgSpec, " ")[0]
+	},
+	"minifyCSS": func(in template.CSS) template.CSS {
+		o, m := new(bytes.Buffer), minify.New()
+		m.AddFunc("text/css", css.Minify)
+		if m.Minify("text/css", o, strings.NewReader(string(in))) != nil {
+			return in
+		}
+		return template.CSS(o.String())
+	},
+	"inSlice": inSlice,
+	"humanSize": func(n int64) string {
+		switch {
+		case n >= 1024*1024*1024:
+			return fmt.Sprintf("%.1f GiB", float64(n)/1024/1024/1024)
+		case n >= 1024*1024:
+			return fmt.Sprintf("%.1f MiB", float64(n)/1024/1024)
+		case n >= 1024:
+			return fmt.Sprintf("%.1f KiB", float64(n)/1024)
+		}
+		return fmt.Sprintf("%d B", n)
+	},
+}
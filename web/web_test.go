@@ -0,0 +1,205 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pgaskin/repogen/control"
+	"github.com/pgaskin/repogen/deb"
+	"github.com/pgaskin/repogen/repo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-web")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	for fn, ctrl := range map[string]string{
+		"stable/main/app.deb":     "Package: app\nVersion: 1.0\nArchitecture: all\nDepends: libfoo (>= 1), mail-transport-agent\nRecommends: libbar | libfoo\nDescription: app\n",
+		"stable/main/libfoo.deb":  "Package: libfoo\nVersion: 1.0\nArchitecture: all\nBreaks: libbar (<< 2)\nDescription: libfoo\n",
+		"stable/main/libbar.deb":  "Package: libbar\nVersion: 1.0\nArchitecture: all\nReplaces: libfoo (<< 1)\nDescription: libbar\n",
+		"stable/main/exim4.deb":   "Package: exim4\nVersion: 1.0\nArchitecture: all\nProvides: mail-transport-agent\nConflicts: mail-transport-agent\nDescription: exim4\n",
+		"stable/main/postfix.deb": "Package: postfix\nVersion: 1.0\nArchitecture: all\nProvides: mail-transport-agent (= 1.0), libfoo\nDescription: postfix\n",
+		"testing/main/other.deb":  "Package: other\nVersion: 1.0\nArchitecture: all\nDepends: app\nDescription: other\n",
+	} {
+		c, err := control.Parse(ctrl)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var files []*deb.BuildFile
+		if c.MightGet("Package") == "other" {
+			changelog := new(bytes.Buffer)
+			zw := gzip.NewWriter(changelog)
+			zw.Write([]byte("invalid\n"))
+			zw.Close()
+			files = append(files, &deb.BuildFile{Name: "usr/share/doc/other/changelog.Debian.gz", Mode: 0644, Data: changelog.Bytes()})
+		}
+		buf := new(bytes.Buffer)
+		assert.NoError(t, deb.Build(buf, deb.BuildOptions{Control: c, Files: files, Date: time.Unix(1700000000, 0)}))
+		fn = filepath.Join(td, "in", filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, buf.Bytes(), 0644))
+	}
+
+	ctx := context.Background()
+	r, err := repo.New(repo.Options{
+		InRoot:             filepath.Join(td, "in"),
+		OutRoot:            filepath.Join(td, "out"),
+		GenerateChangelogs: true,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, r.Scan(ctx))
+	var warnings []string
+	if !assert.NoError(t, Generate(ctx, r, Options{Warn: func(msg string) { warnings = append(warnings, msg) }})) {
+		return
+	}
+	assert.Equal(t, []string{"could not parse changelog of other 1.0: expected changelog entry header at line 1"}, warnings, "warnings should be passed to the callback")
+
+	var data struct {
+		Packages map[string]map[string]*pkgInfo `json:"packages"`
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(td, "out", "packages", "repo.json"))
+	if assert.NoError(t, err) {
+		assert.NoError(t, json.Unmarshal(buf, &data))
+	}
+	stable := data.Packages["stable"]
+
+	assert.Equal(t, []pkgRelation{
+		{Package: "app", Type: "depends", Spec: "libfoo (>= 1)"},
+		{Package: "app", Type: "recommends", Spec: "libbar | libfoo"},
+	}, stable["libfoo"].ReverseDepends, "reverse dependencies should be listed once per field, including alternatives")
+	assert.Equal(t, []pkgRelation{
+		{Package: "app", Type: "recommends", Spec: "libbar | libfoo"},
+		{Package: "libfoo", Type: "breaks", Spec: "libbar (<< 2)"},
+	}, stable["libbar"].ReverseDepends, "reverse dependencies should include breaks but not replaces")
+	assert.Empty(t, stable["app"].ReverseDepends, "reverse dependencies from other dists shouldn't be included")
+	assert.Equal(t, []pkgRelation{
+		{Package: "postfix", Type: "provides", Spec: "libfoo"},
+	}, stable["libfoo"].ProvidedBy, "real packages can also be provided")
+	assert.Equal(t, []string{"libfoo (<< 1)"}, stable["libbar"].Replaces)
+	assert.Equal(t, []string{"mail-transport-agent (= 1.0)", "libfoo"}, stable["postfix"].Provides)
+	assert.NotContains(t, stable, "mail-transport-agent", "virtual packages shouldn't be in the package list")
+
+	buf, err = ioutil.ReadFile(filepath.Join(td, "out", "packages", "stable", "mail-transport-agent", "index.html"))
+	if assert.NoError(t, err, "a page should be generated for the virtual package") {
+		assert.Contains(t, string(buf), "virtual package provided by 2 package(s)")
+		assert.Contains(t, string(buf), `href="stable/exim4/"`, "the providers should be listed")
+		assert.Contains(t, string(buf), "provides mail-transport-agent (= 1.0)", "the providers should be listed")
+		assert.Contains(t, string(buf), `href="stable/app/"`, "the reverse dependencies should be listed")
+	}
+	_, err = os.Stat(filepath.Join(td, "out", "packages", "testing", "mail-transport-agent", "index.html"))
+	assert.True(t, os.IsNotExist(err), "virtual packages should only be generated in dists which have providers")
+
+	buf, err = ioutil.ReadFile(filepath.Join(td, "out", "packages", "stable", "libfoo", "index.html"))
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(buf), "Reverse Dependencies")
+		assert.Contains(t, string(buf), "Provided By")
+	}
+}
+
+func TestNewFileTree(t *testing.T) {
+	tree := newFileTree([]*deb.File{
+		{Name: "usr", Mode: os.ModeDir | 0755},
+		{Name: "usr/bin/b", Mode: 0755},
+		{Name: "usr/bin/a", Mode: os.ModeSymlink | 0777, Linkname: "b"},
+		{Name: "usr/share/doc/a/copyright", Mode: 0644},
+		{Name: "etc/a.conf", Mode: 0644},
+	})
+
+	var walk func(prefix string, ns []*fileNode) []string
+	walk = func(prefix string, ns []*fileNode) []string {
+		var s []string
+		for _, n := range ns {
+			s = append(s, prefix+n.Name+" "+n.ModeString())
+			s = append(s, walk(prefix+n.Name+"/", n.Children)...)
+		}
+		return s
+	}
+
+	assert.Equal(t, []string{
+		"etc d?????????",
+		"etc/a.conf -rw-r--r--",
+		"usr drwxr-xr-x",
+		"usr/bin d?????????",
+		"usr/bin/a lrwxrwxrwx",
+		"usr/bin/b -rwxr-xr-x",
+		"usr/share d?????????",
+		"usr/share/doc d?????????",
+		"usr/share/doc/a d?????????",
+		"usr/share/doc/a/copyright -rw-r--r--",
+	}, walk("", tree), "tree should be built and sorted correctly")
+}
+
+func TestReproducible(t *testing.T) {
+	td, err := ioutil.TempDir("", "repogen-web")
+	if err != nil {
+		t.Fatalf("could not create temp dir: %v", err)
+	}
+	defer os.RemoveAll(td)
+
+	// the same version in several components, with different overrides
+	for _, fn := range []string{"stable/main/foo.deb", "stable/contrib/foo.deb", "stable/non-free/foo.deb", "testing/main/foo.deb", "testing/contrib/foo.deb"} {
+		c, err := control.Parse("Package: foo\nVersion: 1.0\nArchitecture: all\nDescription: foo\n")
+		if !assert.NoError(t, err) {
+			return
+		}
+		buf := new(bytes.Buffer)
+		assert.NoError(t, deb.Build(buf, deb.BuildOptions{Control: c, Date: time.Unix(1700000000, 0)}))
+		fn = filepath.Join(td, "in", filepath.FromSlash(fn))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+		assert.NoError(t, ioutil.WriteFile(fn, buf.Bytes(), 0644))
+	}
+
+	generate := func(out string) map[string]string {
+		ctx := context.Background()
+		r, err := repo.New(repo.Options{
+			InRoot:  filepath.Join(td, "in"),
+			OutRoot: filepath.Join(td, out),
+			Overrides: []*repo.Override{
+				{Scope: "*/main", Package: "foo", Field: "Description", Value: "foo (main)"},
+				{Scope: "*/contrib", Package: "foo", Field: "Description", Value: "foo (contrib)"},
+				{Scope: "*/non-free", Package: "foo", Field: "Description", Value: "foo (non-free)"},
+			},
+		})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		assert.NoError(t, r.Scan(ctx))
+		assert.NoError(t, Generate(ctx, r, Options{}))
+
+		files := map[string]string{}
+		assert.NoError(t, filepath.Walk(filepath.Join(td, out), func(p string, fi os.FileInfo, err error) error {
+			if err != nil || fi.IsDir() {
+				return err
+			}
+			buf, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			rel, _ := filepath.Rel(filepath.Join(td, out), p)
+			files[rel] = string(buf)
+			return nil
+		}))
+		return files
+	}
+
+	a := generate("out0")
+	assert.NotEmpty(t, a)
+	assert.Contains(t, a[filepath.Join("packages", "stable", "foo", "index.html")], "foo (contrib)", "the first component should be used")
+	for i := 1; i < 5; i++ {
+		assert.Equal(t, a, generate("out"+strconv.Itoa(i)), "the web interface should be the same every time")
+	}
+}